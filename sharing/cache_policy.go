@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/practice/sharing/util/codec"
+)
+
+// CachePolicy decides how long active users are cached and under which keys
+type CachePolicy struct {
+	// Ttl is how long active users are cached, CacheTtlActiveUserByType when 0
+	Ttl time.Duration
+	// TtlByUserType overrides Ttl for users of a type, an audience of several types uses the shortest of their ttl
+	TtlByUserType map[UserType]time.Duration
+	// KeyPrefix prefixes the cache keys, CacheKeyPrefixActiveUsers when empty
+	KeyPrefix string
+	// SoftTtl is how long cached users are fresh, stale users are returned while refreshed in the background
+	// until they expire after their ttl, users are never stale when 0
+	SoftTtl time.Duration
+	// SchemaVersion versions the cache keys, CacheSchemaVersionUsers when 0,
+	// so entries cached before a User change are not read after a deployment
+	SchemaVersion int
+	// Codec encodes the cached users, the codec package handler when nil,
+	// keys of a codec other than JSON are suffixed by its name so encodings are never mixed up
+	Codec codec.Handler
+}
+
+// DefaultCachePolicy gets the policy UserService falls back to
+func DefaultCachePolicy() CachePolicy {
+	return CachePolicy{
+		Ttl:           CacheTtlActiveUserByType,
+		KeyPrefix:     CacheKeyPrefixActiveUsers,
+		SchemaVersion: CacheSchemaVersionUsers,
+	}
+}
+
+func (cp CachePolicy) Validate() error {
+	var errs []error
+	if cp.Ttl < 0 {
+		errs = append(errs, errors.New("cache ttl should be positive"))
+	}
+	for userType, ttl := range cp.TtlByUserType {
+		if ttl <= 0 {
+			errs = append(errs, fmt.Errorf("cache ttl of user type %s should be positive", userType))
+		}
+	}
+	if cp.SoftTtl < 0 {
+		errs = append(errs, errors.New("cache soft ttl should be positive"))
+	}
+	if cp.SoftTtl > 0 && cp.SoftTtl >= cp.shortestTtl() {
+		errs = append(errs, errors.New("cache soft ttl should be shorter than the cache ttl"))
+	}
+	if cp.SchemaVersion < 0 {
+		errs = append(errs, errors.New("cache schema version should be positive"))
+	}
+	return errors.Join(errs...)
+}
+
+// ttl gets how long users of audience are cached
+func (cp CachePolicy) ttl(audience AudienceFilter) time.Duration {
+	ttl := cp.Ttl
+	if ttl <= 0 {
+		ttl = CacheTtlActiveUserByType
+	}
+
+	var shortest time.Duration
+	for _, userType := range audience.UserTypes {
+		typeTtl, ok := cp.TtlByUserType[userType]
+		if !ok {
+			typeTtl = ttl
+		}
+		if shortest == 0 || typeTtl < shortest {
+			shortest = typeTtl
+		}
+	}
+	if shortest == 0 {
+		return ttl
+	}
+	return shortest
+}
+
+// shortestTtl gets the shortest ttl users of any type are cached for
+func (cp CachePolicy) shortestTtl() time.Duration {
+	shortest := cp.Ttl
+	if shortest <= 0 {
+		shortest = CacheTtlActiveUserByType
+	}
+	for _, ttl := range cp.TtlByUserType {
+		if ttl > 0 && ttl < shortest {
+			shortest = ttl
+		}
+	}
+	return shortest
+}
+
+// longestTtl gets the longest ttl users of any type are cached for
+func (cp CachePolicy) longestTtl() time.Duration {
+	longest := cp.Ttl
+	if longest <= 0 {
+		longest = CacheTtlActiveUserByType
+	}
+	for _, ttl := range cp.TtlByUserType {
+		if ttl > longest {
+			longest = ttl
+		}
+	}
+	return longest
+}
+
+// isStale reports whether users cached at cachedAt should be refreshed at now,
+// users cached without their time are never stale
+func (cp CachePolicy) isStale(cachedAt time.Time, now time.Time) bool {
+	return cp.SoftTtl > 0 && !cachedAt.IsZero() && now.Sub(cachedAt) >= cp.SoftTtl
+}
+
+// keyPrefix gets KeyPrefix followed by the schema version and the codec when not JSON, e.g. users:v2 or users:v2:gob
+func (cp CachePolicy) keyPrefix() string {
+	prefix := cp.KeyPrefix
+	if prefix == "" {
+		prefix = CacheKeyPrefixActiveUsers
+	}
+	version := cp.SchemaVersion
+	if version <= 0 {
+		version = CacheSchemaVersionUsers
+	}
+	prefix = fmt.Sprintf(CacheKeyVersionedPrefixFmt, prefix, version)
+	if name := cp.codec().Name(); name != codec.NameJson {
+		prefix = fmt.Sprintf(CacheKeyCodecPrefixFmt, prefix, name)
+	}
+	return prefix
+}
+
+// codec gets Codec, falling back to the codec package handler when not set
+func (cp CachePolicy) codec() codec.Handler {
+	if cp.Codec == nil {
+		return defaultCodec{}
+	}
+	return cp.Codec
+}
+
+// keyByType gets the cache key of active users of userType
+func (cp CachePolicy) keyByType(userType UserType) string {
+	return fmt.Sprintf(CacheKeyActiveUsersByTypeFmt, cp.keyPrefix(), userType)
+}
+
+// key gets the same key as keyByType for a single type audience, other audiences are keyed by a hash
+// of their canonical representation and of the generations of generationTypes, in the same order,
+// so an invalidation of one of their types on any instance moves them to a new key
+func (cp CachePolicy) key(audience AudienceFilter, generations []string) string {
+	if audience.isSingleType() {
+		return cp.keyByType(audience.UserTypes[0])
+	}
+	canonical := audience.canonical()
+	if strings.Join(generations, "") != "" {
+		canonical += ";generations=" + strings.Join(generations, ",")
+	}
+	return fmt.Sprintf(CacheKeyActiveUsersByAudienceFmt, cp.keyPrefix(), sha1.Sum([]byte(canonical)))
+}
+
+// anyUserType is the generation of the audiences without user types, bumped along with every user type
+const anyUserType UserType = "*"
+
+// generationKey gets the cache key holding the generation of userType, shared by every instance
+func (cp CachePolicy) generationKey(userType UserType) string {
+	return fmt.Sprintf(CacheKeyGenerationFmt, cp.keyPrefix(), userType)
+}
+
+// generationTypes gets the user types whose generations key audience, sorted,
+// an audience without user types caches users of any type
+func generationTypes(audience AudienceFilter) []UserType {
+	if len(audience.UserTypes) == 0 {
+		return []UserType{anyUserType}
+	}
+	userTypes := append([]UserType(nil), audience.UserTypes...)
+	sort.Slice(userTypes, func(i, j int) bool { return userTypes[i] < userTypes[j] })
+	unique := userTypes[:0]
+	for i, userType := range userTypes {
+		if i == 0 || userType != userTypes[i-1] {
+			unique = append(unique, userType)
+		}
+	}
+	return unique
+}
+
+// newCacheGeneration gets a generation different from the previous ones of any instance
+func newCacheGeneration() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+// refreshSet tracks the cache keys being refreshed so a key is refreshed once at a time
+type refreshSet struct {
+	mu   sync.Mutex
+	keys map[string]struct{}
+}
+
+// start reports whether key can be refreshed, false when it is already being refreshed
+func (rs *refreshSet) start(key string) bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if _, ok := rs.keys[key]; ok {
+		return false
+	}
+	if rs.keys == nil {
+		rs.keys = make(map[string]struct{})
+	}
+	rs.keys[key] = struct{}{}
+	return true
+}
+
+func (rs *refreshSet) done(key string) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	delete(rs.keys, key)
+}
+
+// cacheGenerations counts the invalidations of each cache key, users loaded before an invalidation
+// are not cached after it
+type cacheGenerations struct {
+	mu          sync.Mutex
+	generations map[string]uint64
+}
+
+// get gets the number of invalidations of key
+func (cg *cacheGenerations) get(key string) uint64 {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	return cg.generations[key]
+}
+
+func (cg *cacheGenerations) bump(key string) {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	if cg.generations == nil {
+		cg.generations = make(map[string]uint64)
+	}
+	cg.generations[key]++
+}
+
+// defaultCodec delegates to the codec package handler at each call, so codec.SetHandler applies to a policy without Codec
+type defaultCodec struct{}
+
+func (dc defaultCodec) Marshal(data interface{}) ([]byte, error) {
+	return codec.Marshal(data)
+}
+
+func (dc defaultCodec) Unmarshal(bytesData []byte, result interface{}) error {
+	return codec.Unmarshal(bytesData, result)
+}
+
+func (dc defaultCodec) Name() string {
+	return codec.Name()
+}
+
+// cachedUsers is cached instead of the bare users list when the time they were cached at is needed
+// or the codec is not JSON
+type cachedUsers struct {
+	CachedAt time.Time `json:"cached_at"`
+	Users    []User    `json:"users"`
+}
+
+// encodeCachedUsers encodes users as a bare JSON list, or along with now when withTime is set or handler is not JSON
+func encodeCachedUsers(handler codec.Handler, users []User, withTime bool, now time.Time) ([]byte, error) {
+	if !withTime && handler.Name() == codec.NameJson {
+		return handler.Marshal(users)
+	}
+	return handler.Marshal(cachedUsers{CachedAt: now, Users: users})
+}
+
+// decodeCachedUsers decodes users cached by encodeCachedUsers in either form, cachedAt is zero for a bare list
+func decodeCachedUsers(handler codec.Handler, data string) (users []User, cachedAt time.Time, err error) {
+	if handler.Name() != codec.NameJson || bytes.HasPrefix(bytes.TrimSpace([]byte(data)), []byte("{")) {
+		var cached cachedUsers
+		if err = handler.Unmarshal([]byte(data), &cached); err != nil {
+			return nil, time.Time{}, err
+		}
+		return cached.Users, cached.CachedAt, nil
+	}
+	if err = handler.Unmarshal([]byte(data), &users); err != nil {
+		return nil, time.Time{}, err
+	}
+	return users, time.Time{}, nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/practice/sharing/util/codec"
+)
+
+func TestCachePolicy_ttl(t *testing.T) {
+	cachePolicy := CachePolicy{
+		Ttl: 5 * time.Minute,
+		TtlByUserType: map[UserType]time.Duration{
+			UserTypePremium: 30 * time.Second,
+			UserTypeTrial:   10 * time.Minute,
+		},
+	}
+
+	tests := []struct {
+		name        string
+		cachePolicy CachePolicy
+		audience    AudienceFilter
+		want        time.Duration
+	}{
+		{
+			name:     "zero policy, default ttl",
+			audience: AudienceFilter{UserTypes: []UserType{UserTypePremium}},
+			want:     CacheTtlActiveUserByType,
+		},
+		{
+			name:        "user type ttl",
+			cachePolicy: cachePolicy,
+			audience:    AudienceFilter{UserTypes: []UserType{UserTypeTrial}},
+			want:        10 * time.Minute,
+		},
+		{
+			name:        "user type without ttl, policy ttl",
+			cachePolicy: cachePolicy,
+			audience:    AudienceFilter{UserTypes: []UserType{UserTypeBasic}},
+			want:        5 * time.Minute,
+		},
+		{
+			name:        "several user types, shortest ttl",
+			cachePolicy: cachePolicy,
+			audience:    AudienceFilter{UserTypes: []UserType{UserTypeTrial, UserTypeBasic, UserTypePremium}},
+			want:        30 * time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cachePolicy.ttl(tt.audience); got != tt.want {
+				t.Errorf("ttl() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCachePolicy_key(t *testing.T) {
+	premium := AudienceFilter{UserTypes: []UserType{UserTypePremium}}
+	audience := AudienceFilter{UserTypes: []UserType{UserTypePremium, UserTypeBasic}}
+
+	if got, want := (CachePolicy{}).key(premium, nil), "users:v2:premium"; got != want {
+		t.Errorf("key() got = %v, want %v", got, want)
+	}
+	if got, want := (CachePolicy{KeyPrefix: "sharing", SchemaVersion: 2}).key(premium, nil), "sharing:v2:premium"; got != want {
+		t.Errorf("key() got = %v, want %v", got, want)
+	}
+	if got := (CachePolicy{}).key(audience, nil); !strings.HasPrefix(got, "users:v2:audience:") {
+		t.Errorf("key() got = %v, want it prefixed by users:v2:audience:", got)
+	}
+	if got, want := (CachePolicy{Codec: codec.Compress(codec.Gob(), 0)}).key(premium, nil), "users:v2:gob+gzip:premium"; got != want {
+		t.Errorf("key() got = %v, want %v", got, want)
+	}
+	if (CachePolicy{SchemaVersion: 1}).key(audience, nil) == (CachePolicy{SchemaVersion: 2}).key(audience, nil) {
+		t.Errorf("key() should differ between schema versions")
+	}
+	if (CachePolicy{}).key(audience, []string{"", ""}) != (CachePolicy{}).key(audience, nil) {
+		t.Errorf("key() should not change with empty generations")
+	}
+	if (CachePolicy{}).key(audience, []string{"a", ""}) == (CachePolicy{}).key(audience, []string{"b", ""}) {
+		t.Errorf("key() should differ between generations")
+	}
+}
+
+func TestCachePolicy_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		cachePolicy CachePolicy
+		wantErrs    []string
+	}{
+		{name: "Validate success, zero policy"},
+		{name: "Validate success, default policy", cachePolicy: DefaultCachePolicy()},
+		{
+			name: "Validate failed, every value invalid",
+			cachePolicy: CachePolicy{
+				Ttl:           -time.Minute,
+				TtlByUserType: map[UserType]time.Duration{UserTypePremium: 0},
+				SoftTtl:       -time.Second,
+				SchemaVersion: -1,
+			},
+			wantErrs: []string{
+				"cache ttl should be positive",
+				"cache ttl of user type premium should be positive",
+				"cache soft ttl should be positive",
+				"cache schema version should be positive",
+			},
+		},
+		{
+			name: "Validate failed, soft ttl not shorter than a user type ttl",
+			cachePolicy: CachePolicy{
+				Ttl:           5 * time.Minute,
+				TtlByUserType: map[UserType]time.Duration{UserTypePremium: 30 * time.Second},
+				SoftTtl:       time.Minute,
+			},
+			wantErrs: []string{"cache soft ttl should be shorter than the cache ttl"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cachePolicy.Validate()
+			if len(tt.wantErrs) == 0 {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Errorf("Validate() error = nil, wantErrs %v", tt.wantErrs)
+				return
+			}
+			for _, wantErr := range tt.wantErrs {
+				if !strings.Contains(err.Error(), wantErr) {
+					t.Errorf("Validate() error = %v, want it to contain %v", err, wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestCachePolicy_isStale(t *testing.T) {
+	cachedAt := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		cachePolicy CachePolicy
+		cachedAt    time.Time
+		now         time.Time
+		want        bool
+	}{
+		{name: "no soft ttl", cachedAt: cachedAt, now: cachedAt.Add(time.Hour)},
+		{name: "fresh", cachePolicy: CachePolicy{SoftTtl: time.Minute}, cachedAt: cachedAt, now: cachedAt.Add(59 * time.Second)},
+		{name: "stale", cachePolicy: CachePolicy{SoftTtl: time.Minute}, cachedAt: cachedAt, now: cachedAt.Add(time.Minute), want: true},
+		{name: "cached without time", cachePolicy: CachePolicy{SoftTtl: time.Minute}, now: cachedAt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cachePolicy.isStale(tt.cachedAt, tt.now); got != tt.want {
+				t.Errorf("isStale() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_decodeCachedUsers(t *testing.T) {
+	cachedAt := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	users := []User{{Id: 1, Type: UserTypePremium}}
+
+	for _, handler := range []codec.Handler{codec.Default(), codec.Gob(), codec.Compress(codec.Gob(), 16)} {
+		for _, withTime := range []bool{false, true} {
+			bytesData, err := encodeCachedUsers(handler, users, withTime, cachedAt)
+			if err != nil {
+				t.Fatalf("encodeCachedUsers() %s error = %v", handler.Name(), err)
+			}
+			gotUsers, gotCachedAt, err := decodeCachedUsers(handler, string(bytesData))
+			if err != nil {
+				t.Fatalf("decodeCachedUsers() %s error = %v", handler.Name(), err)
+			}
+			wantCachedAt := time.Time{}
+			if withTime || handler.Name() != codec.NameJson {
+				wantCachedAt = cachedAt
+			}
+			if !reflect.DeepEqual(gotUsers, users) || !gotCachedAt.Equal(wantCachedAt) {
+				t.Errorf("decodeCachedUsers() %s got = %v, %v, want %v, %v", handler.Name(), gotUsers, gotCachedAt, users, wantCachedAt)
+			}
+		}
+	}
+
+	if _, _, err := decodeCachedUsers(codec.Default(), `{"users": 1}`); err == nil {
+		t.Errorf("decodeCachedUsers() error = nil, want error")
+	}
+}
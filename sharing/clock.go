@@ -0,0 +1,14 @@
+package main
+
+import "time"
+
+type systemClock struct{}
+
+// SystemClock is a Clock reading the current system time
+func SystemClock() Clock {
+	return &systemClock{}
+}
+
+func (sc *systemClock) Now() time.Time {
+	return time.Now()
+}
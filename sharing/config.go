@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/practice/sharing/util/codec"
+	"github.com/practice/sharing/util/json"
+	"github.com/practice/sharing/util/validator"
+)
+
+// EnvPrefix prefixes every environment variable overriding the config, e.g. SHARING_CACHE_TTL
+const EnvPrefix = "SHARING_"
+
+// Config holds every setting of UserService and Scheduler, loaded by LoadConfig
+type Config struct {
+	Cache        CacheConfig        `json:"cache"`
+	Notification NotificationConfig `json:"notification"`
+	Storage      StorageConfig      `json:"storage"`
+	// UserTypes are known in addition to the built in user types
+	UserTypes []UserType `json:"user_types"`
+}
+
+type CacheConfig struct {
+	Ttl           Duration              `json:"ttl"`
+	TtlByUserType map[UserType]Duration `json:"ttl_by_user_type"`
+	// SoftTtl serves stale users while refreshing them after it, disabled when 0
+	SoftTtl   Duration `json:"soft_ttl"`
+	KeyPrefix string   `json:"key_prefix"`
+	// Codec encodes the cached users, json or gob, the codec package handler when empty
+	Codec string `json:"codec"`
+	// CompressThreshold compresses the cached users larger than this many bytes, disabled when 0
+	CompressThreshold int `json:"compress_threshold"`
+}
+
+type NotificationConfig struct {
+	EmailScoreThreshold int `json:"email_score_threshold"`
+	Concurrency         int `json:"concurrency"`
+	// QuietHours holds phone notifications during the user quiet hours, disabled when nil
+	QuietHours *QuietHours `json:"quiet_hours"`
+	// Contact checks the user contact before notifying, disabled when nil
+	Contact *ContactPolicy `json:"contact"`
+}
+
+// StorageConfig holds the paths of the file repositories, a repository is not used when its path is empty
+type StorageConfig struct {
+	DeliveryLogPath string `json:"delivery_log_path"`
+	SchedulePath    string `json:"schedule_path"`
+	ConsentPath     string `json:"consent_path"`
+}
+
+// Duration is a time.Duration written as a string such as "1m30s" in config files
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(bytesData []byte) (err error) {
+	var text string
+	if err = json.Unmarshal(bytesData, &text); err != nil {
+		return fmt.Errorf("duration should be a string such as 1m30s")
+	}
+	parsed, err := time.ParseDuration(text)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// policy gets the cache policy of the config, versioned by CacheSchemaVersionUsers
+func (cc CacheConfig) policy() CachePolicy {
+	cachePolicy := CachePolicy{
+		Ttl:           time.Duration(cc.Ttl),
+		SoftTtl:       time.Duration(cc.SoftTtl),
+		KeyPrefix:     cc.KeyPrefix,
+		SchemaVersion: CacheSchemaVersionUsers,
+		Codec:         cc.codec(),
+	}
+	for userType, ttl := range cc.TtlByUserType {
+		if cachePolicy.TtlByUserType == nil {
+			cachePolicy.TtlByUserType = make(map[UserType]time.Duration, len(cc.TtlByUserType))
+		}
+		cachePolicy.TtlByUserType[userType] = time.Duration(ttl)
+	}
+	return cachePolicy
+}
+
+// codec gets the cache codec named by Codec, compressed above CompressThreshold,
+// nil to fall back to the codec package handler when neither is set
+func (cc CacheConfig) codec() codec.Handler {
+	var handler codec.Handler
+	switch cc.Codec {
+	case codec.NameJson:
+		handler = codec.Default()
+	case codec.NameGob:
+		handler = codec.Gob()
+	}
+	if cc.CompressThreshold <= 0 {
+		return handler
+	}
+	if handler == nil {
+		handler = codec.Default()
+	}
+	return codec.Compress(handler, cc.CompressThreshold)
+}
+
+// DefaultConfig gets the config matching the constants UserService falls back to
+func DefaultConfig() Config {
+	return Config{
+		Cache: CacheConfig{
+			Ttl:       Duration(CacheTtlActiveUserByType),
+			KeyPrefix: CacheKeyPrefixActiveUsers,
+		},
+		Notification: NotificationConfig{
+			EmailScoreThreshold: EmailScoreThreshold,
+			Concurrency:         1,
+		},
+	}
+}
+
+// LoadConfig loads DefaultConfig overridden by the JSON file at path, when not empty,
+// then by the environment variables prefixed by EnvPrefix
+func LoadConfig(path string) (config Config, err error) {
+	return loadConfig(path, os.LookupEnv)
+}
+
+func loadConfig(path string, lookupEnv func(key string) (string, bool)) (config Config, err error) {
+	config = DefaultConfig()
+	if path != "" {
+		if err = config.loadFile(path); err != nil {
+			return Config{}, err
+		}
+	}
+	if err = config.loadEnv(lookupEnv); err != nil {
+		return Config{}, err
+	}
+
+	if err = validator.Validate(config); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+func (c *Config) loadFile(path string) (err error) {
+	bytesData, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if strings.ToLower(filepath.Ext(path)) != ".json" {
+		return fmt.Errorf("%s: config file should be .json", path)
+	}
+
+	if len(bytes.TrimSpace(bytesData)) == 0 {
+		return nil
+	}
+	if err = json.Unmarshal(bytesData, c); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// loadEnv overrides the config with every environment variable set, e.g. SHARING_NOTIFICATION_CONCURRENCY=8
+func (c *Config) loadEnv(lookupEnv func(key string) (string, bool)) (err error) {
+	setters := map[string]func(value string) error{
+		"CACHE_TTL": func(value string) error {
+			ttl, err := time.ParseDuration(value)
+			c.Cache.Ttl = Duration(ttl)
+			return err
+		},
+		"CACHE_SOFT_TTL": func(value string) error {
+			softTtl, err := time.ParseDuration(value)
+			c.Cache.SoftTtl = Duration(softTtl)
+			return err
+		},
+		"CACHE_CODEC": func(value string) error {
+			c.Cache.Codec = value
+			return nil
+		},
+		"CACHE_COMPRESS_THRESHOLD": func(value string) (err error) {
+			c.Cache.CompressThreshold, err = strconv.Atoi(value)
+			return err
+		},
+		"CACHE_KEY_PREFIX": func(value string) error {
+			c.Cache.KeyPrefix = value
+			return nil
+		},
+		"NOTIFICATION_EMAIL_SCORE_THRESHOLD": func(value string) (err error) {
+			c.Notification.EmailScoreThreshold, err = strconv.Atoi(value)
+			return err
+		},
+		"NOTIFICATION_CONCURRENCY": func(value string) (err error) {
+			c.Notification.Concurrency, err = strconv.Atoi(value)
+			return err
+		},
+		"NOTIFICATION_QUIET_HOURS": func(value string) error {
+			quietHours, err := parseQuietHours(value)
+			c.Notification.QuietHours = quietHours
+			return err
+		},
+		"NOTIFICATION_CONTACT_DEFAULT_COUNTRY_CODE": func(value string) error {
+			if c.Notification.Contact == nil {
+				c.Notification.Contact = &ContactPolicy{NormalizePhoneNumber: true}
+			}
+			c.Notification.Contact.DefaultCountryCode = value
+			return nil
+		},
+		"STORAGE_DELIVERY_LOG_PATH": func(value string) error {
+			c.Storage.DeliveryLogPath = value
+			return nil
+		},
+		"STORAGE_SCHEDULE_PATH": func(value string) error {
+			c.Storage.SchedulePath = value
+			return nil
+		},
+		"STORAGE_CONSENT_PATH": func(value string) error {
+			c.Storage.ConsentPath = value
+			return nil
+		},
+		"USER_TYPES": func(value string) error {
+			c.UserTypes = nil
+			for _, userType := range strings.Split(value, ",") {
+				if userType = strings.TrimSpace(userType); userType != "" {
+					c.UserTypes = append(c.UserTypes, UserType(userType))
+				}
+			}
+			return nil
+		},
+	}
+
+	for name, set := range setters {
+		value, ok := lookupEnv(EnvPrefix + name)
+		if !ok {
+			continue
+		}
+		if err = set(value); err != nil {
+			return fmt.Errorf("%s%s: %w", EnvPrefix, name, err)
+		}
+	}
+	return nil
+}
+
+// parseQuietHours parses quiet hours written as start-end/action, e.g. 21-8/defer, empty disables them
+func parseQuietHours(value string) (*QuietHours, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	hours, action, _ := strings.Cut(value, "/")
+	start, end, ok := strings.Cut(hours, "-")
+	if !ok {
+		return nil, fmt.Errorf("quiet hours should be written as start-end/action, e.g. 21-8/defer")
+	}
+	startHour, errStart := strconv.Atoi(start)
+	endHour, errEnd := strconv.Atoi(end)
+	if errStart != nil || errEnd != nil {
+		return nil, fmt.Errorf("quiet hours should be written as start-end/action, e.g. 21-8/defer")
+	}
+	if action == "" {
+		action = QuietHoursActionDefer
+	}
+	return &QuietHours{StartHour: startHour, EndHour: endHour, Action: action}, nil
+}
+
+func (c Config) Validate() error {
+	violations := validator.NewViolations()
+	if c.Cache.Ttl <= 0 {
+		violations.Add("cache.ttl", validator.RulePositive, "cache ttl should be positive")
+	}
+
+	for userType, ttl := range c.Cache.TtlByUserType {
+		if ttl <= 0 {
+			violations.Add("cache.ttl_by_user_type."+string(userType), validator.RulePositive, "cache ttl of user type "+string(userType)+" should be positive")
+		}
+	}
+
+	if c.Cache.SoftTtl < 0 || (c.Cache.SoftTtl > 0 && time.Duration(c.Cache.SoftTtl) >= c.Cache.policy().shortestTtl()) {
+		violations.Add("cache.soft_ttl", validator.RuleRange, "cache soft ttl should be positive and shorter than the cache ttl")
+	}
+
+	if c.Cache.KeyPrefix == "" {
+		violations.Add("cache.key_prefix", validator.RuleRequired, "cache key prefix should not be empty")
+	}
+
+	if c.Cache.Codec != "" && c.Cache.Codec != codec.NameJson && c.Cache.Codec != codec.NameGob {
+		violations.Add("cache.codec", validator.RuleOneOf, "cache codec should be json or gob")
+	}
+
+	if c.Cache.CompressThreshold < 0 {
+		violations.Add("cache.compress_threshold", validator.RulePositive, "cache compress threshold should be positive")
+	}
+
+	if c.Notification.Concurrency < 1 {
+		violations.Add("notification.concurrency", validator.RulePositive, "notification concurrency should be positive")
+	}
+
+	if c.Notification.QuietHours != nil {
+		if err := c.Notification.QuietHours.Validate(); err != nil {
+			violations.Add("notification.quiet_hours", validator.RuleRange, err.Error())
+		}
+	}
+
+	if c.Notification.Contact != nil {
+		if err := c.Notification.Contact.Validate(); err != nil {
+			violations.Add("notification.contact.default_country_code", validator.RuleRange, err.Error())
+		}
+	}
+
+	for _, userType := range c.UserTypes {
+		if userType == "" {
+			violations.Add("user_types", validator.RuleRequired, "user types should not be empty")
+			break
+		}
+	}
+
+	return violations.Err()
+}
+
+// NewUserService wires a UserService with the config, the file repositories of Storage and opts,
+// opts are applied last so they override the config
+func (c Config) NewUserService(userRepository UserRepository, cacheRepository CacheRepository, emailNotifier Notifier, phoneNotifier Notifier, opts ...UserServiceOption) (*UserService, error) {
+	configOpts := []UserServiceOption{
+		WithNotifiers(emailNotifier, phoneNotifier),
+		WithCachePolicy(c.Cache.policy()),
+		WithEmailScoreThreshold(c.Notification.EmailScoreThreshold),
+		WithConcurrency(c.Notification.Concurrency),
+	}
+	if len(c.UserTypes) > 0 {
+		registry := DefaultUserTypeRegistry()
+		registry.Register(c.UserTypes...)
+		configOpts = append(configOpts, WithUserTypeRegistry(registry))
+	}
+	if c.Notification.QuietHours != nil {
+		configOpts = append(configOpts, WithQuietHours(*c.Notification.QuietHours, NewMemoryNotificationQueue()))
+	}
+	if c.Notification.Contact != nil {
+		configOpts = append(configOpts, WithContactPolicy(*c.Notification.Contact))
+	}
+	if c.Storage.DeliveryLogPath != "" {
+		deliveryLogRepository, err := NewFileDeliveryLogRepository(c.Storage.DeliveryLogPath)
+		if err != nil {
+			return nil, err
+		}
+		configOpts = append(configOpts, WithDeliveryLogRepository(deliveryLogRepository))
+	}
+	if c.Storage.ConsentPath != "" {
+		consentRepository, err := NewFileConsentRepository(c.Storage.ConsentPath)
+		if err != nil {
+			return nil, err
+		}
+		configOpts = append(configOpts, WithConsentRepository(consentRepository))
+	}
+
+	return NewUserService(userRepository, cacheRepository, append(configOpts, opts...)...)
+}
+
+// NewScheduler wires a Scheduler of userService storing its schedules at Storage.SchedulePath
+func (c Config) NewScheduler(userService *UserService, clock Clock) (*Scheduler, error) {
+	if c.Storage.SchedulePath == "" {
+		return nil, fmt.Errorf("storage schedule path is required to schedule")
+	}
+	return NewScheduler(userService, NewFileScheduleRepository(c.Storage.SchedulePath), clock), nil
+}
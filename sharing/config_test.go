@@ -0,0 +1,272 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/practice/sharing/util/codec"
+)
+
+func Test_loadConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name string, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	fullPath := writeFile("full.json", `{
+  "cache": {
+    "ttl": "5m",
+    "ttl_by_user_type": {"premium": "30s"},
+    "key_prefix": "users"
+  },
+  "notification": {
+    "email_score_threshold": 70,
+    "concurrency": 8,
+    "quiet_hours": {"start_hour": 21, "end_hour": 8, "action": "defer"},
+    "contact": {"normalize_phone_number": true, "default_country_code": "62"}
+  },
+  "storage": {"delivery_log_path": "/var/lib/sharing/delivery_logs.jsonl"},
+  "user_types": ["VIP"]
+}`)
+	jsonPath := writeFile("config.json", `{"cache": {"ttl": "30s"}, "user_types": ["VIP"]}`)
+	invalidPath := writeFile("invalid.json", `{"notification": {"concurrency": 0}}`)
+	yamlPath := writeFile("config.yaml", "cache:\n  ttl: 5m\n")
+
+	tests := []struct {
+		name    string
+		path    string
+		env     map[string]string
+		want    Config
+		wantErr string
+	}{
+		{
+			name: "loadConfig success, defaults",
+			want: DefaultConfig(),
+		},
+		{
+			name: "loadConfig success, json",
+			path: fullPath,
+			want: Config{
+				Cache: CacheConfig{
+					Ttl:           Duration(5 * time.Minute),
+					TtlByUserType: map[UserType]Duration{UserTypePremium: Duration(30 * time.Second)},
+					KeyPrefix:     "users",
+				},
+				Notification: NotificationConfig{
+					EmailScoreThreshold: 70,
+					Concurrency:         8,
+					QuietHours:          &QuietHours{StartHour: 21, EndHour: 8, Action: QuietHoursActionDefer},
+					Contact:             &ContactPolicy{NormalizePhoneNumber: true, DefaultCountryCode: "62"},
+				},
+				Storage:   StorageConfig{DeliveryLogPath: "/var/lib/sharing/delivery_logs.jsonl"},
+				UserTypes: []UserType{"VIP"},
+			},
+		},
+		{
+			name: "loadConfig success, json keeps defaults of missing values",
+			path: jsonPath,
+			want: Config{
+				Cache:        CacheConfig{Ttl: Duration(30 * time.Second), KeyPrefix: CacheKeyPrefixActiveUsers},
+				Notification: NotificationConfig{EmailScoreThreshold: EmailScoreThreshold, Concurrency: 1},
+				UserTypes:    []UserType{"VIP"},
+			},
+		},
+		{
+			name: "loadConfig success, env overrides file",
+			path: jsonPath,
+			env: map[string]string{
+				"SHARING_CACHE_TTL":                                 "2m",
+				"SHARING_CACHE_SOFT_TTL":                            "30s",
+				"SHARING_NOTIFICATION_CONCURRENCY":                  "4",
+				"SHARING_NOTIFICATION_QUIET_HOURS":                  "22-6/skip",
+				"SHARING_NOTIFICATION_CONTACT_DEFAULT_COUNTRY_CODE": "62",
+				"SHARING_STORAGE_SCHEDULE_PATH":                     "schedules.jsonl",
+				"SHARING_USER_TYPES":                                "VIP, PARTNER",
+			},
+			want: Config{
+				Cache: CacheConfig{Ttl: Duration(2 * time.Minute), SoftTtl: Duration(30 * time.Second), KeyPrefix: CacheKeyPrefixActiveUsers},
+				Notification: NotificationConfig{
+					EmailScoreThreshold: EmailScoreThreshold,
+					Concurrency:         4,
+					QuietHours:          &QuietHours{StartHour: 22, EndHour: 6, Action: QuietHoursActionSkip},
+					Contact:             &ContactPolicy{NormalizePhoneNumber: true, DefaultCountryCode: "62"},
+				},
+				Storage:   StorageConfig{SchedulePath: "schedules.jsonl"},
+				UserTypes: []UserType{"VIP", "PARTNER"},
+			},
+		},
+		{
+			name:    "loadConfig failed, file not found",
+			path:    filepath.Join(dir, "missing.json"),
+			wantErr: "no such file",
+		},
+		{
+			name:    "loadConfig failed, yaml is not supported",
+			path:    yamlPath,
+			wantErr: "config file should be .json",
+		},
+		{
+			name:    "loadConfig failed, invalid file value",
+			path:    invalidPath,
+			wantErr: "notification concurrency should be positive",
+		},
+		{
+			name:    "loadConfig failed, invalid env value",
+			env:     map[string]string{"SHARING_CACHE_TTL": "soon"},
+			wantErr: "SHARING_CACHE_TTL",
+		},
+		{
+			name:    "loadConfig failed, invalid env quiet hours",
+			env:     map[string]string{"SHARING_NOTIFICATION_QUIET_HOURS": "night"},
+			wantErr: "quiet hours should be written as start-end/action",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookupEnv := func(key string) (string, bool) {
+				value, ok := tt.env[key]
+				return value, ok
+			}
+			got, err := loadConfig(tt.path, lookupEnv)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("loadConfig() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("loadConfig() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadConfig() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		modify   func(config *Config)
+		wantErrs []string
+	}{
+		{
+			name:   "Validate success, defaults",
+			modify: func(config *Config) {},
+		},
+		{
+			name: "Validate failed, every value invalid",
+			modify: func(config *Config) {
+				config.Cache.Ttl = 0
+				config.Cache.KeyPrefix = ""
+				config.Cache.SoftTtl = Duration(time.Hour)
+				config.Cache.Codec = "msgpack"
+				config.Cache.CompressThreshold = -1
+				config.Notification.Concurrency = 0
+				config.Notification.QuietHours = &QuietHours{StartHour: 24, Action: QuietHoursActionDefer}
+				config.Notification.Contact = &ContactPolicy{DefaultCountryCode: "+62"}
+				config.UserTypes = []UserType{""}
+			},
+			wantErrs: []string{
+				"cache ttl should be positive",
+				"cache key prefix should not be empty",
+				"cache soft ttl should be positive and shorter than the cache ttl",
+				"cache codec should be json or gob",
+				"cache compress threshold should be positive",
+				"notification concurrency should be positive",
+				"quiet hours start hour should be between 0 and 23",
+				"contact policy default country code should be 1 to 3 digits",
+				"user types should not be empty",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			tt.modify(&config)
+			err := config.Validate()
+			if len(tt.wantErrs) == 0 {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Errorf("Validate() error = nil, wantErrs %v", tt.wantErrs)
+				return
+			}
+			for _, wantErr := range tt.wantErrs {
+				if !strings.Contains(err.Error(), wantErr) {
+					t.Errorf("Validate() error = %v, want it to contain %v", err, wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestConfig_NewUserService(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	userRepository := NewMockUserRepository(ctrl)
+	cacheRepository := NewMockCacheRepository(ctrl)
+	notifier := NewMockNotifier(ctrl)
+
+	config := DefaultConfig()
+	config.Cache.Ttl = Duration(5 * time.Minute)
+	config.Cache.TtlByUserType = map[UserType]Duration{UserTypePremium: Duration(30 * time.Second)}
+	config.Cache.KeyPrefix = "sharing"
+	config.Cache.Codec = codec.NameGob
+	config.Notification.EmailScoreThreshold = 70
+	config.Notification.Concurrency = 8
+	config.Notification.QuietHours = &QuietHours{StartHour: 21, EndHour: 8, Action: QuietHoursActionDefer}
+	config.Notification.Contact = &ContactPolicy{NormalizePhoneNumber: true, DefaultCountryCode: "62"}
+	config.Storage.DeliveryLogPath = filepath.Join(t.TempDir(), "delivery_logs.jsonl")
+	config.Storage.SchedulePath = filepath.Join(t.TempDir(), "schedules.jsonl")
+	config.UserTypes = []UserType{"VIP"}
+
+	us, err := config.NewUserService(userRepository, cacheRepository, notifier, notifier, WithConcurrency(2))
+	if err != nil {
+		t.Fatalf("NewUserService() error = %v", err)
+	}
+	wantCachePolicy := CachePolicy{
+		Ttl:           5 * time.Minute,
+		TtlByUserType: map[UserType]time.Duration{UserTypePremium: 30 * time.Second},
+		KeyPrefix:     "sharing",
+		SchemaVersion: CacheSchemaVersionUsers,
+		Codec:         codec.Gob(),
+	}
+	if !reflect.DeepEqual(us.cachePolicy, wantCachePolicy) || us.getEmailScoreThreshold() != 70 {
+		t.Errorf("NewUserService() cache policy = %+v, email score threshold = %v", us.cachePolicy, us.getEmailScoreThreshold())
+	}
+	if us.concurrency != 2 {
+		t.Errorf("NewUserService() concurrency = %v, want the option to override the config", us.concurrency)
+	}
+	if us.quietHours == nil || us.notificationQueue == nil || us.contactPolicy == nil || us.deliveryLogRepository == nil {
+		t.Errorf("NewUserService() quiet hours, notification queue, contact policy and delivery log repository should be set")
+	}
+	if us.consentRepository != nil {
+		t.Errorf("NewUserService() consent repository should not be set without a path")
+	}
+	if !us.getUserTypeRegistry().IsKnown("VIP") || !us.getUserTypeRegistry().IsKnown(UserTypePremium) {
+		t.Errorf("NewUserService() user type registry should know the configured and built in user types")
+	}
+
+	if _, err = config.NewScheduler(us, nil); err != nil {
+		t.Errorf("NewScheduler() error = %v", err)
+	}
+	config.Storage.SchedulePath = ""
+	if _, err = config.NewScheduler(us, nil); err == nil {
+		t.Errorf("NewScheduler() error = nil, want schedule path required")
+	}
+}
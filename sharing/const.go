@@ -1,17 +1,125 @@
 package main
 
 import (
-	"fmt"
 	"time"
+
+	"github.com/practice/sharing/util/custerror"
+)
+
+const (
+	NotificationChannelEmail = "email"
+	NotificationChannelPhone = "phone"
+
+	DeliveryStatusSent           = "sent"
+	DeliveryStatusFailed         = "failed"
+	DeliveryStatusDelivered      = "delivered"
+	DeliveryStatusBounced        = "bounced"
+	DeliveryStatusDeferred       = "deferred"
+	DeliveryStatusSkipped        = "skipped"
+	DeliveryStatusUnsubscribed   = "unsubscribed"
+	DeliveryStatusInvalidContact = "invalid_contact"
+
+	QuietHoursActionDefer = "defer"
+	QuietHoursActionSkip  = "skip"
+	// DeferredRetryDelay defers again a deferred notification failing with a retryable error, e.g. a throttled provider
+	DeferredRetryDelay = 5 * time.Minute
+	// DeferredMaxAttempts is the number of times a deferred notification is sent before it fails for good
+	DeferredMaxAttempts = 5
+
+	ScheduleStatusPending   = "pending"
+	ScheduleStatusDone      = "done"
+	ScheduleStatusCancelled = "cancelled"
+
+	// timezone offsets range from UTC-12 to UTC+14, a wall clock time happens
+	// in every timezone between 14 hours before and 12 hours after it happens in UTC
+	TimezoneMaxOffsetAhead  = 14 * time.Hour
+	TimezoneMaxOffsetBehind = 12 * time.Hour
+
+	CacheKeyPrefixActiveUsers        = "users"
+	CacheKeyVersionedPrefixFmt       = "%s:v%d"
+	CacheKeyCodecPrefixFmt           = "%s:%s"
+	CacheKeyActiveUsersByTypeFmt     = "%s:%s"
+	CacheKeyActiveUsersByAudienceFmt = "%s:audience:%x"
+	CacheKeyGenerationFmt            = "%s:generation:%s"
+	CacheTtlActiveUserByType         = 1 * time.Minute
+	// CacheSchemaVersionUsers should be bumped whenever the cached User JSON changes incompatibly,
+	// version 2 may cache users along with their time, which version 1 instances can not decode
+	CacheSchemaVersionUsers = 2
+
+	// EmailScoreThreshold is the score users are notified by email above, by phone otherwise
+	EmailScoreThreshold = 50
+)
+
+// metrics recorded by UserService
+const (
+	MetricCacheHitsTotal        = "user_service_cache_hits_total"
+	MetricCacheMissesTotal      = "user_service_cache_misses_total"
+	MetricCacheStaleTotal       = "user_service_cache_stale_total"
+	MetricRepositoryErrorsTotal = "user_service_repository_errors_total"
+	MetricNotifyTotal           = "user_service_notify_total"
+	MetricNotifyDurationSeconds = "user_service_notify_duration_seconds"
+	// MetricRepositoryDurationSeconds is the latency of every repository call, labelled by repository and operation
+	MetricRepositoryDurationSeconds = "user_service_repository_duration_seconds"
+
+	MetricLabelRepository = "repository"
+	MetricLabelOperation  = "operation"
+	MetricLabelChannel    = "channel"
+	MetricLabelStatus     = "status"
+
+	MetricStatusSuccess = "success"
+	MetricStatusFailure = "failure"
+
+	RepositoryUser              = "user"
+	RepositoryCache             = "cache"
+	RepositoryDeliveryLog       = "delivery_log"
+	RepositorySchedule          = "schedule"
+	RepositoryConsent           = "consent"
+	RepositoryNotificationQueue = "notification_queue"
 )
 
+// span attributes recorded by UserService
 const (
-	UserTypePremium = "premium"
+	AttributeUserType     = "user_type"
+	AttributeTopic        = "topic"
+	AttributeSuccessCount = "success_count"
+	AttributeFailedCount  = "failed_count"
+	AttributeUserCount    = "user_count"
+	AttributeCacheKey     = "cache.key"
+	AttributeCacheHit     = "cache.hit"
+	AttributeChannel      = "channel"
+)
 
-	CacheKeyActiveUsersByTypeFmt = "users:%s"
-	CacheTtlActiveUserByType     = 1 * time.Minute
+// error codes more specific than the custerror kind codes, returned to clients along with the error
+const (
+	ErrorCodeUserTypeUnknown          custerror.Code = "user_type_unknown"
+	ErrorCodeDeliveryNotFound         custerror.Code = "delivery_not_found"
+	ErrorCodeDeliveryStatusTransition custerror.Code = "delivery_status_transition"
+	ErrorCodeScheduleNotFound         custerror.Code = "schedule_not_found"
+	ErrorCodeSchedulePartlySent       custerror.Code = "schedule_partly_sent"
+	ErrorCodeNotConfigured            custerror.Code = "not_configured"
 )
 
-func getCacheKeyActiveUsersByType(userType string) string {
-	return fmt.Sprintf(CacheKeyActiveUsersByTypeFmt, userType)
+// deliveryStatusTransitions lists the statuses a delivery may move to from each status,
+// statuses without an entry are final
+var deliveryStatusTransitions = map[string][]string{
+	DeliveryStatusSent: {DeliveryStatusDelivered, DeliveryStatusBounced, DeliveryStatusFailed},
+}
+
+func canTransitionDeliveryStatus(from string, to string) bool {
+	for _, status := range deliveryStatusTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// getCacheKeyActiveUsersByType gets the cache key of active users of userType with the default cache policy
+func getCacheKeyActiveUsersByType(userType UserType) string {
+	return DefaultCachePolicy().keyByType(userType)
+}
+
+// getCacheKeyActiveUsersByAudience gets the cache key of active users of audience with the default cache policy
+func getCacheKeyActiveUsersByAudience(audience AudienceFilter) string {
+	return DefaultCachePolicy().key(audience, nil)
 }
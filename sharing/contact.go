@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"net/mail"
+	"regexp"
+	"strings"
+)
+
+var (
+	// e164Regexp matches a + followed by up to 15 digits not starting with 0
+	e164Regexp = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+	// countryCodeRegexp matches an E.164 country calling code
+	countryCodeRegexp = regexp.MustCompile(`^[1-9][0-9]{0,2}$`)
+	// phoneSeparatorReplacer removes the separators commonly used to format phone numbers
+	phoneSeparatorReplacer = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "")
+)
+
+// ContactPolicy checks the user contact of the notification channel before notifying,
+// users with an invalid contact are not notified
+type ContactPolicy struct {
+	// NormalizePhoneNumber rewrites phone numbers to E.164 before checking them, e.g. "0811-2345-678" to "+628112345678"
+	NormalizePhoneNumber bool `json:"normalize_phone_number"`
+	// DefaultCountryCode replaces the trunk prefix 0 of national phone numbers when normalizing, e.g. "62"
+	DefaultCountryCode string `json:"default_country_code"`
+}
+
+func (cp ContactPolicy) Validate() error {
+	if cp.DefaultCountryCode != "" && !countryCodeRegexp.MatchString(cp.DefaultCountryCode) {
+		return errors.New("contact policy default country code should be 1 to 3 digits")
+	}
+	return nil
+}
+
+// normalize gets user with the phone number normalized when NormalizePhoneNumber is set
+func (cp ContactPolicy) normalize(user User) User {
+	if cp.NormalizePhoneNumber {
+		user.PhoneNumber = normalizePhoneNumber(user.PhoneNumber, cp.DefaultCountryCode)
+	}
+	return user
+}
+
+// check gets the reason the user contact used by channel can not be notified, nil when it is valid
+func (cp ContactPolicy) check(user User, channel string) error {
+	if channel == NotificationChannelEmail {
+		return validateEmail(user.Email)
+	}
+	return validatePhoneNumber(user.PhoneNumber)
+}
+
+// validateEmail accepts a bare RFC 5322 address with a dotted domain, e.g. "user@test.mail"
+func validateEmail(email string) error {
+	if email == "" {
+		return errors.New("email is empty")
+	}
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Name != "" || address.Address != email {
+		return errors.New("email is not a valid address")
+	}
+	_, domain, _ := strings.Cut(address.Address, "@")
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return errors.New("email is not a valid address")
+	}
+	return nil
+}
+
+// validatePhoneNumber accepts an E.164 phone number, e.g. "+628112345678"
+func validatePhoneNumber(phoneNumber string) error {
+	if phoneNumber == "" {
+		return errors.New("phone number is empty")
+	}
+	if !e164Regexp.MatchString(phoneNumber) {
+		return errors.New("phone number is not in E.164 format")
+	}
+	return nil
+}
+
+// normalizePhoneNumber removes separators, replaces the international prefix 00 with +
+// and the trunk prefix 0 with +defaultCountryCode, numbers it can not normalize are returned unchanged
+func normalizePhoneNumber(phoneNumber string, defaultCountryCode string) string {
+	normalized := phoneSeparatorReplacer.Replace(strings.TrimSpace(phoneNumber))
+	switch {
+	case strings.HasPrefix(normalized, "+"):
+		return normalized
+	case strings.HasPrefix(normalized, "00"):
+		return "+" + normalized[2:]
+	case strings.HasPrefix(normalized, "0") && defaultCountryCode != "":
+		return "+" + defaultCountryCode + normalized[1:]
+	}
+	return phoneNumber
+}
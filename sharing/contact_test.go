@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+)
+
+func Test_validateEmail(t *testing.T) {
+	tests := []struct {
+		name    string
+		email   string
+		wantErr bool
+	}{
+		{name: "valid", email: "user.name+tag@test.mail"},
+		{name: "empty", email: "", wantErr: true},
+		{name: "no at", email: "user.test.mail", wantErr: true},
+		{name: "no dotted domain", email: "user@localhost", wantErr: true},
+		{name: "display name", email: "User <user@test.mail>", wantErr: true},
+		{name: "spaces", email: "user name@test.mail", wantErr: true},
+		{name: "trailing dot", email: "user@test.", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateEmail(tt.email); (err != nil) != tt.wantErr {
+				t.Errorf("validateEmail() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_validatePhoneNumber(t *testing.T) {
+	tests := []struct {
+		name        string
+		phoneNumber string
+		wantErr     bool
+	}{
+		{name: "valid", phoneNumber: "+628112345678"},
+		{name: "empty", phoneNumber: "", wantErr: true},
+		{name: "national", phoneNumber: "08112345678", wantErr: true},
+		{name: "separators", phoneNumber: "+62 811-2345-678", wantErr: true},
+		{name: "too long", phoneNumber: "+1234567890123456", wantErr: true},
+		{name: "country code 0", phoneNumber: "+0812345678", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validatePhoneNumber(tt.phoneNumber); (err != nil) != tt.wantErr {
+				t.Errorf("validatePhoneNumber() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_normalizePhoneNumber(t *testing.T) {
+	tests := []struct {
+		name               string
+		phoneNumber        string
+		defaultCountryCode string
+		want               string
+	}{
+		{name: "already E.164", phoneNumber: "+628112345678", defaultCountryCode: "62", want: "+628112345678"},
+		{name: "separators", phoneNumber: " +62 (811) 2345-678 ", want: "+628112345678"},
+		{name: "international prefix", phoneNumber: "00628112345678", want: "+628112345678"},
+		{name: "trunk prefix", phoneNumber: "0811.2345.678", defaultCountryCode: "62", want: "+628112345678"},
+		{name: "trunk prefix without country code", phoneNumber: "08112345678", want: "08112345678"},
+		{name: "unknown format", phoneNumber: "8112345678", defaultCountryCode: "62", want: "8112345678"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizePhoneNumber(tt.phoneNumber, tt.defaultCountryCode); got != tt.want {
+				t.Errorf("normalizePhoneNumber() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserService_normalizeContacts(t *testing.T) {
+	users := []User{{Id: 1, PhoneNumber: "0811-2345-678"}, {Id: 2, PhoneNumber: "+628112345679"}}
+
+	us := &UserService{contactPolicy: &ContactPolicy{NormalizePhoneNumber: true, DefaultCountryCode: "62"}}
+	got := us.normalizeContacts(users)
+	if got[0].PhoneNumber != "+628112345678" || got[1].PhoneNumber != "+628112345679" {
+		t.Errorf("normalizeContacts() = %v", got)
+	}
+	if users[0].PhoneNumber != "0811-2345-678" {
+		t.Errorf("normalizeContacts() changed the given users %v", users)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/practice/sharing/util/custerror"
+	"github.com/practice/sharing/util/json"
+	"github.com/practice/sharing/util/logger"
+)
+
+const (
+	// HeaderRequestId identifies a request across services, it is added to the entries logged while serving it
+	HeaderRequestId = "X-Request-Id"
+	// HeaderSignature is the hex encoded HMAC-SHA256 of a receipt body with the secret shared with the providers
+	HeaderSignature = "X-Signature"
+
+	// DeliveryReceiptMaxBodyBytes is the largest receipt body read, a receipt is a few hundred bytes
+	DeliveryReceiptMaxBodyBytes = 64 << 10
+)
+
+// DeliveryReceiptHandler receives asynchronous delivery statuses reported by SMS and email providers,
+// only receipts signed with the shared secret are accepted
+type DeliveryReceiptHandler struct {
+	userService *UserService
+	secret      []byte
+}
+
+func NewDeliveryReceiptHandler(userService *UserService, secret string) (*DeliveryReceiptHandler, error) {
+	if secret == "" {
+		return nil, errors.New("delivery receipt secret is required")
+	}
+	return &DeliveryReceiptHandler{userService: userService, secret: []byte(secret)}, nil
+}
+
+func (dh *DeliveryReceiptHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	jsonHandler := dh.userService.getJson()
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJsonError(w, jsonHandler, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, DeliveryReceiptMaxBodyBytes))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeJsonError(w, jsonHandler, http.StatusRequestEntityTooLarge, "request body too large")
+			return
+		}
+		writeJsonError(w, jsonHandler, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !dh.validSignature(body, r.Header.Get(HeaderSignature)) {
+		writeJsonError(w, jsonHandler, http.StatusUnauthorized, "invalid signature")
+		return
+	}
+
+	var request DeliveryReceiptRequest
+	if err = jsonHandler.Unmarshal(body, &request); err != nil {
+		writeJsonError(w, jsonHandler, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx := r.Context()
+	if requestId := r.Header.Get(HeaderRequestId); requestId != "" {
+		ctx = logger.WithFields(ctx, logger.FieldRequestId, requestId)
+	}
+	deliveryLog, err := dh.userService.IngestDeliveryReceipt(ctx, request)
+	if err != nil {
+		writeJsonServiceError(w, jsonHandler, err)
+		return
+	}
+
+	writeJson(w, jsonHandler, http.StatusOK, deliveryLog)
+}
+
+// validSignature reports whether signature is the HMAC-SHA256 of body with the shared secret
+func (dh *DeliveryReceiptHandler) validSignature(body []byte, signature string) bool {
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(got, signDeliveryReceipt(dh.secret, body))
+}
+
+func signDeliveryReceipt(secret []byte, body []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+type errorResponse struct {
+	Error      string                     `json:"error"`
+	Code       custerror.Code             `json:"code,omitempty"`
+	Details    map[string]string          `json:"details,omitempty"`
+	Violations []custerror.FieldViolation `json:"violations,omitempty"`
+}
+
+func writeJsonError(w http.ResponseWriter, jsonHandler json.Handler, status int, message string) {
+	writeJson(w, jsonHandler, status, errorResponse{Error: message})
+}
+
+// writeJsonServiceError writes an error returned by UserService with its code and details,
+// including the field violations of a bad request
+func writeJsonServiceError(w http.ResponseWriter, jsonHandler json.Handler, err error) {
+	resp := errorResponse{
+		Error:   err.Error(),
+		Code:    custerror.GetCode(err),
+		Details: custerror.GetDetails(err),
+	}
+	var badRequest *custerror.BadRequest
+	if errors.As(err, &badRequest) {
+		resp.Violations = badRequest.Violations()
+	}
+	writeJson(w, jsonHandler, custerror.GetHttpStatus(err), resp)
+}
+
+func writeJson(w http.ResponseWriter, jsonHandler json.Handler, status int, data interface{}) {
+	bytesData, err := jsonHandler.Marshal(data)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(bytesData)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+)
+
+func TestDeliveryReceiptHandler_ServeHTTP(t *testing.T) {
+	secret := "receipt-secret"
+	body := `{"channel": "email", "provider_message_id": "msg-1", "status": "bounced", "reason": "mailbox full"}`
+	receiptLogsReq := GetDeliveryLogsRequest{Channel: NotificationChannelEmail, ProviderMessageId: "msg-1"}
+
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		signature  string
+		setupMocks func(mocks userServiceMocks)
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "ServeHTTP fail, method not allowed",
+			method:     http.MethodGet,
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "ServeHTTP fail, malformed signature",
+			method:     http.MethodPost,
+			body:       body,
+			signature:  "-",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "ServeHTTP fail, signed with another secret",
+			method:     http.MethodPost,
+			body:       body,
+			signature:  hex.EncodeToString(signDeliveryReceipt([]byte("other-secret"), []byte(body))),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "ServeHTTP fail, body too large",
+			method:     http.MethodPost,
+			body:       strings.Repeat(" ", DeliveryReceiptMaxBodyBytes+1),
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "ServeHTTP fail, malformed body",
+			method:     http.MethodPost,
+			body:       `{"channel":`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "ServeHTTP fail, invalid receipt",
+			method:     http.MethodPost,
+			body:       `{"channel": "fax", "status": "delivered"}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody: `{"error":"channel should be email or phone; provider message id should not be empty","code":"bad_request",` +
+				`"violations":[{"field":"channel","rule":"oneof","message":"channel should be email or phone"},` +
+				`{"field":"provider_message_id","rule":"required","message":"provider message id should not be empty"}]}`,
+		},
+		{
+			name:   "ServeHTTP fail, delivery not found",
+			method: http.MethodPost,
+			body:   body,
+			setupMocks: func(mocks userServiceMocks) {
+				mocks.deliveryLogRepository.EXPECT().Find(gomock.Any(), receiptLogsReq).
+					Return(nil, nil)
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:   "ServeHTTP fail, error deliveryLogRepository.Find",
+			method: http.MethodPost,
+			body:   body,
+			setupMocks: func(mocks userServiceMocks) {
+				mocks.deliveryLogRepository.EXPECT().Find(gomock.Any(), receiptLogsReq).
+					Return(nil, errors.New("failed"))
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name:   "ServeHTTP success",
+			method: http.MethodPost,
+			body:   body,
+			setupMocks: func(mocks userServiceMocks) {
+				mocks.deliveryLogRepository.EXPECT().Find(gomock.Any(), receiptLogsReq).
+					Return([]DeliveryLog{{Id: 1, Status: DeliveryStatusSent}}, nil)
+				mocks.deliveryLogRepository.EXPECT().Update(gomock.Any(), deliveryLogEq(DeliveryLog{Id: 1, Status: DeliveryStatusBounced, Message: "mailbox full"})).
+					Return(nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mocks := userServiceMocks{
+				deliveryLogRepository: NewMockDeliveryLogRepository(ctrl),
+			}
+			if tt.setupMocks != nil {
+				tt.setupMocks(mocks)
+			}
+
+			handler, err := NewDeliveryReceiptHandler(&UserService{
+				deliveryLogRepository: mocks.deliveryLogRepository,
+			}, secret)
+			if err != nil {
+				t.Fatalf("NewDeliveryReceiptHandler() error = %v", err)
+			}
+			request := httptest.NewRequest(tt.method, "/receipts", strings.NewReader(tt.body))
+			signature := tt.signature
+			if signature == "" {
+				signature = hex.EncodeToString(signDeliveryReceipt([]byte(secret), []byte(tt.body)))
+			}
+			request.Header.Set(HeaderSignature, signature)
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("ServeHTTP() status = %v, want %v, body %s", recorder.Code, tt.wantStatus, recorder.Body.String())
+			}
+			if tt.wantBody != "" && recorder.Body.String() != tt.wantBody {
+				t.Errorf("ServeHTTP() body = %s, want %s", recorder.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestNewDeliveryReceiptHandler_withoutSecret(t *testing.T) {
+	if _, err := NewDeliveryReceiptHandler(&UserService{}, ""); err == nil {
+		t.Errorf("NewDeliveryReceiptHandler() error = nil, want error")
+	}
+}
@@ -7,13 +7,49 @@ import (
 
 type UserRepository interface {
 	GetByTypeAndState(ctx context.Context, request GetUsersByTypeRequest) (users []User, err error)
+	GetByAudienceAndState(ctx context.Context, request GetUsersByAudienceRequest) (users []User, err error)
+	// GetByIdsAndState gets the users of request Ids in request state, ids without such a user are left out
+	GetByIdsAndState(ctx context.Context, request GetUsersByIdsRequest) (users []User, err error)
 }
 
 type CacheRepository interface {
 	Get(ctx context.Context, key string) (response string, err error)
 	Set(ctx context.Context, key string, data string, ttl time.Duration) (err error)
+	// Delete removes key, deleting a missing key is not an error
+	Delete(ctx context.Context, key string) (err error)
 }
 
+// Notifier sends a message to a user contact, ctx carries the Notify span so an implementation
+// calling a provider can propagate the trace, e.g. with the tracing.TraceParent header,
+// messageId is the id the provider gave the message, its delivery receipts refer to it
 type Notifier interface {
-	Notify(ctx context.Context, identifier string, message string) (err error)
+	Notify(ctx context.Context, identifier string, message string) (messageId string, err error)
+}
+
+type DeliveryLogRepository interface {
+	Save(ctx context.Context, logs []DeliveryLog) (err error)
+	Find(ctx context.Context, request GetDeliveryLogsRequest) (logs []DeliveryLog, err error)
+	Update(ctx context.Context, log DeliveryLog) (err error)
+}
+
+type ScheduleRepository interface {
+	Create(ctx context.Context, schedule Schedule) (created Schedule, err error)
+	GetById(ctx context.Context, id int64) (schedule Schedule, err error)
+	Update(ctx context.Context, schedule Schedule) (err error)
+	FindPending(ctx context.Context) (schedules []Schedule, err error)
+}
+
+type NotificationQueue interface {
+	Push(ctx context.Context, notification DeferredNotification) (err error)
+	PopDue(ctx context.Context, now time.Time) (notifications []DeferredNotification, err error)
+}
+
+type ConsentRepository interface {
+	// GetConsents gets the consents of a user on channel for topic and for every topic of the channel
+	GetConsents(ctx context.Context, userId int64, channel string, topic string) (consents []Consent, err error)
+	Save(ctx context.Context, consent Consent) (err error)
+}
+
+type Clock interface {
+	Now() time.Time
 }
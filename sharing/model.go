@@ -1,45 +1,595 @@
 package main
 
-import "errors"
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/practice/sharing/util/validator"
+)
 
 type NotifyUsersByTypeRequest struct {
 	Message  string
-	UserType string
+	UserType UserType
+	// Audience selects users beyond a single UserType, only one of UserType or Audience is set
+	Audience *AudienceFilter
+	// Topic is checked against the users consent, users opted out of it are not notified
+	Topic string
 }
 
 func (sr NotifyUsersByTypeRequest) Validate() error {
+	violations := validator.NewViolations()
+	sr.validate(violations)
+	return violations.Err()
+}
+
+func (sr NotifyUsersByTypeRequest) validate(violations *validator.Violations) {
 	if sr.Message == "" {
-		return errors.New("message should not be empty")
+		violations.Add("message", validator.RuleRequired, "message should not be empty")
+	}
+
+	if sr.Audience != nil {
+		if sr.UserType != "" {
+			violations.Add("user_type", validator.RuleExclusive, "user type and audience should not be both set")
+		}
+		sr.Audience.validate(violations)
+	} else if sr.UserType == "" {
+		violations.Add("user_type", validator.RuleRequired, "user type should not be empty")
+	}
+}
+
+// audience gets the request audience, a request by UserType is an audience of that single type
+func (sr NotifyUsersByTypeRequest) audience() AudienceFilter {
+	if sr.Audience != nil {
+		return *sr.Audience
+	}
+	return AudienceFilter{UserTypes: []UserType{sr.UserType}}
+}
+
+// AudienceFilter selects active users matching every condition set
+type AudienceFilter struct {
+	UserTypes []UserType `json:"user_types"`
+	MinScore  *int       `json:"min_score"`
+	MaxScore  *int       `json:"max_score"`
+	HasEmail  bool       `json:"has_email"`
+	HasPhone  bool       `json:"has_phone"`
+	// IncludeIds limits the audience to these users, ExcludeIds removes users from the audience
+	IncludeIds []int64 `json:"include_ids"`
+	ExcludeIds []int64 `json:"exclude_ids"`
+}
+
+func (af AudienceFilter) Validate() error {
+	violations := validator.NewViolations()
+	af.validate(violations)
+	return violations.Err()
+}
+
+func (af AudienceFilter) validate(violations *validator.Violations) {
+	if len(af.UserTypes) == 0 && len(af.IncludeIds) == 0 {
+		violations.Add("audience.user_types", validator.RuleRequired, "audience should have user types or include ids")
+	}
+
+	for i, userType := range af.UserTypes {
+		if userType == "" {
+			violations.Add(fmt.Sprintf("audience.user_types[%d]", i), validator.RuleRequired, "audience user type should not be empty")
+		}
+	}
+
+	if af.MinScore != nil && af.MaxScore != nil && *af.MinScore > *af.MaxScore {
+		violations.Add("audience.min_score", validator.RuleRange, "audience min score should not be greater than max score")
+	}
+}
+
+// isSingleType reports whether the audience is every user of a single type
+func (af AudienceFilter) isSingleType() bool {
+	return len(af.UserTypes) == 1 && af.MinScore == nil && af.MaxScore == nil && !af.HasEmail && !af.HasPhone &&
+		len(af.IncludeIds) == 0 && len(af.ExcludeIds) == 0
+}
+
+// canonical gets a representation of the audience independent of the order of its lists,
+// equal audiences always have the same canonical representation
+func (af AudienceFilter) canonical() string {
+	userTypes := make([]string, 0, len(af.UserTypes))
+	for _, userType := range af.UserTypes {
+		userTypes = append(userTypes, string(userType))
+	}
+	sort.Strings(userTypes)
+
+	var builder strings.Builder
+	builder.WriteString("types=" + strings.Join(userTypes, ","))
+	if af.MinScore != nil {
+		builder.WriteString(";min_score=" + strconv.Itoa(*af.MinScore))
+	}
+	if af.MaxScore != nil {
+		builder.WriteString(";max_score=" + strconv.Itoa(*af.MaxScore))
+	}
+	if af.HasEmail {
+		builder.WriteString(";has_email")
+	}
+	if af.HasPhone {
+		builder.WriteString(";has_phone")
+	}
+	if len(af.IncludeIds) > 0 {
+		builder.WriteString(";include=" + joinSortedIds(af.IncludeIds))
+	}
+	if len(af.ExcludeIds) > 0 {
+		builder.WriteString(";exclude=" + joinSortedIds(af.ExcludeIds))
+	}
+	return builder.String()
+}
+
+func joinSortedIds(ids []int64) string {
+	sorted := append([]int64(nil), ids...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	strIds := make([]string, 0, len(sorted))
+	for i, id := range sorted {
+		if i > 0 && id == sorted[i-1] {
+			continue
+		}
+		strIds = append(strIds, strconv.FormatInt(id, 10))
 	}
+	return strings.Join(strIds, ",")
+}
+
+type NotifyUsersRequest struct {
+	UserIds []int64
+	Message string
+	// Topic is checked against the users consent, users opted out of it are not notified
+	Topic string
+}
 
-	if sr.UserType == "" {
-		return errors.New("user type should not be empty")
+func (nr NotifyUsersRequest) Validate() error {
+	violations := validator.NewViolations()
+	if nr.Message == "" {
+		violations.Add("message", validator.RuleRequired, "message should not be empty")
 	}
 
-	return nil
+	if len(nr.UserIds) == 0 {
+		violations.Add("user_ids", validator.RuleRequired, "user ids should not be empty")
+	}
+
+	for i, userId := range nr.UserIds {
+		if userId <= 0 {
+			violations.Add(fmt.Sprintf("user_ids[%d]", i), validator.RulePositive, "user ids should be positive")
+		}
+	}
+
+	return violations.Err()
+}
+
+func (nr NotifyUsersRequest) notifyUsersByTypeRequest() NotifyUsersByTypeRequest {
+	return NotifyUsersByTypeRequest{
+		Message: nr.Message,
+		Topic:   nr.Topic,
+	}
 }
 
 type NotifyUserResult struct {
 	UserId  int64
 	Message string
+	// ProviderMessageId is the id the provider gave a sent notification
+	ProviderMessageId string
 }
 
 type NotifyUsersByTypeResponse struct {
 	FailedNotifyUsers  []NotifyUserResult
 	SuccessNotifyUsers []NotifyUserResult
+	// DeferredNotifyUsers & SkippedNotifyUsers are users not notified during their quiet hours
+	DeferredNotifyUsers []NotifyUserResult
+	SkippedNotifyUsers  []NotifyUserResult
+	// UnsubscribedNotifyUsers are users opted out of the channel or topic
+	UnsubscribedNotifyUsers []NotifyUserResult
+	// InvalidContactNotifyUsers are users with an empty or malformed contact for the channel
+	InvalidContactNotifyUsers []NotifyUserResult
+}
+
+// add appends result to the bucket of the delivery status
+func (r *NotifyUsersByTypeResponse) add(status string, result NotifyUserResult) {
+	switch status {
+	case DeliveryStatusSent:
+		r.SuccessNotifyUsers = append(r.SuccessNotifyUsers, result)
+	case DeliveryStatusDeferred:
+		r.DeferredNotifyUsers = append(r.DeferredNotifyUsers, result)
+	case DeliveryStatusSkipped:
+		r.SkippedNotifyUsers = append(r.SkippedNotifyUsers, result)
+	case DeliveryStatusUnsubscribed:
+		r.UnsubscribedNotifyUsers = append(r.UnsubscribedNotifyUsers, result)
+	case DeliveryStatusInvalidContact:
+		r.InvalidContactNotifyUsers = append(r.InvalidContactNotifyUsers, result)
+	default:
+		r.FailedNotifyUsers = append(r.FailedNotifyUsers, result)
+	}
+}
+
+// RetryFailedRequest retries the failed users of a previous NotifyUsersByType or NotifyUsers response,
+// the failed users are resolved again by id
+type RetryFailedRequest struct {
+	Message string
+	// UserType and Audience are the target of the previous request, optional since a NotifyUsers response has none
+	UserType         UserType
+	Audience         *AudienceFilter
+	Topic            string
+	PreviousResponse NotifyUsersByTypeResponse
+}
+
+func (rr RetryFailedRequest) Validate() error {
+	violations := validator.NewViolations()
+	if rr.Message == "" {
+		violations.Add("message", validator.RuleRequired, "message should not be empty")
+	}
+
+	if rr.Audience != nil {
+		if rr.UserType != "" {
+			violations.Add("user_type", validator.RuleExclusive, "user type and audience should not be both set")
+		}
+		rr.Audience.validate(violations)
+	}
+
+	if len(rr.PreviousResponse.FailedNotifyUsers) == 0 {
+		violations.Add("previous_response.failed_notify_users", validator.RuleRequired, "previous response should have failed users")
+	}
+
+	return violations.Err()
+}
+
+// failedUserIds gets the ids of the previous failed users, each once in the order they failed
+func (rr RetryFailedRequest) failedUserIds() (ids []int64) {
+	seen := make(map[int64]bool, len(rr.PreviousResponse.FailedNotifyUsers))
+	for _, result := range rr.PreviousResponse.FailedNotifyUsers {
+		if !seen[result.UserId] {
+			seen[result.UserId] = true
+			ids = append(ids, result.UserId)
+		}
+	}
+	return ids
+}
+
+func (rr RetryFailedRequest) notifyUsersByTypeRequest() NotifyUsersByTypeRequest {
+	return NotifyUsersByTypeRequest{
+		Message:  rr.Message,
+		UserType: rr.UserType,
+		Audience: rr.Audience,
+		Topic:    rr.Topic,
+	}
 }
 
 type GetUsersByTypeRequest struct {
-	UserType  string
+	UserType  UserType
+	IsDeleted bool
+	IsActive  bool
+}
+
+type GetUsersByAudienceRequest struct {
+	Audience  AudienceFilter
+	IsDeleted bool
+	IsActive  bool
+}
+
+type GetUsersByIdsRequest struct {
+	Ids       []int64
 	IsDeleted bool
 	IsActive  bool
 }
 
 type User struct {
-	Id          int64  `json:"id"`
-	Name        string `json:"name"`
-	Type        string `json:"type"`
-	PhoneNumber string `json:"phone_number"`
-	Email       string `json:"email"`
-	Score       int    `json:"score"`
+	Id          int64    `json:"id"`
+	Name        string   `json:"name"`
+	Type        UserType `json:"type"`
+	PhoneNumber string   `json:"phone_number"`
+	Email       string   `json:"email"`
+	Score       int      `json:"score"`
+	Timezone    string   `json:"timezone"`
+}
+
+// Location loads the user IANA timezone, UTC for users without a timezone,
+// an invalid timezone is reported by err along with UTC
+func (u User) Location() (location *time.Location, err error) {
+	if u.Timezone == "" {
+		return time.UTC, nil
+	}
+	return loadLocation(u.Timezone)
+}
+
+// locations caches the timezones loaded by name, time.LoadLocation reads the timezone database at each call
+var locations sync.Map
+
+// loadLocation loads the timezone of name once, invalid names are not cached
+func loadLocation(name string) (*time.Location, error) {
+	if location, ok := locations.Load(name); ok {
+		return location.(*time.Location), nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC, err
+	}
+	locations.Store(name, location)
+	return location, nil
+}
+
+type DeliveryLog struct {
+	Id             int64    `json:"id"`
+	UserId         int64    `json:"user_id"`
+	UserType       UserType `json:"user_type"`
+	Channel        string   `json:"channel"`
+	Identifier     string   `json:"identifier"`
+	RequestMessage string   `json:"request_message"`
+	Topic          string   `json:"topic"`
+	Status         string   `json:"status"`
+	Message        string   `json:"message"`
+	// ProviderMessageId is the id the provider gave a sent notification, its delivery receipts refer to it
+	ProviderMessageId string    `json:"provider_message_id"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+type GetDeliveryLogsRequest struct {
+	UserId            int64
+	Channel           string
+	Identifier        string
+	ProviderMessageId string
+	Status            string
+	From              time.Time
+	To                time.Time
+}
+
+func (gr GetDeliveryLogsRequest) Validate() error {
+	violations := validator.NewViolations()
+	if !gr.From.IsZero() && !gr.To.IsZero() && gr.To.Before(gr.From) {
+		violations.Add("to", validator.RuleRange, "to should not be before from")
+	}
+
+	return violations.Err()
+}
+
+// Match reports whether log satisfies every filter set on the request
+func (gr GetDeliveryLogsRequest) Match(log DeliveryLog) bool {
+	if gr.UserId != 0 && log.UserId != gr.UserId {
+		return false
+	}
+	if gr.Channel != "" && log.Channel != gr.Channel {
+		return false
+	}
+	if gr.Identifier != "" && log.Identifier != gr.Identifier {
+		return false
+	}
+	if gr.ProviderMessageId != "" && log.ProviderMessageId != gr.ProviderMessageId {
+		return false
+	}
+	if gr.Status != "" && log.Status != gr.Status {
+		return false
+	}
+	if !gr.From.IsZero() && log.CreatedAt.Before(gr.From) {
+		return false
+	}
+	if !gr.To.IsZero() && log.CreatedAt.After(gr.To) {
+		return false
+	}
+	return true
+}
+
+// DeliveryReceiptRequest is a delivery status reported by the provider of channel for the message it gave ProviderMessageId
+type DeliveryReceiptRequest struct {
+	Channel           string `json:"channel"`
+	ProviderMessageId string `json:"provider_message_id"`
+	Status            string `json:"status"`
+	Reason            string `json:"reason"`
+}
+
+func (dr DeliveryReceiptRequest) Validate() error {
+	violations := validator.NewViolations()
+	if dr.Channel != NotificationChannelEmail && dr.Channel != NotificationChannelPhone {
+		violations.Add("channel", validator.RuleOneOf, "channel should be email or phone")
+	}
+
+	if dr.ProviderMessageId == "" {
+		violations.Add("provider_message_id", validator.RuleRequired, "provider message id should not be empty")
+	}
+
+	if dr.Status != DeliveryStatusDelivered && dr.Status != DeliveryStatusBounced && dr.Status != DeliveryStatusFailed {
+		violations.Add("status", validator.RuleOneOf, "status should be delivered, bounced or failed")
+	}
+
+	return violations.Err()
+}
+
+type ScheduleNotifyUsersByTypeRequest struct {
+	Message  string          `json:"message"`
+	UserType UserType        `json:"user_type"`
+	Audience *AudienceFilter `json:"audience"`
+	Topic    string          `json:"topic"`
+	SendAt   time.Time       `json:"send_at"`
+	// InUserTimezone sends at the wall clock time of SendAt in each user timezone instead of the SendAt instant
+	InUserTimezone bool `json:"in_user_timezone"`
+}
+
+func (sr ScheduleNotifyUsersByTypeRequest) Validate() error {
+	violations := validator.NewViolations()
+	sr.notifyUsersByTypeRequest().validate(violations)
+
+	if sr.SendAt.IsZero() {
+		violations.Add("send_at", validator.RuleRequired, "send at should not be empty")
+	}
+
+	return violations.Err()
+}
+
+func (sr ScheduleNotifyUsersByTypeRequest) notifyUsersByTypeRequest() NotifyUsersByTypeRequest {
+	return NotifyUsersByTypeRequest{
+		Message:  sr.Message,
+		UserType: sr.UserType,
+		Audience: sr.Audience,
+		Topic:    sr.Topic,
+	}
+}
+
+type Schedule struct {
+	Id             int64           `json:"id"`
+	Message        string          `json:"message"`
+	UserType       UserType        `json:"user_type"`
+	Audience       *AudienceFilter `json:"audience"`
+	Topic          string          `json:"topic"`
+	SendAt         time.Time       `json:"send_at"`
+	InUserTimezone bool            `json:"in_user_timezone"`
+	Status         string          `json:"status"`
+	// SentTimezones lists timezones already notified by an InUserTimezone schedule
+	SentTimezones []string  `json:"sent_timezones"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+func (s Schedule) notifyUsersByTypeRequest() NotifyUsersByTypeRequest {
+	return NotifyUsersByTypeRequest{
+		Message:  s.Message,
+		UserType: s.UserType,
+		Audience: s.Audience,
+		Topic:    s.Topic,
+	}
+}
+
+// sendAtIn gets the instant a schedule is due in location, an InUserTimezone schedule is due at the
+// wall clock time of SendAt in its own location, e.g. 09:00+07:00 is due at 09:00 in every location
+func (s Schedule) sendAtIn(location *time.Location) time.Time {
+	if !s.InUserTimezone {
+		return s.SendAt
+	}
+	return time.Date(s.SendAt.Year(), s.SendAt.Month(), s.SendAt.Day(), s.SendAt.Hour(), s.SendAt.Minute(), s.SendAt.Second(), 0, location)
+}
+
+// firstSendAt gets the earliest instant a schedule is due in any location
+func (s Schedule) firstSendAt() time.Time {
+	if !s.InUserTimezone {
+		return s.SendAt
+	}
+	return s.sendAtIn(time.UTC).Add(-TimezoneMaxOffsetAhead)
+}
+
+// lastSendAt gets the latest instant a schedule is due in any location
+func (s Schedule) lastSendAt() time.Time {
+	if !s.InUserTimezone {
+		return s.SendAt
+	}
+	return s.sendAtIn(time.UTC).Add(TimezoneMaxOffsetBehind)
+}
+
+// QuietHours is the local time range phone notifications should not be sent,
+// it wraps around midnight when StartHour is after EndHour
+type QuietHours struct {
+	StartHour int    `json:"start_hour"`
+	EndHour   int    `json:"end_hour"`
+	Action    string `json:"action"`
+}
+
+func (qh QuietHours) Validate() error {
+	violations := validator.NewViolations()
+	if qh.StartHour < 0 || qh.StartHour > 23 {
+		violations.Add("start_hour", validator.RuleRange, "quiet hours start hour should be between 0 and 23")
+	}
+
+	if qh.EndHour < 0 || qh.EndHour > 23 {
+		violations.Add("end_hour", validator.RuleRange, "quiet hours end hour should be between 0 and 23")
+	}
+
+	if qh.Action != QuietHoursActionDefer && qh.Action != QuietHoursActionSkip {
+		violations.Add("action", validator.RuleOneOf, "quiet hours action should be defer or skip")
+	}
+
+	return violations.Err()
+}
+
+// contains reports whether localTime is inside the quiet hours
+func (qh QuietHours) contains(localTime time.Time) bool {
+	hour := localTime.Hour()
+	if qh.StartHour <= qh.EndHour {
+		return hour >= qh.StartHour && hour < qh.EndHour
+	}
+	return hour >= qh.StartHour || hour < qh.EndHour
+}
+
+// nextEnd gets the first time quiet hours end after localTime, in localTime location
+func (qh QuietHours) nextEnd(localTime time.Time) time.Time {
+	end := time.Date(localTime.Year(), localTime.Month(), localTime.Day(), qh.EndHour, 0, 0, 0, localTime.Location())
+	if !end.After(localTime) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return end
+}
+
+type DeferredNotification struct {
+	UserId     int64     `json:"user_id"`
+	UserType   UserType  `json:"user_type"`
+	Identifier string    `json:"identifier"`
+	Message    string    `json:"message"`
+	Topic      string    `json:"topic"`
+	SendAt     time.Time `json:"send_at"`
+	// Attempts counts the failed sends of the notification, it fails for good after DeferredMaxAttempts
+	Attempts int `json:"attempts"`
+}
+
+// user gets the user a notification was deferred for, along with the phone number it is sent to
+func (dn DeferredNotification) user() User {
+	return User{
+		Id:          dn.UserId,
+		Type:        dn.UserType,
+		PhoneNumber: dn.Identifier,
+	}
+}
+
+type Consent struct {
+	UserId  int64  `json:"user_id"`
+	Channel string `json:"channel"`
+	// Topic is empty for a consent covering every topic of the channel
+	Topic     string    `json:"topic"`
+	OptedIn   bool      `json:"opted_in"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type RecordConsentRequest struct {
+	UserId  int64  `json:"user_id"`
+	Channel string `json:"channel"`
+	Topic   string `json:"topic"`
+	OptedIn bool   `json:"opted_in"`
+}
+
+func (rr RecordConsentRequest) Validate() error {
+	violations := validator.NewViolations()
+	if rr.UserId <= 0 {
+		violations.Add("user_id", validator.RulePositive, "user id should be positive")
+	}
+
+	if rr.Channel != NotificationChannelEmail && rr.Channel != NotificationChannelPhone {
+		violations.Add("channel", validator.RuleOneOf, "channel should be email or phone")
+	}
+
+	return violations.Err()
+}
+
+// UserChangedRequest describes a user created, updated or deleted, Previous is nil for a created user
+// and Current is nil for a deleted one
+type UserChangedRequest struct {
+	Previous *User `json:"previous"`
+	Current  *User `json:"current"`
+}
+
+func (ur UserChangedRequest) Validate() error {
+	violations := validator.NewViolations()
+	if ur.Previous == nil && ur.Current == nil {
+		violations.Add("current", validator.RuleRequired, "previous or current user should be set")
+	}
+
+	return violations.Err()
+}
+
+// userTypes gets the distinct types of the previous and current user
+func (ur UserChangedRequest) userTypes() (userTypes []UserType) {
+	if ur.Previous != nil && ur.Previous.Type != "" {
+		userTypes = append(userTypes, ur.Previous.Type)
+	}
+	if ur.Current != nil && ur.Current.Type != "" && (ur.Previous == nil || ur.Current.Type != ur.Previous.Type) {
+		userTypes = append(userTypes, ur.Current.Type)
+	}
+	return userTypes
 }
@@ -1,11 +1,20 @@
 package main
 
-import "testing"
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/practice/sharing/util/custerror"
+)
 
 func TestNotifyUsersByTypeRequest_Validate(t *testing.T) {
+	minScore, maxScore := 50, 10
 	type fields struct {
 		Message  string
-		UserType string
+		UserType UserType
+		Audience *AudienceFilter
 	}
 	tests := []struct {
 		name    string
@@ -32,12 +41,33 @@ func TestNotifyUsersByTypeRequest_Validate(t *testing.T) {
 			fields:  fields{Message: "Message", UserType: UserTypePremium},
 			wantErr: false,
 		},
+		{
+			name:    "Validate fail, both UserType & Audience",
+			fields:  fields{Message: "Message", UserType: UserTypePremium, Audience: &AudienceFilter{UserTypes: []UserType{UserTypePremium}}},
+			wantErr: true,
+		},
+		{
+			name:    "Validate fail, Audience without UserTypes & IncludeIds",
+			fields:  fields{Message: "Message", Audience: &AudienceFilter{HasEmail: true}},
+			wantErr: true,
+		},
+		{
+			name:    "Validate fail, Audience MinScore greater than MaxScore",
+			fields:  fields{Message: "Message", Audience: &AudienceFilter{UserTypes: []UserType{UserTypePremium}, MinScore: &minScore, MaxScore: &maxScore}},
+			wantErr: true,
+		},
+		{
+			name:    "Validate success, Audience",
+			fields:  fields{Message: "Message", Audience: &AudienceFilter{UserTypes: []UserType{UserTypePremium, UserTypeBasic}, MinScore: &maxScore, MaxScore: &minScore}},
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			sr := NotifyUsersByTypeRequest{
 				Message:  tt.fields.Message,
 				UserType: tt.fields.UserType,
+				Audience: tt.fields.Audience,
 			}
 			if err := sr.Validate(); (err != nil) != tt.wantErr {
 				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
@@ -45,3 +75,122 @@ func TestNotifyUsersByTypeRequest_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestGetCacheKeyActiveUsersByAudience(t *testing.T) {
+	minScore := 50
+	audience := AudienceFilter{UserTypes: []UserType{UserTypePremium, UserTypeBasic}, MinScore: &minScore, ExcludeIds: []int64{3, 1}}
+	reordered := AudienceFilter{UserTypes: []UserType{UserTypeBasic, UserTypePremium}, MinScore: &minScore, ExcludeIds: []int64{1, 3, 3}}
+	withEmail := audience
+	withEmail.HasEmail = true
+
+	if got := getCacheKeyActiveUsersByAudience(AudienceFilter{UserTypes: []UserType{UserTypePremium}}); got != getCacheKeyActiveUsersByType(UserTypePremium) {
+		t.Errorf("single type audience key = %v, want %v", got, getCacheKeyActiveUsersByType(UserTypePremium))
+	}
+	if getCacheKeyActiveUsersByAudience(audience) != getCacheKeyActiveUsersByAudience(reordered) {
+		t.Errorf("equal audiences should have the same key")
+	}
+	if getCacheKeyActiveUsersByAudience(audience) == getCacheKeyActiveUsersByAudience(withEmail) {
+		t.Errorf("different audiences should have different keys")
+	}
+}
+
+func TestNotifyUsersByTypeRequest_Validate_violations(t *testing.T) {
+	minScore, maxScore := 50, 10
+	request := NotifyUsersByTypeRequest{
+		UserType: UserTypePremium,
+		Audience: &AudienceFilter{UserTypes: []UserType{""}, MinScore: &minScore, MaxScore: &maxScore},
+	}
+
+	err := request.Validate()
+	var badRequest *custerror.BadRequest
+	if !errors.As(err, &badRequest) {
+		t.Fatalf("Validate() error = %v, want *custerror.BadRequest", err)
+	}
+	want := []custerror.FieldViolation{
+		{Field: "message", Rule: "required", Message: "message should not be empty"},
+		{Field: "user_type", Rule: "exclusive", Message: "user type and audience should not be both set"},
+		{Field: "audience.user_types[0]", Rule: "required", Message: "audience user type should not be empty"},
+		{Field: "audience.min_score", Rule: "range", Message: "audience min score should not be greater than max score"},
+	}
+	if got := badRequest.Violations(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Validate() violations = %v, want %v", got, want)
+	}
+}
+
+func TestSchedule_sendAtIn(t *testing.T) {
+	jakarta := time.FixedZone("WIB", 7*60*60)
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("timezone database unavailable: %v", err)
+	}
+	// 09:00 in Jakarta is 02:00 in UTC, the wall clock time should not move to 02:00
+	sendAt := time.Date(2024, 1, 2, 9, 0, 0, 0, jakarta)
+
+	tests := []struct {
+		name     string
+		schedule Schedule
+		location *time.Location
+		want     time.Time
+	}{
+		{
+			name:     "instant schedule",
+			schedule: Schedule{SendAt: sendAt},
+			location: newYork,
+			want:     sendAt,
+		},
+		{
+			name:     "user timezone schedule, utc",
+			schedule: Schedule{SendAt: sendAt, InUserTimezone: true},
+			location: time.UTC,
+			want:     time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "user timezone schedule, other location",
+			schedule: Schedule{SendAt: sendAt, InUserTimezone: true},
+			location: newYork,
+			want:     time.Date(2024, 1, 2, 9, 0, 0, 0, newYork),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.schedule.sendAtIn(tt.location); !got.Equal(tt.want) {
+				t.Errorf("sendAtIn() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUser_Location(t *testing.T) {
+	if _, err := time.LoadLocation("Asia/Jakarta"); err != nil {
+		t.Skipf("timezone database unavailable: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		timezone string
+		want     string
+		wantErr  bool
+	}{
+		{name: "no timezone", want: "UTC"},
+		{name: "valid timezone", timezone: "Asia/Jakarta", want: "Asia/Jakarta"},
+		{name: "invalid timezone", timezone: "Mars/Olympus", want: "UTC", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := User{Timezone: tt.timezone}.Location()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Location() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got.String() != tt.want {
+				t.Errorf("Location() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// a timezone is loaded once
+	first, _ := User{Timezone: "Asia/Jakarta"}.Location()
+	second, _ := User{Timezone: "Asia/Jakarta"}.Location()
+	if first != second {
+		t.Errorf("Location() loaded Asia/Jakarta twice")
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memoryNotificationQueue keeps deferred notifications in memory, they are lost on restart
+type memoryNotificationQueue struct {
+	mu            sync.Mutex
+	notifications []DeferredNotification
+}
+
+func NewMemoryNotificationQueue() NotificationQueue {
+	return &memoryNotificationQueue{}
+}
+
+func (mq *memoryNotificationQueue) Push(ctx context.Context, notification DeferredNotification) (err error) {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+
+	mq.notifications = append(mq.notifications, notification)
+	return nil
+}
+
+func (mq *memoryNotificationQueue) PopDue(ctx context.Context, now time.Time) (notifications []DeferredNotification, err error) {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+
+	pending := mq.notifications[:0]
+	for _, notification := range mq.notifications {
+		if notification.SendAt.After(now) {
+			pending = append(pending, notification)
+		} else {
+			notifications = append(notifications, notification)
+		}
+	}
+	mq.notifications = pending
+	return notifications, nil
+}
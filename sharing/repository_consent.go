@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// fileConsentRepository stores the latest consent of each user, channel and topic as a JSON array in a file.
+// The consents are read once when the repository is created and kept in memory indexed by user and channel,
+// a Save writes every consent to the file before updating the memory
+type fileConsentRepository struct {
+	file     jsonFile
+	mu       sync.RWMutex
+	consents []Consent
+	// positions of the consents of each user and channel in consents, in ascending order
+	positionsByUserChannel map[consentKey][]int
+}
+
+type consentKey struct {
+	userId  int64
+	channel string
+}
+
+func NewFileConsentRepository(path string) (ConsentRepository, error) {
+	repo := &fileConsentRepository{
+		file:                   jsonFile{path: path},
+		positionsByUserChannel: make(map[consentKey][]int),
+	}
+	if err := repo.file.read(&repo.consents); err != nil {
+		return nil, err
+	}
+	for i, consent := range repo.consents {
+		key := consentKey{userId: consent.UserId, channel: consent.Channel}
+		repo.positionsByUserChannel[key] = append(repo.positionsByUserChannel[key], i)
+	}
+
+	return repo, nil
+}
+
+func (fr *fileConsentRepository) GetConsents(ctx context.Context, userId int64, channel string, topic string) (consents []Consent, err error) {
+	fr.mu.RLock()
+	defer fr.mu.RUnlock()
+
+	for _, position := range fr.positionsByUserChannel[consentKey{userId: userId, channel: channel}] {
+		if consent := fr.consents[position]; consent.Topic == topic || consent.Topic == "" {
+			consents = append(consents, consent)
+		}
+	}
+	return consents, nil
+}
+
+func (fr *fileConsentRepository) Save(ctx context.Context, consent Consent) (err error) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	key := consentKey{userId: consent.UserId, channel: consent.Channel}
+	position := len(fr.consents)
+	for _, i := range fr.positionsByUserChannel[key] {
+		if fr.consents[i].Topic == consent.Topic {
+			position = i
+			break
+		}
+	}
+
+	// the memory is only changed once the file is written
+	consents := make([]Consent, len(fr.consents), len(fr.consents)+1)
+	copy(consents, fr.consents)
+	if position == len(consents) {
+		consents = append(consents, consent)
+	} else {
+		consents[position] = consent
+	}
+	if err = fr.file.write(consents); err != nil {
+		return err
+	}
+
+	if position == len(fr.consents) {
+		fr.positionsByUserChannel[key] = append(fr.positionsByUserChannel[key], position)
+	}
+	fr.consents = consents
+	return nil
+}
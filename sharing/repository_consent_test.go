@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFileConsentRepository(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "consents.json")
+	repo, err := NewFileConsentRepository(path)
+	if err != nil {
+		t.Fatalf("NewFileConsentRepository() error = %v", err)
+	}
+
+	consents := []Consent{
+		{UserId: 1, Channel: NotificationChannelEmail, OptedIn: true},
+		{UserId: 1, Channel: NotificationChannelEmail, Topic: "promo", OptedIn: true},
+		{UserId: 1, Channel: NotificationChannelEmail, Topic: "news", OptedIn: true},
+		{UserId: 1, Channel: NotificationChannelPhone, OptedIn: true},
+		{UserId: 2, Channel: NotificationChannelEmail, OptedIn: true},
+		// replaces the first promo consent
+		{UserId: 1, Channel: NotificationChannelEmail, Topic: "promo", OptedIn: false},
+	}
+	for _, consent := range consents {
+		if err := repo.Save(ctx, consent); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+
+	got, err := repo.GetConsents(ctx, 1, NotificationChannelEmail, "promo")
+	if err != nil {
+		t.Fatalf("GetConsents() error = %v", err)
+	}
+	want := []Consent{consents[0], consents[5]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetConsents() = %v, want %v", got, want)
+	}
+
+	// the saved consents are loaded again once reopened
+	repo, err = NewFileConsentRepository(path)
+	if err != nil {
+		t.Fatalf("NewFileConsentRepository() error = %v", err)
+	}
+	if got, err = repo.GetConsents(ctx, 1, NotificationChannelEmail, "promo"); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("GetConsents() after reopen = %v, %v, want %v", got, err, want)
+	}
+}
+
+func TestFileConsentRepository_emptyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "consents.json")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := NewFileConsentRepository(path)
+	if err != nil {
+		t.Fatalf("NewFileConsentRepository() error = %v", err)
+	}
+	got, err := repo.GetConsents(context.Background(), 1, NotificationChannelEmail, "promo")
+	if err != nil || len(got) != 0 {
+		t.Errorf("GetConsents() on empty file = %v, %v, want no consents", got, err)
+	}
+}
+
+func TestFileConsentRepository_invalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "consents.json")
+	if err := os.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewFileConsentRepository(path); err == nil {
+		t.Errorf("NewFileConsentRepository() on invalid file error = nil, want error")
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/practice/sharing/util/json"
+)
+
+// fileDeliveryLogRepository stores delivery logs as JSON lines appended to a file, an update appends the whole log again.
+// The logs are read once when the repository is created and kept in memory with indexes by user and provider message id,
+// so Find never reads the file again
+type fileDeliveryLogRepository struct {
+	path   string
+	mu     sync.Mutex
+	lastId int64
+	logs   []DeliveryLog
+	// positions of each log in logs by id, user id and provider message id, in ascending order
+	positionById                 map[int64]int
+	positionsByUserId            map[int64][]int
+	positionsByProviderMessageId map[string][]int
+}
+
+func NewFileDeliveryLogRepository(path string) (DeliveryLogRepository, error) {
+	repo := &fileDeliveryLogRepository{
+		path:                         path,
+		positionById:                 make(map[int64]int),
+		positionsByUserId:            make(map[int64][]int),
+		positionsByProviderMessageId: make(map[string][]int),
+	}
+	if err := repo.load(); err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+func (fr *fileDeliveryLogRepository) Save(ctx context.Context, logs []DeliveryLog) (err error) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	lastId := fr.lastId
+	saved := make([]DeliveryLog, 0, len(logs))
+	for _, log := range logs {
+		lastId++
+		log.Id = lastId
+		saved = append(saved, log)
+	}
+	if err = fr.append(saved); err != nil {
+		return err
+	}
+
+	for _, log := range saved {
+		fr.put(log)
+	}
+	fr.lastId = lastId
+	return nil
+}
+
+func (fr *fileDeliveryLogRepository) Find(ctx context.Context, request GetDeliveryLogsRequest) (logs []DeliveryLog, err error) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	positions, indexed := fr.candidatePositions(request)
+	if !indexed {
+		for _, log := range fr.logs {
+			if request.Match(log) {
+				logs = append(logs, log)
+			}
+		}
+		return logs, nil
+	}
+	for _, position := range positions {
+		if log := fr.logs[position]; request.Match(log) {
+			logs = append(logs, log)
+		}
+	}
+
+	return logs, nil
+}
+
+// Update appends log as a new record, load keeps the last record of each id
+// so the file is never rewritten
+func (fr *fileDeliveryLogRepository) Update(ctx context.Context, log DeliveryLog) (err error) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	if _, ok := fr.positionById[log.Id]; !ok {
+		return fmt.Errorf("delivery log %d not found", log.Id)
+	}
+	if err = fr.append([]DeliveryLog{log}); err != nil {
+		return err
+	}
+
+	fr.put(log)
+	return nil
+}
+
+// candidatePositions gets the positions of the logs that may match request from the smallest index it can use,
+// indexed is false when request filters on no indexed field
+func (fr *fileDeliveryLogRepository) candidatePositions(request GetDeliveryLogsRequest) (positions []int, indexed bool) {
+	if request.UserId != 0 {
+		positions, indexed = fr.positionsByUserId[request.UserId], true
+	}
+	if request.ProviderMessageId != "" {
+		byProviderMessageId := fr.positionsByProviderMessageId[request.ProviderMessageId]
+		if !indexed || len(byProviderMessageId) < len(positions) {
+			positions, indexed = byProviderMessageId, true
+		}
+	}
+	return positions, indexed
+}
+
+// put adds log to the memory, a log already stored replaces the previous one at its position
+func (fr *fileDeliveryLogRepository) put(log DeliveryLog) {
+	position, ok := fr.positionById[log.Id]
+	if !ok {
+		position = len(fr.logs)
+		fr.positionById[log.Id] = position
+		fr.logs = append(fr.logs, log)
+		fr.positionsByUserId[log.UserId] = append(fr.positionsByUserId[log.UserId], position)
+		if log.ProviderMessageId != "" {
+			fr.positionsByProviderMessageId[log.ProviderMessageId] = append(fr.positionsByProviderMessageId[log.ProviderMessageId], position)
+		}
+		return
+	}
+
+	previous := fr.logs[position]
+	fr.logs[position] = log
+	if previous.UserId != log.UserId {
+		fr.positionsByUserId[previous.UserId] = removePosition(fr.positionsByUserId[previous.UserId], position)
+		fr.positionsByUserId[log.UserId] = insertPosition(fr.positionsByUserId[log.UserId], position)
+	}
+	if previous.ProviderMessageId != log.ProviderMessageId {
+		if previous.ProviderMessageId != "" {
+			fr.positionsByProviderMessageId[previous.ProviderMessageId] = removePosition(fr.positionsByProviderMessageId[previous.ProviderMessageId], position)
+		}
+		if log.ProviderMessageId != "" {
+			fr.positionsByProviderMessageId[log.ProviderMessageId] = insertPosition(fr.positionsByProviderMessageId[log.ProviderMessageId], position)
+		}
+	}
+}
+
+// insertPosition adds position to the ascending positions
+func insertPosition(positions []int, position int) []int {
+	i := sort.SearchInts(positions, position)
+	if i < len(positions) && positions[i] == position {
+		return positions
+	}
+	positions = append(positions, 0)
+	copy(positions[i+1:], positions[i:])
+	positions[i] = position
+	return positions
+}
+
+// removePosition removes position from the ascending positions
+func removePosition(positions []int, position int) []int {
+	i := sort.SearchInts(positions, position)
+	if i == len(positions) || positions[i] != position {
+		return positions
+	}
+	return append(positions[:i], positions[i+1:]...)
+}
+
+// append writes logs at the end of the file, one JSON line each, in a single write.
+// A failed write is truncated back to the previous file size so no record of logs is left on disk
+func (fr *fileDeliveryLogRepository) append(logs []DeliveryLog) (err error) {
+	var buffer bytes.Buffer
+	for _, log := range logs {
+		var bytesData []byte
+		bytesData, err = json.Marshal(log)
+		if err != nil {
+			return err
+		}
+		buffer.Write(bytesData)
+		buffer.WriteByte('\n')
+	}
+
+	file, err := os.OpenFile(fr.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(buffer.Bytes()); err != nil {
+		if errTruncate := file.Truncate(info.Size()); errTruncate != nil {
+			return errors.Join(err, errTruncate)
+		}
+		return err
+	}
+	return nil
+}
+
+// load reads every record of the file into the memory. Records are always written with their trailing newline,
+// a last line without one was torn by a crash or a full disk while appending and is truncated from the file
+func (fr *fileDeliveryLogRepository) load() (err error) {
+	file, err := os.Open(fr.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// a log updated after being saved has several records, the last one is kept at the position of the first
+	reader := bufio.NewReader(file)
+	var size int64
+	for {
+		line, errRead := reader.ReadBytes('\n')
+		if errors.Is(errRead, io.EOF) {
+			if len(line) > 0 {
+				return os.Truncate(fr.path, size)
+			}
+			return nil
+		}
+		if errRead != nil {
+			return errRead
+		}
+		size += int64(len(line))
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		var log DeliveryLog
+		if err = json.Unmarshal(line, &log); err != nil {
+			return fmt.Errorf("%s: record ending at byte %d: %w", fr.path, size, err)
+		}
+		fr.put(log)
+		if log.Id > fr.lastId {
+			fr.lastId = log.Id
+		}
+	}
+}
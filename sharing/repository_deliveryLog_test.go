@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileDeliveryLogRepository(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "delivery.log")
+	now := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	repo, err := NewFileDeliveryLogRepository(path)
+	if err != nil {
+		t.Fatalf("NewFileDeliveryLogRepository() error = %v", err)
+	}
+	err = repo.Save(ctx, []DeliveryLog{
+		{UserId: 1, Status: DeliveryStatusSent, CreatedAt: now},
+		{UserId: 2, Status: DeliveryStatusFailed, Message: "failed", CreatedAt: now},
+	})
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	// reopen to make sure ids continue after the stored logs
+	repo, err = NewFileDeliveryLogRepository(path)
+	if err != nil {
+		t.Fatalf("NewFileDeliveryLogRepository() error = %v", err)
+	}
+	err = repo.Save(ctx, []DeliveryLog{
+		{UserId: 1, Status: DeliveryStatusFailed, Message: "failed", CreatedAt: now.Add(1 * time.Hour)},
+	})
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		request GetDeliveryLogsRequest
+		wantIds []int64
+	}{
+		{
+			name:    "Find all",
+			request: GetDeliveryLogsRequest{},
+			wantIds: []int64{1, 2, 3},
+		},
+		{
+			name:    "Find by user id",
+			request: GetDeliveryLogsRequest{UserId: 1},
+			wantIds: []int64{1, 3},
+		},
+		{
+			name:    "Find by status",
+			request: GetDeliveryLogsRequest{Status: DeliveryStatusFailed},
+			wantIds: []int64{2, 3},
+		},
+		{
+			name:    "Find by time range",
+			request: GetDeliveryLogsRequest{From: now.Add(30 * time.Minute), To: now.Add(2 * time.Hour)},
+			wantIds: []int64{3},
+		},
+		{
+			name:    "Find by user id and status",
+			request: GetDeliveryLogsRequest{UserId: 2, Status: DeliveryStatusSent},
+			wantIds: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs, err := repo.Find(ctx, tt.request)
+			if err != nil {
+				t.Fatalf("Find() error = %v", err)
+			}
+			var gotIds []int64
+			for _, log := range logs {
+				gotIds = append(gotIds, log.Id)
+			}
+			if !reflect.DeepEqual(gotIds, tt.wantIds) {
+				t.Errorf("Find() gotIds = %v, want %v", gotIds, tt.wantIds)
+			}
+		})
+	}
+}
+
+func TestFileDeliveryLogRepository_Update(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "delivery.log")
+	repo, err := NewFileDeliveryLogRepository(path)
+	if err != nil {
+		t.Fatalf("NewFileDeliveryLogRepository() error = %v", err)
+	}
+	err = repo.Save(ctx, []DeliveryLog{
+		{UserId: 1, Status: DeliveryStatusSent},
+		{UserId: 2, Status: DeliveryStatusSent},
+	})
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	if err = repo.Update(ctx, DeliveryLog{Id: 3, Status: DeliveryStatusDelivered}); err == nil {
+		t.Errorf("Update() on unknown id error = nil, want error")
+	}
+	if err = repo.Update(ctx, DeliveryLog{Id: 2, UserId: 2, Status: DeliveryStatusDelivered}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	logs, err := repo.Find(ctx, GetDeliveryLogsRequest{})
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	want := []DeliveryLog{
+		{Id: 1, UserId: 1, Status: DeliveryStatusSent},
+		{Id: 2, UserId: 2, Status: DeliveryStatusDelivered},
+	}
+	if !reflect.DeepEqual(logs, want) {
+		t.Errorf("Find() logs = %v, want %v", logs, want)
+	}
+
+	// the update is appended and still applies once reopened
+	bytesData, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if lines := strings.Count(string(bytesData), "\n"); lines != 3 {
+		t.Errorf("file lines = %d, want 3", lines)
+	}
+	repo, err = NewFileDeliveryLogRepository(path)
+	if err != nil {
+		t.Fatalf("NewFileDeliveryLogRepository() error = %v", err)
+	}
+	if logs, err = repo.Find(ctx, GetDeliveryLogsRequest{}); err != nil || !reflect.DeepEqual(logs, want) {
+		t.Errorf("Find() after reopen logs = %v, %v, want %v", logs, err, want)
+	}
+}
+
+func TestFileDeliveryLogRepository_Find_indexed(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "delivery.log")
+	repo, err := NewFileDeliveryLogRepository(path)
+	if err != nil {
+		t.Fatalf("NewFileDeliveryLogRepository() error = %v", err)
+	}
+	err = repo.Save(ctx, []DeliveryLog{
+		{UserId: 1, Channel: NotificationChannelPhone, Status: DeliveryStatusSent, ProviderMessageId: "SM1"},
+		{UserId: 2, Channel: NotificationChannelPhone, Status: DeliveryStatusSent},
+		{UserId: 1, Channel: NotificationChannelEmail, Status: DeliveryStatusSent},
+	})
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	// the provider message id of log 2 is only known after it is saved
+	if err = repo.Update(ctx, DeliveryLog{Id: 2, UserId: 2, Channel: NotificationChannelPhone, Status: DeliveryStatusSent, ProviderMessageId: "SM2"}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	// Find is served from the memory, the file is not read again
+	if err = os.Remove(path); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		request GetDeliveryLogsRequest
+		wantIds []int64
+	}{
+		{
+			name:    "Find by user id",
+			request: GetDeliveryLogsRequest{UserId: 1},
+			wantIds: []int64{1, 3},
+		},
+		{
+			name:    "Find by provider message id set on save",
+			request: GetDeliveryLogsRequest{ProviderMessageId: "SM1"},
+			wantIds: []int64{1},
+		},
+		{
+			name:    "Find by provider message id set on update",
+			request: GetDeliveryLogsRequest{Channel: NotificationChannelPhone, ProviderMessageId: "SM2"},
+			wantIds: []int64{2},
+		},
+		{
+			name:    "Find by user id and provider message id",
+			request: GetDeliveryLogsRequest{UserId: 1, ProviderMessageId: "SM2"},
+			wantIds: nil,
+		},
+		{
+			name:    "Find by channel",
+			request: GetDeliveryLogsRequest{Channel: NotificationChannelEmail},
+			wantIds: []int64{3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs, err := repo.Find(ctx, tt.request)
+			if err != nil {
+				t.Fatalf("Find() error = %v", err)
+			}
+			var gotIds []int64
+			for _, log := range logs {
+				gotIds = append(gotIds, log.Id)
+			}
+			if !reflect.DeepEqual(gotIds, tt.wantIds) {
+				t.Errorf("Find() gotIds = %v, want %v", gotIds, tt.wantIds)
+			}
+		})
+	}
+}
+
+func TestFileDeliveryLogRepository_tornLastLine(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "delivery.log")
+	// the second record was cut while being appended
+	data := `{"id":1,"user_id":1,"status":"sent"}` + "\n" + `{"id":2,"user_id":2,"sta`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := NewFileDeliveryLogRepository(path)
+	if err != nil {
+		t.Fatalf("NewFileDeliveryLogRepository() error = %v", err)
+	}
+	if err = repo.Save(ctx, []DeliveryLog{{UserId: 3, Status: DeliveryStatusSent}}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	// the torn record is dropped and the next id continues after the complete ones
+	repo, err = NewFileDeliveryLogRepository(path)
+	if err != nil {
+		t.Fatalf("NewFileDeliveryLogRepository() after Save error = %v", err)
+	}
+	logs, err := repo.Find(ctx, GetDeliveryLogsRequest{})
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	want := []DeliveryLog{
+		{Id: 1, UserId: 1, Status: DeliveryStatusSent},
+		{Id: 2, UserId: 3, Status: DeliveryStatusSent},
+	}
+	if !reflect.DeepEqual(logs, want) {
+		t.Errorf("Find() logs = %v, want %v", logs, want)
+	}
+}
+
+func TestFileDeliveryLogRepository_invalidRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "delivery.log")
+	data := `{"id":1,"user_id":1,"status":"sent"}` + "\n" + `not a record` + "\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewFileDeliveryLogRepository(path); err == nil {
+		t.Errorf("NewFileDeliveryLogRepository() on invalid record error = nil, want error")
+	}
+}
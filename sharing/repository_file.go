@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/practice/sharing/util/json"
+)
+
+// jsonFile stores a single JSON document in a file, shared by the file repositories keeping all their records in memory
+type jsonFile struct {
+	path string
+}
+
+// read decodes the file into value, a missing or empty file leaves value untouched
+func (jf jsonFile) read(value interface{}) (err error) {
+	file, err := os.Open(jf.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err = json.Decode(file, value); errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
+
+// write replaces the file content through a temporary file, so readers never see a partial file
+func (jf jsonFile) write(value interface{}) (err error) {
+	tmpPath := jf.path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if err = json.Encode(file, value); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, jf.path)
+}
@@ -35,6 +35,36 @@ func (m *MockUserRepository) EXPECT() *MockUserRepositoryMockRecorder {
 	return m.recorder
 }
 
+// GetByAudienceAndState mocks base method.
+func (m *MockUserRepository) GetByAudienceAndState(ctx context.Context, request GetUsersByAudienceRequest) ([]User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByAudienceAndState", ctx, request)
+	ret0, _ := ret[0].([]User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByAudienceAndState indicates an expected call of GetByAudienceAndState.
+func (mr *MockUserRepositoryMockRecorder) GetByAudienceAndState(ctx, request interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByAudienceAndState", reflect.TypeOf((*MockUserRepository)(nil).GetByAudienceAndState), ctx, request)
+}
+
+// GetByIdsAndState mocks base method.
+func (m *MockUserRepository) GetByIdsAndState(ctx context.Context, request GetUsersByIdsRequest) ([]User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByIdsAndState", ctx, request)
+	ret0, _ := ret[0].([]User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByIdsAndState indicates an expected call of GetByIdsAndState.
+func (mr *MockUserRepositoryMockRecorder) GetByIdsAndState(ctx, request interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByIdsAndState", reflect.TypeOf((*MockUserRepository)(nil).GetByIdsAndState), ctx, request)
+}
+
 // GetByTypeAndState mocks base method.
 func (m *MockUserRepository) GetByTypeAndState(ctx context.Context, request GetUsersByTypeRequest) ([]User, error) {
 	m.ctrl.T.Helper()
@@ -73,6 +103,20 @@ func (m *MockCacheRepository) EXPECT() *MockCacheRepositoryMockRecorder {
 	return m.recorder
 }
 
+// Delete mocks base method.
+func (m *MockCacheRepository) Delete(ctx context.Context, key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockCacheRepositoryMockRecorder) Delete(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockCacheRepository)(nil).Delete), ctx, key)
+}
+
 // Get mocks base method.
 func (m *MockCacheRepository) Get(ctx context.Context, key string) (string, error) {
 	m.ctrl.T.Helper()
@@ -126,11 +170,12 @@ func (m *MockNotifier) EXPECT() *MockNotifierMockRecorder {
 }
 
 // Notify mocks base method.
-func (m *MockNotifier) Notify(ctx context.Context, identifier, message string) error {
+func (m *MockNotifier) Notify(ctx context.Context, identifier, message string) (string, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Notify", ctx, identifier, message)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // Notify indicates an expected call of Notify.
@@ -138,3 +183,292 @@ func (mr *MockNotifierMockRecorder) Notify(ctx, identifier, message interface{})
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Notify", reflect.TypeOf((*MockNotifier)(nil).Notify), ctx, identifier, message)
 }
+
+// MockDeliveryLogRepository is a mock of DeliveryLogRepository interface.
+type MockDeliveryLogRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockDeliveryLogRepositoryMockRecorder
+}
+
+// MockDeliveryLogRepositoryMockRecorder is the mock recorder for MockDeliveryLogRepository.
+type MockDeliveryLogRepositoryMockRecorder struct {
+	mock *MockDeliveryLogRepository
+}
+
+// NewMockDeliveryLogRepository creates a new mock instance.
+func NewMockDeliveryLogRepository(ctrl *gomock.Controller) *MockDeliveryLogRepository {
+	mock := &MockDeliveryLogRepository{ctrl: ctrl}
+	mock.recorder = &MockDeliveryLogRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockDeliveryLogRepository) EXPECT() *MockDeliveryLogRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Find mocks base method.
+func (m *MockDeliveryLogRepository) Find(ctx context.Context, request GetDeliveryLogsRequest) ([]DeliveryLog, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Find", ctx, request)
+	ret0, _ := ret[0].([]DeliveryLog)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Find indicates an expected call of Find.
+func (mr *MockDeliveryLogRepositoryMockRecorder) Find(ctx, request interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Find", reflect.TypeOf((*MockDeliveryLogRepository)(nil).Find), ctx, request)
+}
+
+// Save mocks base method.
+func (m *MockDeliveryLogRepository) Save(ctx context.Context, logs []DeliveryLog) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Save", ctx, logs)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Save indicates an expected call of Save.
+func (mr *MockDeliveryLogRepositoryMockRecorder) Save(ctx, logs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockDeliveryLogRepository)(nil).Save), ctx, logs)
+}
+
+// Update mocks base method.
+func (m *MockDeliveryLogRepository) Update(ctx context.Context, log DeliveryLog) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", ctx, log)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockDeliveryLogRepositoryMockRecorder) Update(ctx, log interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockDeliveryLogRepository)(nil).Update), ctx, log)
+}
+
+// MockScheduleRepository is a mock of ScheduleRepository interface.
+type MockScheduleRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockScheduleRepositoryMockRecorder
+}
+
+// MockScheduleRepositoryMockRecorder is the mock recorder for MockScheduleRepository.
+type MockScheduleRepositoryMockRecorder struct {
+	mock *MockScheduleRepository
+}
+
+// NewMockScheduleRepository creates a new mock instance.
+func NewMockScheduleRepository(ctrl *gomock.Controller) *MockScheduleRepository {
+	mock := &MockScheduleRepository{ctrl: ctrl}
+	mock.recorder = &MockScheduleRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockScheduleRepository) EXPECT() *MockScheduleRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method.
+func (m *MockScheduleRepository) Create(ctx context.Context, schedule Schedule) (Schedule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", ctx, schedule)
+	ret0, _ := ret[0].(Schedule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockScheduleRepositoryMockRecorder) Create(ctx, schedule interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockScheduleRepository)(nil).Create), ctx, schedule)
+}
+
+// FindPending mocks base method.
+func (m *MockScheduleRepository) FindPending(ctx context.Context) ([]Schedule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindPending", ctx)
+	ret0, _ := ret[0].([]Schedule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindPending indicates an expected call of FindPending.
+func (mr *MockScheduleRepositoryMockRecorder) FindPending(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindPending", reflect.TypeOf((*MockScheduleRepository)(nil).FindPending), ctx)
+}
+
+// GetById mocks base method.
+func (m *MockScheduleRepository) GetById(ctx context.Context, id int64) (Schedule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetById", ctx, id)
+	ret0, _ := ret[0].(Schedule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetById indicates an expected call of GetById.
+func (mr *MockScheduleRepositoryMockRecorder) GetById(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetById", reflect.TypeOf((*MockScheduleRepository)(nil).GetById), ctx, id)
+}
+
+// Update mocks base method.
+func (m *MockScheduleRepository) Update(ctx context.Context, schedule Schedule) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", ctx, schedule)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockScheduleRepositoryMockRecorder) Update(ctx, schedule interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockScheduleRepository)(nil).Update), ctx, schedule)
+}
+
+// MockNotificationQueue is a mock of NotificationQueue interface.
+type MockNotificationQueue struct {
+	ctrl     *gomock.Controller
+	recorder *MockNotificationQueueMockRecorder
+}
+
+// MockNotificationQueueMockRecorder is the mock recorder for MockNotificationQueue.
+type MockNotificationQueueMockRecorder struct {
+	mock *MockNotificationQueue
+}
+
+// NewMockNotificationQueue creates a new mock instance.
+func NewMockNotificationQueue(ctrl *gomock.Controller) *MockNotificationQueue {
+	mock := &MockNotificationQueue{ctrl: ctrl}
+	mock.recorder = &MockNotificationQueueMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockNotificationQueue) EXPECT() *MockNotificationQueueMockRecorder {
+	return m.recorder
+}
+
+// PopDue mocks base method.
+func (m *MockNotificationQueue) PopDue(ctx context.Context, now time.Time) ([]DeferredNotification, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PopDue", ctx, now)
+	ret0, _ := ret[0].([]DeferredNotification)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PopDue indicates an expected call of PopDue.
+func (mr *MockNotificationQueueMockRecorder) PopDue(ctx, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PopDue", reflect.TypeOf((*MockNotificationQueue)(nil).PopDue), ctx, now)
+}
+
+// Push mocks base method.
+func (m *MockNotificationQueue) Push(ctx context.Context, notification DeferredNotification) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Push", ctx, notification)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Push indicates an expected call of Push.
+func (mr *MockNotificationQueueMockRecorder) Push(ctx, notification interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Push", reflect.TypeOf((*MockNotificationQueue)(nil).Push), ctx, notification)
+}
+
+// MockConsentRepository is a mock of ConsentRepository interface.
+type MockConsentRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockConsentRepositoryMockRecorder
+}
+
+// MockConsentRepositoryMockRecorder is the mock recorder for MockConsentRepository.
+type MockConsentRepositoryMockRecorder struct {
+	mock *MockConsentRepository
+}
+
+// NewMockConsentRepository creates a new mock instance.
+func NewMockConsentRepository(ctrl *gomock.Controller) *MockConsentRepository {
+	mock := &MockConsentRepository{ctrl: ctrl}
+	mock.recorder = &MockConsentRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockConsentRepository) EXPECT() *MockConsentRepositoryMockRecorder {
+	return m.recorder
+}
+
+// GetConsents mocks base method.
+func (m *MockConsentRepository) GetConsents(ctx context.Context, userId int64, channel, topic string) ([]Consent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetConsents", ctx, userId, channel, topic)
+	ret0, _ := ret[0].([]Consent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetConsents indicates an expected call of GetConsents.
+func (mr *MockConsentRepositoryMockRecorder) GetConsents(ctx, userId, channel, topic interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetConsents", reflect.TypeOf((*MockConsentRepository)(nil).GetConsents), ctx, userId, channel, topic)
+}
+
+// Save mocks base method.
+func (m *MockConsentRepository) Save(ctx context.Context, consent Consent) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Save", ctx, consent)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Save indicates an expected call of Save.
+func (mr *MockConsentRepositoryMockRecorder) Save(ctx, consent interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockConsentRepository)(nil).Save), ctx, consent)
+}
+
+// MockClock is a mock of Clock interface.
+type MockClock struct {
+	ctrl     *gomock.Controller
+	recorder *MockClockMockRecorder
+}
+
+// MockClockMockRecorder is the mock recorder for MockClock.
+type MockClockMockRecorder struct {
+	mock *MockClock
+}
+
+// NewMockClock creates a new mock instance.
+func NewMockClock(ctrl *gomock.Controller) *MockClock {
+	mock := &MockClock{ctrl: ctrl}
+	mock.recorder = &MockClockMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockClock) EXPECT() *MockClockMockRecorder {
+	return m.recorder
+}
+
+// Now mocks base method.
+func (m *MockClock) Now() time.Time {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Now")
+	ret0, _ := ret[0].(time.Time)
+	return ret0
+}
+
+// Now indicates an expected call of Now.
+func (mr *MockClockMockRecorder) Now() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Now", reflect.TypeOf((*MockClock)(nil).Now))
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// fileScheduleRepository stores every schedule as a JSON array in a file
+type fileScheduleRepository struct {
+	file jsonFile
+	mu   sync.Mutex
+}
+
+func NewFileScheduleRepository(path string) ScheduleRepository {
+	return &fileScheduleRepository{file: jsonFile{path: path}}
+}
+
+func (fr *fileScheduleRepository) Create(ctx context.Context, schedule Schedule) (created Schedule, err error) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	schedules, err := fr.readAll()
+	if err != nil {
+		return Schedule{}, err
+	}
+	for _, s := range schedules {
+		if s.Id > schedule.Id {
+			schedule.Id = s.Id
+		}
+	}
+	schedule.Id++
+
+	if err = fr.writeAll(append(schedules, schedule)); err != nil {
+		return Schedule{}, err
+	}
+	return schedule, nil
+}
+
+func (fr *fileScheduleRepository) GetById(ctx context.Context, id int64) (schedule Schedule, err error) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	schedules, err := fr.readAll()
+	if err != nil {
+		return Schedule{}, err
+	}
+	for _, s := range schedules {
+		if s.Id == id {
+			return s, nil
+		}
+	}
+	return Schedule{}, nil
+}
+
+func (fr *fileScheduleRepository) Update(ctx context.Context, schedule Schedule) (err error) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	schedules, err := fr.readAll()
+	if err != nil {
+		return err
+	}
+	for i := range schedules {
+		if schedules[i].Id == schedule.Id {
+			schedules[i] = schedule
+			return fr.writeAll(schedules)
+		}
+	}
+	return fmt.Errorf("schedule %d not found", schedule.Id)
+}
+
+func (fr *fileScheduleRepository) FindPending(ctx context.Context) (schedules []Schedule, err error) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	allSchedules, err := fr.readAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, schedule := range allSchedules {
+		if schedule.Status == ScheduleStatusPending {
+			schedules = append(schedules, schedule)
+		}
+	}
+	return schedules, nil
+}
+
+func (fr *fileScheduleRepository) readAll() (schedules []Schedule, err error) {
+	err = fr.file.read(&schedules)
+	return schedules, err
+}
+
+func (fr *fileScheduleRepository) writeAll(schedules []Schedule) (err error) {
+	return fr.file.write(schedules)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileScheduleRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := NewFileScheduleRepository(filepath.Join(t.TempDir(), "schedules.json"))
+	sendAt := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	first, err := repo.Create(ctx, Schedule{Message: "first", SendAt: sendAt, Status: ScheduleStatusPending})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	second, err := repo.Create(ctx, Schedule{Message: "second", SendAt: sendAt, Status: ScheduleStatusPending})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if first.Id != 1 || second.Id != 2 {
+		t.Fatalf("Create() ids = %v, %v, want 1, 2", first.Id, second.Id)
+	}
+
+	first.Status = ScheduleStatusCancelled
+	if err = repo.Update(ctx, first); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if err = repo.Update(ctx, Schedule{Id: 3}); err == nil {
+		t.Errorf("Update() on unknown id error = nil, want error")
+	}
+
+	got, err := repo.GetById(ctx, first.Id)
+	if err != nil || !reflect.DeepEqual(got, first) {
+		t.Errorf("GetById() = %v, %v, want %v", got, err, first)
+	}
+	got, err = repo.GetById(ctx, 3)
+	if err != nil || got.Id != 0 {
+		t.Errorf("GetById() on unknown id = %v, %v, want empty schedule", got, err)
+	}
+
+	pending, err := repo.FindPending(ctx)
+	if err != nil || !reflect.DeepEqual(pending, []Schedule{second}) {
+		t.Errorf("FindPending() = %v, %v, want %v", pending, err, []Schedule{second})
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/practice/sharing/util/custerror"
+	"github.com/practice/sharing/util/logger"
+)
+
+// Scheduler stores NotifyUsersByType requests to be sent later and sends them once they are due
+type Scheduler struct {
+	userService        *UserService
+	scheduleRepository ScheduleRepository
+	clock              Clock
+}
+
+func NewScheduler(userService *UserService, scheduleRepository ScheduleRepository, clock Clock) *Scheduler {
+	if clock == nil {
+		clock = SystemClock()
+	}
+	return &Scheduler{
+		userService:        userService,
+		scheduleRepository: scheduleRepository,
+		clock:              clock,
+	}
+}
+
+// Schedule stores a request to notify users by type at SendAt
+func (s *Scheduler) Schedule(ctx context.Context, request ScheduleNotifyUsersByTypeRequest) (schedule Schedule, err error) {
+	// validate request
+	if err = s.userService.getValidator().Validate(request); err != nil {
+		return schedule, err
+	}
+	if err = s.userService.getUserTypeRegistry().Validate(request.notifyUsersByTypeRequest().audience().UserTypes...); err != nil {
+		return schedule, err
+	}
+
+	now := s.clock.Now()
+	schedule = Schedule{
+		Message:        request.Message,
+		UserType:       request.UserType,
+		Audience:       request.Audience,
+		Topic:          request.Topic,
+		SendAt:         request.SendAt,
+		InUserTimezone: request.InUserTimezone,
+		Status:         ScheduleStatusPending,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if !schedule.lastSendAt().After(now) {
+		return Schedule{}, custerror.NewBadRequest("send at should be in the future")
+	}
+
+	start := time.Now()
+	schedule, err = s.scheduleRepository.Create(ctx, schedule)
+	s.userService.observeRepository(RepositorySchedule, "Create", start)
+	if err != nil {
+		return Schedule{}, s.userService.repositoryError(RepositorySchedule, "Create", err)
+	}
+
+	return schedule, nil
+}
+
+// Cancel stops a pending schedule from being sent
+func (s *Scheduler) Cancel(ctx context.Context, id int64) (err error) {
+	schedule, err := s.getPendingSchedule(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	schedule.Status = ScheduleStatusCancelled
+	schedule.UpdatedAt = s.clock.Now()
+	start := time.Now()
+	err = s.scheduleRepository.Update(ctx, schedule)
+	s.userService.observeRepository(RepositorySchedule, "Update", start)
+	if err != nil {
+		return s.userService.repositoryError(RepositorySchedule, "Update", err)
+	}
+
+	return nil
+}
+
+// Reschedule moves a pending schedule to sendAt, a schedule already sent to some timezones cannot be
+// rescheduled since those timezones would be notified twice
+func (s *Scheduler) Reschedule(ctx context.Context, id int64, sendAt time.Time) (schedule Schedule, err error) {
+	schedule, err = s.getPendingSchedule(ctx, id)
+	if err != nil {
+		return Schedule{}, err
+	}
+	if len(schedule.SentTimezones) > 0 {
+		return Schedule{}, custerror.NewBadRequest("schedule is partly sent, cancel it instead", custerror.WithCode(ErrorCodeSchedulePartlySent))
+	}
+
+	now := s.clock.Now()
+	schedule.SendAt = sendAt
+	schedule.UpdatedAt = now
+	if !schedule.lastSendAt().After(now) {
+		return Schedule{}, custerror.NewBadRequest("send at should be in the future")
+	}
+
+	start := time.Now()
+	err = s.scheduleRepository.Update(ctx, schedule)
+	s.userService.observeRepository(RepositorySchedule, "Update", start)
+	if err != nil {
+		return Schedule{}, s.userService.repositoryError(RepositorySchedule, "Update", err)
+	}
+
+	return schedule, nil
+}
+
+// Start runs due schedules every interval until ctx is done
+func (s *Scheduler) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.RunDue(ctx); err != nil {
+				s.userService.getLogger().Error(ctx, "run due schedules failed", logger.FieldError, err)
+			}
+		}
+	}
+}
+
+// RunDue sends every pending schedule that is due, a schedule failing with an error not caused by
+// the request, e.g. an internal error or an unavailable dependency, is retried on the next run
+func (s *Scheduler) RunDue(ctx context.Context) (err error) {
+	start := time.Now()
+	schedules, err := s.scheduleRepository.FindPending(ctx)
+	s.userService.observeRepository(RepositorySchedule, "FindPending", start)
+	if err != nil {
+		return s.userService.repositoryError(RepositorySchedule, "FindPending", err)
+	}
+
+	for _, schedule := range schedules {
+		now := s.clock.Now()
+		if now.Before(schedule.firstSendAt()) {
+			continue
+		}
+
+		// the schedule id is only added to the logged entries, dependencies keep getting ctx
+		logCtx := logger.WithFields(ctx, "schedule_id", schedule.Id)
+		var sentTimezones []string
+		sentTimezones, err = s.send(ctx, schedule, now)
+		if err != nil && !custerror.IsClientError(err) {
+			s.userService.getLogger().Error(logCtx, "send schedule failed, retrying on next run", logger.FieldError, err)
+			continue
+		} else if err != nil {
+			s.userService.getLogger().Warn(logCtx, "send schedule failed", logger.FieldError, err)
+		}
+
+		schedule.SentTimezones = append(schedule.SentTimezones, sentTimezones...)
+		if err != nil || !now.Before(schedule.lastSendAt()) {
+			schedule.Status = ScheduleStatusDone
+		}
+		schedule.UpdatedAt = now
+		start = time.Now()
+		err = s.scheduleRepository.Update(ctx, schedule)
+		s.userService.observeRepository(RepositorySchedule, "Update", start)
+		if err != nil {
+			s.userService.countRepositoryError(RepositorySchedule, "Update")
+			s.userService.getLogger().Error(logCtx, "update schedule failed", logger.FieldError, err)
+		}
+	}
+
+	return nil
+}
+
+// send notifies the users a schedule is due for, InUserTimezone schedules only notify
+// users in timezones already past their wall clock SendAt and not notified yet
+func (s *Scheduler) send(ctx context.Context, schedule Schedule, now time.Time) (sentTimezones []string, err error) {
+	request := schedule.notifyUsersByTypeRequest()
+	if !schedule.InUserTimezone {
+		_, err = s.userService.NotifyUsersByType(ctx, request)
+		return nil, err
+	}
+
+	sent := make(map[string]bool, len(schedule.SentTimezones))
+	for _, timezone := range schedule.SentTimezones {
+		sent[timezone] = true
+	}
+	due := make(map[string]bool)
+	_, err = s.userService.notifyUsersByType(ctx, request, func(user User) bool {
+		location := s.userService.userLocation(ctx, user)
+		if sent[location.String()] {
+			return false
+		}
+		if now.Before(schedule.sendAtIn(location)) {
+			return false
+		}
+		due[location.String()] = true
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for timezone := range due {
+		sentTimezones = append(sentTimezones, timezone)
+	}
+	sort.Strings(sentTimezones)
+	return sentTimezones, nil
+}
+
+func (s *Scheduler) getPendingSchedule(ctx context.Context, id int64) (schedule Schedule, err error) {
+	start := time.Now()
+	schedule, err = s.scheduleRepository.GetById(ctx, id)
+	s.userService.observeRepository(RepositorySchedule, "GetById", start)
+	if err != nil {
+		return Schedule{}, s.userService.repositoryError(RepositorySchedule, "GetById", err)
+	}
+	if schedule.Id == 0 {
+		return Schedule{}, custerror.NewNotFound("schedule not found", custerror.WithCode(ErrorCodeScheduleNotFound))
+	}
+	if schedule.Status != ScheduleStatusPending {
+		return Schedule{}, custerror.NewBadRequest("schedule is " + schedule.Status)
+	}
+	return schedule, nil
+}
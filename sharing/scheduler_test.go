@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/practice/sharing/util/custerror"
+)
+
+type schedulerMocks struct {
+	userServiceMocks
+	scheduleRepository *MockScheduleRepository
+	clock              *MockClock
+}
+
+func newSchedulerMocks(ctrl *gomock.Controller) schedulerMocks {
+	return schedulerMocks{
+		userServiceMocks: userServiceMocks{
+			userRepository:  NewMockUserRepository(ctrl),
+			cacheRepository: NewMockCacheRepository(ctrl),
+			emailNotifier:   NewMockNotifier(ctrl),
+			phoneNotifier:   NewMockNotifier(ctrl),
+		},
+		scheduleRepository: NewMockScheduleRepository(ctrl),
+		clock:              NewMockClock(ctrl),
+	}
+}
+
+func newTestScheduler(mocks schedulerMocks) *Scheduler {
+	return NewScheduler(&UserService{
+		userRepository:  mocks.userRepository,
+		cacheRepository: mocks.cacheRepository,
+		phoneNotifier:   mocks.phoneNotifier,
+		emailNotifier:   mocks.emailNotifier,
+		clock:           mocks.clock,
+	}, mocks.scheduleRepository, mocks.clock)
+}
+
+func TestScheduler_Schedule(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	request := ScheduleNotifyUsersByTypeRequest{
+		Message:  "message",
+		UserType: UserTypePremium,
+		SendAt:   now.Add(1 * time.Hour),
+	}
+	pastRequest := request
+	pastRequest.SendAt = now.Add(-1 * time.Hour)
+	pastInUserTimezoneRequest := pastRequest
+	pastInUserTimezoneRequest.InUserTimezone = true
+	schedule := Schedule{
+		Message:   request.Message,
+		UserType:  request.UserType,
+		SendAt:    request.SendAt,
+		Status:    ScheduleStatusPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	createdSchedule := schedule
+	createdSchedule.Id = 1
+
+	tests := []struct {
+		name         string
+		request      ScheduleNotifyUsersByTypeRequest
+		setupMocks   func(mocks schedulerMocks)
+		wantSchedule Schedule
+		wantErr      error
+	}{
+		{
+			name:    "Schedule fail, error validator.Validate",
+			request: ScheduleNotifyUsersByTypeRequest{Message: "message", UserType: UserTypePremium},
+			wantErr: custerror.NewBadRequest("send at should not be empty"),
+		},
+		{
+			name:    "Schedule fail, send at in the past",
+			request: pastRequest,
+			setupMocks: func(mocks schedulerMocks) {
+				mocks.clock.EXPECT().Now().Return(now)
+			},
+			wantErr: custerror.NewBadRequest("send at should be in the future"),
+		},
+		{
+			name:    "Schedule fail, error scheduleRepository.Create",
+			request: request,
+			setupMocks: func(mocks schedulerMocks) {
+				mocks.clock.EXPECT().Now().Return(now)
+				mocks.scheduleRepository.EXPECT().Create(ctx, schedule).Return(Schedule{}, errors.New("failed"))
+			},
+			wantErr: custerror.NewInternal("failed"),
+		},
+		{
+			name:    "Schedule success, send at passed in UTC but not yet in every user timezone",
+			request: pastInUserTimezoneRequest,
+			setupMocks: func(mocks schedulerMocks) {
+				inUserTimezoneSchedule := schedule
+				inUserTimezoneSchedule.SendAt = pastInUserTimezoneRequest.SendAt
+				inUserTimezoneSchedule.InUserTimezone = true
+				mocks.clock.EXPECT().Now().Return(now)
+				mocks.scheduleRepository.EXPECT().Create(ctx, inUserTimezoneSchedule).Return(inUserTimezoneSchedule, nil)
+			},
+			wantSchedule: Schedule{
+				Message:        request.Message,
+				UserType:       request.UserType,
+				SendAt:         pastInUserTimezoneRequest.SendAt,
+				InUserTimezone: true,
+				Status:         ScheduleStatusPending,
+				CreatedAt:      now,
+				UpdatedAt:      now,
+			},
+		},
+		{
+			name:    "Schedule success",
+			request: request,
+			setupMocks: func(mocks schedulerMocks) {
+				mocks.clock.EXPECT().Now().Return(now)
+				mocks.scheduleRepository.EXPECT().Create(ctx, schedule).Return(createdSchedule, nil)
+			},
+			wantSchedule: createdSchedule,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mocks := newSchedulerMocks(ctrl)
+			if tt.setupMocks != nil {
+				tt.setupMocks(mocks)
+			}
+
+			gotSchedule, err := newTestScheduler(mocks).Schedule(ctx, tt.request)
+			if !assertErr(err, tt.wantErr) {
+				t.Errorf("Schedule() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(gotSchedule, tt.wantSchedule) {
+				t.Errorf("Schedule() gotSchedule = %v, want %v", gotSchedule, tt.wantSchedule)
+			}
+		})
+	}
+}
+
+func TestScheduler_CancelAndReschedule(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	schedule := Schedule{
+		Id:       1,
+		Message:  "message",
+		UserType: UserTypePremium,
+		SendAt:   now.Add(1 * time.Hour),
+		Status:   ScheduleStatusPending,
+	}
+	doneSchedule := schedule
+	doneSchedule.Status = ScheduleStatusDone
+	partlySentSchedule := schedule
+	partlySentSchedule.InUserTimezone = true
+	partlySentSchedule.SentTimezones = []string{"Asia/Jakarta"}
+
+	tests := []struct {
+		name       string
+		run        func(s *Scheduler) error
+		setupMocks func(mocks schedulerMocks)
+		wantErr    error
+	}{
+		{
+			name: "Cancel fail, schedule not found",
+			run:  func(s *Scheduler) error { return s.Cancel(ctx, 1) },
+			setupMocks: func(mocks schedulerMocks) {
+				mocks.scheduleRepository.EXPECT().GetById(ctx, int64(1)).Return(Schedule{}, nil)
+			},
+			wantErr: custerror.NewNotFound("schedule not found"),
+		},
+		{
+			name: "Cancel fail, schedule already done",
+			run:  func(s *Scheduler) error { return s.Cancel(ctx, 1) },
+			setupMocks: func(mocks schedulerMocks) {
+				mocks.scheduleRepository.EXPECT().GetById(ctx, int64(1)).Return(doneSchedule, nil)
+			},
+			wantErr: custerror.NewBadRequest("schedule is done"),
+		},
+		{
+			name: "Cancel success",
+			run:  func(s *Scheduler) error { return s.Cancel(ctx, 1) },
+			setupMocks: func(mocks schedulerMocks) {
+				cancelledSchedule := schedule
+				cancelledSchedule.Status = ScheduleStatusCancelled
+				cancelledSchedule.UpdatedAt = now
+				mocks.scheduleRepository.EXPECT().GetById(ctx, int64(1)).Return(schedule, nil)
+				mocks.clock.EXPECT().Now().Return(now)
+				mocks.scheduleRepository.EXPECT().Update(ctx, cancelledSchedule).Return(nil)
+			},
+		},
+		{
+			name: "Reschedule fail, send at in the past",
+			run: func(s *Scheduler) error {
+				_, err := s.Reschedule(ctx, 1, now.Add(-1*time.Minute))
+				return err
+			},
+			setupMocks: func(mocks schedulerMocks) {
+				mocks.scheduleRepository.EXPECT().GetById(ctx, int64(1)).Return(schedule, nil)
+				mocks.clock.EXPECT().Now().Return(now)
+			},
+			wantErr: custerror.NewBadRequest("send at should be in the future"),
+		},
+		{
+			name: "Reschedule fail, schedule partly sent",
+			run: func(s *Scheduler) error {
+				_, err := s.Reschedule(ctx, 1, now.Add(2*time.Hour))
+				return err
+			},
+			setupMocks: func(mocks schedulerMocks) {
+				mocks.scheduleRepository.EXPECT().GetById(ctx, int64(1)).Return(partlySentSchedule, nil)
+			},
+			wantErr: custerror.NewBadRequest("schedule is partly sent, cancel it instead"),
+		},
+		{
+			name: "Reschedule success",
+			run: func(s *Scheduler) error {
+				_, err := s.Reschedule(ctx, 1, now.Add(2*time.Hour))
+				return err
+			},
+			setupMocks: func(mocks schedulerMocks) {
+				rescheduled := schedule
+				rescheduled.SendAt = now.Add(2 * time.Hour)
+				rescheduled.UpdatedAt = now
+				mocks.scheduleRepository.EXPECT().GetById(ctx, int64(1)).Return(schedule, nil)
+				mocks.clock.EXPECT().Now().Return(now)
+				mocks.scheduleRepository.EXPECT().Update(ctx, rescheduled).Return(nil)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mocks := newSchedulerMocks(ctrl)
+			tt.setupMocks(mocks)
+
+			if err := tt.run(newTestScheduler(mocks)); !assertErr(err, tt.wantErr) {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScheduler_RunDue(t *testing.T) {
+	ctx := context.Background()
+	sendAt := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	cacheKey := getCacheKeyActiveUsersByType(UserTypePremium)
+	usersJson := `[{"id": 1, "email": "jakarta@test.mail", "score": 60, "timezone": "Asia/Jakarta"},
+		{"id": 2, "email": "utc@test.mail", "score": 60},
+		{"id": 3, "email": "new_york@test.mail", "score": 60, "timezone": "America/New_York"}]`
+	schedule := Schedule{
+		Id:       1,
+		Message:  "message",
+		UserType: UserTypePremium,
+		SendAt:   sendAt,
+		Status:   ScheduleStatusPending,
+	}
+	inUserTimezoneSchedule := schedule
+	inUserTimezoneSchedule.InUserTimezone = true
+
+	tests := []struct {
+		name       string
+		setupMocks func(mocks schedulerMocks)
+		wantErr    error
+	}{
+		{
+			name: "RunDue fail, error scheduleRepository.FindPending",
+			setupMocks: func(mocks schedulerMocks) {
+				mocks.scheduleRepository.EXPECT().FindPending(ctx).Return(nil, errors.New("failed"))
+			},
+			wantErr: custerror.NewInternal("failed"),
+		},
+		{
+			name: "RunDue skips schedule not due yet",
+			setupMocks: func(mocks schedulerMocks) {
+				mocks.scheduleRepository.EXPECT().FindPending(ctx).Return([]Schedule{schedule}, nil)
+				mocks.clock.EXPECT().Now().Return(sendAt.Add(-1 * time.Minute))
+			},
+		},
+		{
+			name: "RunDue keeps schedule pending on internal error",
+			setupMocks: func(mocks schedulerMocks) {
+				mocks.scheduleRepository.EXPECT().FindPending(ctx).Return([]Schedule{schedule}, nil)
+				mocks.clock.EXPECT().Now().Return(sendAt)
+				mocks.cacheRepository.EXPECT().Get(ctx, cacheKey).Return("", errors.New("failed"))
+				mocks.userRepository.EXPECT().GetByTypeAndState(ctx, gomock.Any()).Return(nil, errors.New("failed"))
+			},
+		},
+		{
+			name: "RunDue sends due schedule and marks it done",
+			setupMocks: func(mocks schedulerMocks) {
+				doneSchedule := schedule
+				doneSchedule.Status = ScheduleStatusDone
+				doneSchedule.UpdatedAt = sendAt
+				mocks.scheduleRepository.EXPECT().FindPending(ctx).Return([]Schedule{schedule}, nil)
+				mocks.clock.EXPECT().Now().Return(sendAt).AnyTimes()
+				mocks.cacheRepository.EXPECT().Get(ctx, cacheKey).Return(usersJson, nil)
+				mocks.emailNotifier.EXPECT().Notify(ctx, gomock.Any(), schedule.Message).Return("", nil).Times(3)
+				mocks.scheduleRepository.EXPECT().Update(ctx, doneSchedule).Return(nil)
+			},
+		},
+		{
+			name: "RunDue sends in user timezone schedule only to timezones past send at",
+			setupMocks: func(mocks schedulerMocks) {
+				// 09:00 in UTC is already past 09:00 in Asia/Jakarta but not in America/New_York
+				partialSchedule := inUserTimezoneSchedule
+				partialSchedule.SentTimezones = []string{"Asia/Jakarta", "UTC"}
+				partialSchedule.UpdatedAt = sendAt
+				mocks.scheduleRepository.EXPECT().FindPending(ctx).Return([]Schedule{inUserTimezoneSchedule}, nil)
+				mocks.clock.EXPECT().Now().Return(sendAt).AnyTimes()
+				mocks.cacheRepository.EXPECT().Get(ctx, cacheKey).Return(usersJson, nil)
+				mocks.emailNotifier.EXPECT().Notify(ctx, "jakarta@test.mail", schedule.Message).Return("", nil)
+				mocks.emailNotifier.EXPECT().Notify(ctx, "utc@test.mail", schedule.Message).Return("", nil)
+				mocks.scheduleRepository.EXPECT().Update(ctx, partialSchedule).Return(nil)
+			},
+		},
+		{
+			name: "RunDue finishes in user timezone schedule once past send at in every timezone",
+			setupMocks: func(mocks schedulerMocks) {
+				now := sendAt.Add(TimezoneMaxOffsetBehind)
+				partialSchedule := inUserTimezoneSchedule
+				partialSchedule.SentTimezones = []string{"Asia/Jakarta", "UTC"}
+				doneSchedule := partialSchedule
+				doneSchedule.SentTimezones = []string{"Asia/Jakarta", "UTC", "America/New_York"}
+				doneSchedule.Status = ScheduleStatusDone
+				doneSchedule.UpdatedAt = now
+				mocks.scheduleRepository.EXPECT().FindPending(ctx).Return([]Schedule{partialSchedule}, nil)
+				mocks.clock.EXPECT().Now().Return(now).AnyTimes()
+				mocks.cacheRepository.EXPECT().Get(ctx, cacheKey).Return(usersJson, nil)
+				mocks.emailNotifier.EXPECT().Notify(ctx, "new_york@test.mail", schedule.Message).Return("", nil)
+				mocks.scheduleRepository.EXPECT().Update(ctx, doneSchedule).Return(nil)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mocks := newSchedulerMocks(ctrl)
+			tt.setupMocks(mocks)
+
+			if err := newTestScheduler(mocks).RunDue(ctx); !assertErr(err, tt.wantErr) {
+				t.Errorf("RunDue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
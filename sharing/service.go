@@ -2,10 +2,17 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
 
+	"github.com/practice/sharing/util/codec"
 	"github.com/practice/sharing/util/custerror"
 	"github.com/practice/sharing/util/json"
+	"github.com/practice/sharing/util/logger"
+	"github.com/practice/sharing/util/metrics"
+	"github.com/practice/sharing/util/tracing"
 	"github.com/practice/sharing/util/validator"
 )
 
@@ -14,12 +21,97 @@ type UserService struct {
 	cacheRepository CacheRepository
 	phoneNotifier   Notifier
 	emailNotifier   Notifier
+
+	// deliveryLogRepository records every delivery, GetDeliveryLogs and IngestDeliveryReceipt fail as not configured when nil
+	deliveryLogRepository DeliveryLogRepository
+	clock                 Clock
+
+	// quietHours holds phone notifications outside the allowed user local hours, disabled when nil
+	quietHours *QuietHours
+	// notificationQueue holds the deferred phone notifications, SendDeferred fails as not configured when nil
+	notificationQueue NotificationQueue
+
+	// userTypeRegistry rejects unknown user types, the built in types are known when nil
+	userTypeRegistry *UserTypeRegistry
+
+	// consentRepository is consulted before notifying each user, every user is considered opted in
+	// and RecordConsent fails as not configured when nil
+	consentRepository ConsentRepository
+
+	// contactPolicy checks the user contact before notifying, contacts are not checked when nil
+	contactPolicy *ContactPolicy
+
+	// logger writes failures not returned to the caller, logger.Default when nil
+	logger logger.Logger
+	// metrics records cache, repository and notifier measurements, discarded when nil
+	metrics metrics.Metrics
+	// tracer traces the notification pipeline, not traced when nil
+	tracer tracing.Tracer
+
+	// concurrency is the number of users notified at once, users are notified one by one when 1 or less
+	concurrency int
+	// cachePolicy decides how long and under which keys active users are cached, each unset value falls back to its default
+	cachePolicy CachePolicy
+	// cacheRefreshes tracks the stale keys being refreshed in the background
+	cacheRefreshes refreshSet
+	// cacheGenerations tracks the invalidations of each key so users loaded before one are not cached after it
+	cacheGenerations cacheGenerations
+	// jsonHandler encodes the cached users and HTTP bodies, the json package handler when nil
+	jsonHandler json.Handler
+	// validator validates requests, the validator package handler when nil
+	validator validator.Handler
+
+	// emailScoreThreshold is the score users are notified by email above, EmailScoreThreshold when nil
+	emailScoreThreshold *int
 }
 
 // NotifyUsersByType notifies a Message to users identified by UserType
 func (us *UserService) NotifyUsersByType(ctx context.Context, request NotifyUsersByTypeRequest) (resp NotifyUsersByTypeResponse, err error) {
+	return us.notifyUsersByType(ctx, request, nil)
+}
+
+// NotifyUsers notifies a Message to active users identified by UserIds, ids without an active user are reported as failed
+func (us *UserService) NotifyUsers(ctx context.Context, request NotifyUsersRequest) (resp NotifyUsersByTypeResponse, err error) {
 	// validate request
-	if err = validator.Validate(request); err != nil {
+	if err = us.getValidator().Validate(request); err != nil {
+		return resp, err
+	}
+
+	// get users
+	var users []User
+	start := time.Now()
+	users, err = us.userRepository.GetByIdsAndState(ctx, createGetActiveUsersByIdsRequest(request.UserIds))
+	us.observeRepository(RepositoryUser, "GetByIdsAndState", start)
+	if err != nil {
+		return resp, us.repositoryError(RepositoryUser, "GetByIdsAndState", err)
+	}
+	users = us.normalizeContacts(users)
+
+	// notify users
+	resp = us.notifyUsers(ctx, users, request.Message, request.Topic)
+	resp.FailedNotifyUsers = append(resp.FailedNotifyUsers, getMissingUserResults(request.UserIds, users)...)
+
+	// record delivery logs
+	us.saveDeliveryLogs(ctx, request.notifyUsersByTypeRequest(), users, resp)
+
+	return resp, nil
+}
+
+// notifyUsersByType notifies a Message to users identified by UserType, only to users accepted by filter when set
+func (us *UserService) notifyUsersByType(ctx context.Context, request NotifyUsersByTypeRequest, filter func(user User) bool) (resp NotifyUsersByTypeResponse, err error) {
+	ctx, span := us.getTracer().Start(ctx, "UserService.NotifyUsersByType",
+		tracing.NewAttribute(AttributeUserType, string(request.UserType)), tracing.NewAttribute(AttributeTopic, request.Topic))
+	defer func() {
+		span.SetAttributes(
+			tracing.NewAttribute(AttributeSuccessCount, len(resp.SuccessNotifyUsers)),
+			tracing.NewAttribute(AttributeFailedCount, len(resp.FailedNotifyUsers)),
+		)
+		span.RecordError(err)
+		span.End()
+	}()
+
+	// validate request
+	if err = us.getValidator().Validate(request); err != nil {
 		return resp, err
 	}
 
@@ -29,78 +121,945 @@ func (us *UserService) NotifyUsersByType(ctx context.Context, request NotifyUser
 	if err != nil {
 		return resp, err
 	}
+	if filter != nil {
+		users = filterUsers(users, filter)
+	}
+	users = us.normalizeContacts(users)
 
 	// notify users
-	resp = us.notifyUsers(ctx, users, request.Message)
+	resp = us.notifyUsers(ctx, users, request.Message, request.Topic)
+
+	// record delivery logs
+	us.saveDeliveryLogs(ctx, request, users, resp)
 
 	return resp, nil
 }
 
-// getActiveUsersByType gets active users by type from cache or database if not exist in cache
+// RetryFailed notifies again only the users that failed in a previous NotifyUsersByType or NotifyUsers,
+// resolved again by id so users deactivated or deleted since are not notified,
+// the result keeps every previous result but the failures, which are replaced by the retried ones
+func (us *UserService) RetryFailed(ctx context.Context, request RetryFailedRequest) (resp NotifyUsersByTypeResponse, err error) {
+	// validate request
+	if err = us.getValidator().Validate(request); err != nil {
+		return resp, err
+	}
+
+	// get users
+	var users []User
+	start := time.Now()
+	users, err = us.userRepository.GetByIdsAndState(ctx, createGetActiveUsersByIdsRequest(request.failedUserIds()))
+	us.observeRepository(RepositoryUser, "GetByIdsAndState", start)
+	if err != nil {
+		return resp, us.repositoryError(RepositoryUser, "GetByIdsAndState", err)
+	}
+	failedUsers, missingResults := filterFailedUsers(users, request.PreviousResponse.FailedNotifyUsers)
+	failedUsers = us.normalizeContacts(failedUsers)
+
+	// notify users
+	retryResp := us.notifyUsers(ctx, failedUsers, request.Message, request.Topic)
+
+	// record delivery logs
+	us.saveDeliveryLogs(ctx, request.notifyUsersByTypeRequest(), failedUsers, retryResp)
+
+	resp.SuccessNotifyUsers = append(resp.SuccessNotifyUsers, request.PreviousResponse.SuccessNotifyUsers...)
+	resp.SuccessNotifyUsers = append(resp.SuccessNotifyUsers, retryResp.SuccessNotifyUsers...)
+	resp.FailedNotifyUsers = append(retryResp.FailedNotifyUsers, missingResults...)
+	resp.DeferredNotifyUsers = append(append(resp.DeferredNotifyUsers, request.PreviousResponse.DeferredNotifyUsers...), retryResp.DeferredNotifyUsers...)
+	resp.SkippedNotifyUsers = append(append(resp.SkippedNotifyUsers, request.PreviousResponse.SkippedNotifyUsers...), retryResp.SkippedNotifyUsers...)
+	resp.UnsubscribedNotifyUsers = append(append(resp.UnsubscribedNotifyUsers, request.PreviousResponse.UnsubscribedNotifyUsers...), retryResp.UnsubscribedNotifyUsers...)
+	resp.InvalidContactNotifyUsers = append(append(resp.InvalidContactNotifyUsers, request.PreviousResponse.InvalidContactNotifyUsers...), retryResp.InvalidContactNotifyUsers...)
+
+	return resp, nil
+}
+
+// SendDeferred sends the phone notifications deferred by quiet hours that are due, unless the user opted out
+// or the contact became invalid meanwhile, notifications failing with a retryable error are deferred again by DeferredRetryDelay
+// until they are sent DeferredMaxAttempts times
+func (us *UserService) SendDeferred(ctx context.Context) (resp NotifyUsersByTypeResponse, err error) {
+	if us.notificationQueue == nil {
+		return resp, notConfiguredError("notification queue")
+	}
+
+	now := us.now()
+	start := time.Now()
+	notifications, err := us.notificationQueue.PopDue(ctx, now)
+	us.observeRepository(RepositoryNotificationQueue, "PopDue", start)
+	if err != nil {
+		return resp, us.repositoryError(RepositoryNotificationQueue, "PopDue", err)
+	}
+
+	logs := make([]DeliveryLog, 0, len(notifications))
+	for _, notification := range notifications {
+		deliveryLog := DeliveryLog{
+			UserId:         notification.UserId,
+			UserType:       notification.UserType,
+			Channel:        NotificationChannelPhone,
+			Identifier:     notification.Identifier,
+			RequestMessage: notification.Message,
+			Topic:          notification.Topic,
+			Status:         DeliveryStatusSent,
+			CreatedAt:      now,
+		}
+		// consent and contact may have changed since the notification was deferred
+		if status, reason := us.checkRecipient(ctx, notification.user(), NotificationChannelPhone, notification.Topic); status != "" {
+			resp.add(status, NotifyUserResult{UserId: notification.UserId, Message: reason})
+			deliveryLog.Status = status
+			deliveryLog.Message = reason
+			logs = append(logs, deliveryLog)
+			continue
+		}
+
+		messageId, errNotify := us.notify(ctx, NotificationChannelPhone, notification.Identifier, notification.Message)
+		if custerror.IsRetryable(errNotify) {
+			notification.Attempts++
+			if notification.Attempts >= DeferredMaxAttempts {
+				errNotify = custerror.WrapInternal(errNotify, fmt.Sprintf("failed after %d attempts: %s", notification.Attempts, errNotify))
+			} else {
+				notification.SendAt = now.Add(DeferredRetryDelay)
+				start = time.Now()
+				errNotify = us.notificationQueue.Push(ctx, notification)
+				us.observeRepository(RepositoryNotificationQueue, "Push", start)
+				if errNotify != nil {
+					us.countRepositoryError(RepositoryNotificationQueue, "Push")
+				}
+				if errNotify == nil {
+					deliveryLog.Status = DeliveryStatusDeferred
+					deliveryLog.Message = "deferred until " + notification.SendAt.Format(time.RFC3339)
+					resp.DeferredNotifyUsers = append(resp.DeferredNotifyUsers, NotifyUserResult{
+						UserId:  notification.UserId,
+						Message: deliveryLog.Message,
+					})
+					logs = append(logs, deliveryLog)
+					continue
+				}
+			}
+		}
+		if errNotify != nil {
+			resp.FailedNotifyUsers = append(resp.FailedNotifyUsers, NotifyUserResult{
+				UserId:  notification.UserId,
+				Message: errNotify.Error(),
+			})
+			deliveryLog.Status = DeliveryStatusFailed
+			deliveryLog.Message = errNotify.Error()
+		} else {
+			resp.SuccessNotifyUsers = append(resp.SuccessNotifyUsers, NotifyUserResult{
+				UserId:            notification.UserId,
+				ProviderMessageId: messageId,
+			})
+			deliveryLog.ProviderMessageId = messageId
+		}
+		logs = append(logs, deliveryLog)
+	}
+
+	if us.deliveryLogRepository != nil && len(logs) > 0 {
+		start = time.Now()
+		errSave := us.deliveryLogRepository.Save(ctx, logs)
+		us.observeRepository(RepositoryDeliveryLog, "Save", start)
+		if errSave != nil {
+			us.countRepositoryError(RepositoryDeliveryLog, "Save")
+			us.getLogger().Error(ctx, "save deferred delivery logs failed", logger.FieldError, errSave, "count", len(logs))
+		}
+	}
+
+	return resp, nil
+}
+
+// RecordConsent records a user opting in or out of a channel, for a single topic or every topic when Topic is empty
+func (us *UserService) RecordConsent(ctx context.Context, request RecordConsentRequest) (consent Consent, err error) {
+	// validate request
+	if err = us.getValidator().Validate(request); err != nil {
+		return consent, err
+	}
+	if us.consentRepository == nil {
+		return consent, notConfiguredError("consent")
+	}
+
+	consent = Consent{
+		UserId:    request.UserId,
+		Channel:   request.Channel,
+		Topic:     request.Topic,
+		OptedIn:   request.OptedIn,
+		UpdatedAt: us.now(),
+	}
+	start := time.Now()
+	err = us.consentRepository.Save(ctx, consent)
+	us.observeRepository(RepositoryConsent, "Save", start)
+	if err != nil {
+		return Consent{}, us.repositoryError(RepositoryConsent, "Save", err)
+	}
+
+	return consent, nil
+}
+
+// InvalidateUserType removes the cached active users of userType, along with the audiences including it
+// cached by this instance, so the next notification reads them from the database
+func (us *UserService) InvalidateUserType(ctx context.Context, userType UserType) (err error) {
+	// validate user type
+	if err = us.getUserTypeRegistry().Validate(userType); err != nil {
+		return err
+	}
+
+	return us.invalidateUserTypes(ctx, userType)
+}
+
+// OnUserChanged invalidates the cached active users of the previous and current type of a changed user,
+// event producers call it whenever a user is created, updated or deleted
+func (us *UserService) OnUserChanged(ctx context.Context, request UserChangedRequest) (err error) {
+	// validate request
+	if err = us.getValidator().Validate(request); err != nil {
+		return err
+	}
+
+	return us.invalidateUserTypes(ctx, request.userTypes()...)
+}
+
+// GetDeliveryLogs gets recorded notification deliveries filtered by user id, status and time range
+func (us *UserService) GetDeliveryLogs(ctx context.Context, request GetDeliveryLogsRequest) (logs []DeliveryLog, err error) {
+	// validate request
+	if err = us.getValidator().Validate(request); err != nil {
+		return nil, err
+	}
+	if us.deliveryLogRepository == nil {
+		return nil, notConfiguredError("delivery log")
+	}
+
+	start := time.Now()
+	logs, err = us.deliveryLogRepository.Find(ctx, request)
+	us.observeRepository(RepositoryDeliveryLog, "Find", start)
+	if err != nil {
+		return nil, us.repositoryError(RepositoryDeliveryLog, "Find", err)
+	}
+
+	return logs, nil
+}
+
+// IngestDeliveryReceipt updates the delivery of the receipt provider message id with the status reported by the provider
+func (us *UserService) IngestDeliveryReceipt(ctx context.Context, request DeliveryReceiptRequest) (deliveryLog DeliveryLog, err error) {
+	// validate request
+	if err = us.getValidator().Validate(request); err != nil {
+		return deliveryLog, err
+	}
+	if us.deliveryLogRepository == nil {
+		return deliveryLog, notConfiguredError("delivery log")
+	}
+
+	// get delivery
+	var logs []DeliveryLog
+	start := time.Now()
+	logs, err = us.deliveryLogRepository.Find(ctx, GetDeliveryLogsRequest{
+		Channel:           request.Channel,
+		ProviderMessageId: request.ProviderMessageId,
+	})
+	us.observeRepository(RepositoryDeliveryLog, "Find", start)
+	if err != nil {
+		return deliveryLog, us.repositoryError(RepositoryDeliveryLog, "Find", err)
+	}
+	if len(logs) == 0 {
+		return deliveryLog, custerror.NewNotFound("delivery not found",
+			custerror.WithCode(ErrorCodeDeliveryNotFound), custerror.WithDetail("provider_message_id", request.ProviderMessageId))
+	}
+	deliveryLog = getLatestDeliveryLog(logs)
+
+	// receipts may be delivered more than once
+	if deliveryLog.Status == request.Status {
+		return deliveryLog, nil
+	}
+	if !canTransitionDeliveryStatus(deliveryLog.Status, request.Status) {
+		return deliveryLog, custerror.NewBadRequest(fmt.Sprintf("delivery status can not change from %s to %s", deliveryLog.Status, request.Status),
+			custerror.WithCode(ErrorCodeDeliveryStatusTransition))
+	}
+
+	// update delivery
+	deliveryLog.Status = request.Status
+	deliveryLog.Message = request.Reason
+	deliveryLog.UpdatedAt = us.now()
+	start = time.Now()
+	err = us.deliveryLogRepository.Update(ctx, deliveryLog)
+	us.observeRepository(RepositoryDeliveryLog, "Update", start)
+	if err != nil {
+		return DeliveryLog{}, us.repositoryError(RepositoryDeliveryLog, "Update", err)
+	}
+
+	return deliveryLog, nil
+}
+
+// getActiveUsersByType gets active users by type or audience from cache or database if not exist in cache,
+// users cached longer than the soft ttl are returned while refreshed in the background
 func (us *UserService) getActiveUsersByType(ctx context.Context, request NotifyUsersByTypeRequest) (users []User, err error) {
+	// validate user types
+	audience := request.audience()
+	if err = us.getUserTypeRegistry().Validate(audience.UserTypes...); err != nil {
+		return nil, err
+	}
+
 	// get from cache
 	var usersJson string
-	cacheKey := getCacheKeyActiveUsersByType(request.UserType)
-	usersJson, err = us.cacheRepository.Get(ctx, cacheKey)
+	var cachedAt time.Time
+	var cacheKey string
+	cacheKey, err = us.cacheKey(ctx, audience)
 	if err == nil {
-		err = json.Unmarshal([]byte(usersJson), &users)
-		if err != nil {
-			return nil, custerror.NewInternal(err.Error())
-		} else {
+		usersJson, err = us.getCache(ctx, cacheKey)
+	}
+	if err == nil {
+		users, cachedAt, err = decodeCachedUsers(us.getCacheCodec(), usersJson)
+		if err == nil {
+			us.getMetrics().Inc(MetricCacheHitsTotal)
+			if us.cachePolicy.isStale(cachedAt, us.now()) {
+				us.getMetrics().Inc(MetricCacheStaleTotal)
+				us.refreshActiveUsers(ctx, request, cacheKey)
+			}
 			return users, nil
 		}
+		// an undecodable entry is overwritten with the users from the database
+		us.getLogger().Warn(ctx, "decode users cache failed", logger.FieldError, err, "key", cacheKey, logger.FieldUserType, audience.UserTypes)
+	}
+	us.getMetrics().Inc(MetricCacheMissesTotal)
+	// an unavailable cache is not written back until it recovers
+	cacheUnavailable := custerror.IsRetryable(err)
+	if cacheUnavailable {
+		us.countRepositoryError(RepositoryCache, "Get")
+		us.getLogger().Warn(ctx, "cache unavailable", logger.FieldError, err, "key", cacheKey, logger.FieldUserType, audience.UserTypes)
 	}
 
 	// get from database
-	getUsersReq := createGetActiveUsersByTypeRequest(request)
-	users, err = us.userRepository.GetByTypeAndState(ctx, getUsersReq)
+	generation := us.cacheGenerations.get(cacheKey)
+	users, err = us.loadActiveUsers(ctx, audience, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if cacheUnavailable {
+		return users, nil
+	}
+	go us.setActiveUsersCache(ctx, audience, cacheKey, users, generation)
+
+	return users, nil
+}
+
+// loadActiveUsers gets active users by type or audience from database
+func (us *UserService) loadActiveUsers(ctx context.Context, audience AudienceFilter, request NotifyUsersByTypeRequest) (users []User, err error) {
+	operation := "GetByTypeAndState"
+	if !audience.isSingleType() {
+		operation = "GetByAudienceAndState"
+	}
+	dbCtx, dbSpan := us.getTracer().Start(ctx, "UserRepository."+operation)
+	start := time.Now()
+	if audience.isSingleType() {
+		users, err = us.userRepository.GetByTypeAndState(dbCtx, createGetActiveUsersByTypeRequest(request))
+	} else {
+		users, err = us.userRepository.GetByAudienceAndState(dbCtx, createGetActiveUsersByAudienceRequest(audience))
+	}
+	us.observeRepository(RepositoryUser, operation, start)
+	dbSpan.SetAttributes(tracing.NewAttribute(AttributeUserCount, len(users)))
+	dbSpan.RecordError(err)
+	dbSpan.End()
 	if err != nil || users == nil {
 		if err == nil {
 			return nil, custerror.NewNotFound("users not found")
 		}
-		return nil, custerror.NewInternal(err.Error())
+		return nil, us.repositoryError(RepositoryUser, operation, err)
+	}
+	return users, nil
+}
+
+// cacheKey gets the cache key of audience, a multi type audience is keyed by the generations of its user types
+// read from the cache, an unavailable cache is returned as an error and a missing generation is empty
+func (us *UserService) cacheKey(ctx context.Context, audience AudienceFilter) (key string, err error) {
+	cachePolicy := us.getCachePolicy()
+	if audience.isSingleType() {
+		return cachePolicy.keyByType(audience.UserTypes[0]), nil
+	}
+
+	userTypes := generationTypes(audience)
+	generations := make([]string, len(userTypes))
+	for i, userType := range userTypes {
+		generations[i], err = us.getCache(ctx, cachePolicy.generationKey(userType))
+		if custerror.IsRetryable(err) {
+			return "", err
+		}
+	}
+	return cachePolicy.key(audience, generations), nil
+}
+
+// setActiveUsersCache caches users loaded at generation under cacheKey for the audience ttl, failures are only logged,
+// users are not cached when cacheKey was invalidated since they were loaded
+func (us *UserService) setActiveUsersCache(ctx context.Context, audience AudienceFilter, cacheKey string, users []User, generation uint64) {
+	if us.cacheGenerations.get(cacheKey) != generation {
+		return
+	}
+
+	bytesData, errMarshal := encodeCachedUsers(us.getCacheCodec(), users, us.cachePolicy.SoftTtl > 0, us.now())
+	if errMarshal != nil {
+		us.getLogger().Error(ctx, "marshal users for cache failed", logger.FieldError, errMarshal, "key", cacheKey, logger.FieldUserType, audience.UserTypes)
+		return
+	}
+	start := time.Now()
+	errSet := us.cacheRepository.Set(ctx, cacheKey, string(bytesData), us.cachePolicy.ttl(audience))
+	us.observeRepository(RepositoryCache, "Set", start)
+	if errSet != nil {
+		us.countRepositoryError(RepositoryCache, "Set")
+		us.getLogger().Error(ctx, "set users cache failed", logger.FieldError, errSet, "key", cacheKey, logger.FieldUserType, audience.UserTypes)
+		return
+	}
+
+	// an invalidation deleting cacheKey while it was being set is deleted again
+	if us.cacheGenerations.get(cacheKey) != generation {
+		start = time.Now()
+		errDelete := us.cacheRepository.Delete(ctx, cacheKey)
+		us.observeRepository(RepositoryCache, "Delete", start)
+		if errDelete != nil {
+			us.countRepositoryError(RepositoryCache, "Delete")
+			us.getLogger().Error(ctx, "delete users cache failed", logger.FieldError, errDelete, "key", cacheKey)
+		}
+	}
+}
+
+// refreshActiveUsers reloads stale cached users in the background, at most once at a time per key,
+// the refresh outlives ctx so it is not cancelled once the request returns
+func (us *UserService) refreshActiveUsers(ctx context.Context, request NotifyUsersByTypeRequest, cacheKey string) {
+	if !us.cacheRefreshes.start(cacheKey) {
+		return
 	}
 
+	ctx = context.WithoutCancel(ctx)
 	go func() {
-		bytesData, errMarshal := json.Marshal(users)
-		if errMarshal != nil {
-			log.Println(errMarshal.Error(), "users", users)
+		defer us.cacheRefreshes.done(cacheKey)
+
+		audience := request.audience()
+		generation := us.cacheGenerations.get(cacheKey)
+		users, err := us.loadActiveUsers(ctx, audience, request)
+		if err != nil {
+			us.getLogger().Warn(ctx, "refresh users cache failed", logger.FieldError, err, "key", cacheKey, logger.FieldUserType, audience.UserTypes)
 			return
 		}
-		if errSet := us.cacheRepository.Set(ctx, cacheKey, string(bytesData), CacheTtlActiveUserByType); errSet != nil {
-			log.Println(errSet.Error(), "key", cacheKey)
+		us.setActiveUsersCache(ctx, audience, cacheKey, users, generation)
+	}()
+}
+
+// notifyUsers notifies a message to users by phone or email based on their score, up to concurrency users at once,
+// results keep the order of users
+func (us *UserService) notifyUsers(ctx context.Context, users []User, message string, topic string) (resp NotifyUsersByTypeResponse) {
+	statuses := make([]string, len(users))
+	results := make([]NotifyUserResult, len(users))
+	notifyUser := func(i int) {
+		statuses[i], results[i] = us.notifyUser(ctx, users[i], message, topic)
+	}
+
+	if us.concurrency <= 1 {
+		for i := range users {
+			notifyUser(i)
+		}
+	} else {
+		var wg sync.WaitGroup
+		semaphore := make(chan struct{}, us.concurrency)
+		for i := range users {
+			wg.Add(1)
+			semaphore <- struct{}{}
+			go func(i int) {
+				defer wg.Done()
+				defer func() { <-semaphore }()
+				notifyUser(i)
+			}(i)
 		}
+		wg.Wait()
+	}
+
+	for i := range users {
+		resp.add(statuses[i], results[i])
+	}
+	return resp
+}
+
+// notifyUser notifies a message to user and gets the delivery status of the result,
+// users with an invalid contact or opted out of the channel or topic are not notified and
+// phone notifications during the user quiet hours are deferred or skipped
+func (us *UserService) notifyUser(ctx context.Context, user User, message string, topic string) (status string, result NotifyUserResult) {
+	result.UserId = user.Id
+	channel := getNotificationChannel(user, us.getEmailScoreThreshold())
+	if status, result.Message = us.checkRecipient(ctx, user, channel, topic); status != "" {
+		return status, result
+	}
+
+	if channel == NotificationChannelPhone {
+		if localTime, quiet := us.inQuietHours(ctx, user); quiet {
+			return us.holdPhoneNotification(ctx, user, message, topic, localTime)
+		}
+	}
+	var err error
+	if result.ProviderMessageId, err = us.notify(ctx, channel, getNotificationIdentifier(user, channel), message); err != nil {
+		result.Message = err.Error()
+		return DeliveryStatusFailed, result
+	}
+	return DeliveryStatusSent, result
+}
+
+// checkRecipient gets the status and reason of a user that should not be notified by channel for topic,
+// an invalid contact or an opt out, status is empty when the user can be notified
+func (us *UserService) checkRecipient(ctx context.Context, user User, channel string, topic string) (status string, reason string) {
+	if us.contactPolicy != nil {
+		if errContact := us.contactPolicy.check(user, channel); errContact != nil {
+			return DeliveryStatusInvalidContact, errContact.Error()
+		}
+	}
+
+	optedIn, err := us.isOptedIn(ctx, user, channel, topic)
+	if err != nil {
+		return DeliveryStatusFailed, err.Error()
+	}
+	if !optedIn {
+		return DeliveryStatusUnsubscribed, "opted out of " + channel
+	}
+	return "", ""
+}
+
+// notify sends message to identifier with the notifier of channel in its own span,
+// counting the result and latency per channel
+func (us *UserService) notify(ctx context.Context, channel string, identifier string, message string) (messageId string, err error) {
+	notifier := us.phoneNotifier
+	if channel == NotificationChannelEmail {
+		notifier = us.emailNotifier
+	}
+
+	ctx, span := us.getTracer().Start(ctx, "Notifier.Notify", tracing.NewAttribute(AttributeChannel, channel))
+	defer func() {
+		span.RecordError(err)
+		span.End()
 	}()
 
-	return users, nil
+	start := time.Now()
+	messageId, err = notifier.Notify(ctx, identifier, message)
+	channelLabel := metrics.NewLabel(MetricLabelChannel, channel)
+	us.getMetrics().Observe(MetricNotifyDurationSeconds, time.Since(start).Seconds(), channelLabel)
+	status := MetricStatusSuccess
+	if err != nil {
+		status = MetricStatusFailure
+	}
+	us.getMetrics().Inc(MetricNotifyTotal, channelLabel, metrics.NewLabel(MetricLabelStatus, status))
+	return messageId, err
 }
 
-// notifyUsers notifies a message to users by phone or email based on their score
-func (us *UserService) notifyUsers(ctx context.Context, users []User, message string) (resp NotifyUsersByTypeResponse) {
+// isOptedIn checks the user consent, a consent for topic takes precedence over a consent for every topic
+// and users without any consent are opted in
+func (us *UserService) isOptedIn(ctx context.Context, user User, channel string, topic string) (optedIn bool, err error) {
+	if us.consentRepository == nil {
+		return true, nil
+	}
+
+	start := time.Now()
+	consents, err := us.consentRepository.GetConsents(ctx, user.Id, channel, topic)
+	us.observeRepository(RepositoryConsent, "GetConsents", start)
+	if err != nil {
+		us.countRepositoryError(RepositoryConsent, "GetConsents")
+		return false, err
+	}
+
+	optedIn = true
+	for _, consent := range consents {
+		if consent.Topic == topic {
+			return consent.OptedIn, nil
+		}
+		if consent.Topic == "" {
+			optedIn = consent.OptedIn
+		}
+	}
+	return optedIn, nil
+}
+
+// inQuietHours reports whether it is currently quiet hours for user, along with the user local time
+func (us *UserService) inQuietHours(ctx context.Context, user User) (localTime time.Time, quiet bool) {
+	if us.quietHours == nil {
+		return localTime, false
+	}
+	localTime = us.now().In(us.userLocation(ctx, user))
+	return localTime, us.quietHours.contains(localTime)
+}
+
+// userLocation gets the user timezone, falling back to UTC with a warning when it is invalid
+func (us *UserService) userLocation(ctx context.Context, user User) *time.Location {
+	location, err := user.Location()
+	if err != nil {
+		us.getLogger().Warn(ctx, "invalid user timezone, using UTC", logger.FieldError, err, "user_id", user.Id, "timezone", user.Timezone)
+	}
+	return location
+}
+
+// holdPhoneNotification defers or skips a phone notification during quiet hours based on the quiet hours action
+func (us *UserService) holdPhoneNotification(ctx context.Context, user User, message string, topic string, localTime time.Time) (status string, result NotifyUserResult) {
+	result.UserId = user.Id
+	sendAt := us.quietHours.nextEnd(localTime)
+	if us.quietHours.Action == QuietHoursActionSkip {
+		result.Message = "quiet hours until " + sendAt.Format(time.RFC3339)
+		return DeliveryStatusSkipped, result
+	}
+
+	start := time.Now()
+	err := us.notificationQueue.Push(ctx, DeferredNotification{
+		UserId:     user.Id,
+		UserType:   user.Type,
+		Identifier: user.PhoneNumber,
+		Message:    message,
+		Topic:      topic,
+		SendAt:     sendAt,
+	})
+	us.observeRepository(RepositoryNotificationQueue, "Push", start)
+	if err != nil {
+		us.countRepositoryError(RepositoryNotificationQueue, "Push")
+		result.Message = err.Error()
+		return DeliveryStatusFailed, result
+	}
+	result.Message = "deferred until " + sendAt.Format(time.RFC3339)
+	return DeliveryStatusDeferred, result
+}
+
+// normalizeContacts gets a copy of users with their contacts normalized by the contact policy
+func (us *UserService) normalizeContacts(users []User) []User {
+	if us.contactPolicy == nil || !us.contactPolicy.NormalizePhoneNumber {
+		return users
+	}
+
+	normalized := make([]User, 0, len(users))
 	for _, user := range users {
-		var err error
-		if user.Score > 50 {
-			err = us.emailNotifier.Notify(ctx, user.Email, message)
-		} else {
-			err = us.phoneNotifier.Notify(ctx, user.PhoneNumber, message)
+		normalized = append(normalized, us.contactPolicy.normalize(user))
+	}
+	return normalized
+}
+
+// saveDeliveryLogs stores every notify result of a request, failing to store does not fail the request
+func (us *UserService) saveDeliveryLogs(ctx context.Context, request NotifyUsersByTypeRequest, users []User, resp NotifyUsersByTypeResponse) {
+	if us.deliveryLogRepository == nil {
+		return
+	}
+
+	logs := createDeliveryLogs(request, users, resp, us.now(), us.getEmailScoreThreshold())
+	if len(logs) == 0 {
+		return
+	}
+	start := time.Now()
+	err := us.deliveryLogRepository.Save(ctx, logs)
+	us.observeRepository(RepositoryDeliveryLog, "Save", start)
+	if err != nil {
+		us.countRepositoryError(RepositoryDeliveryLog, "Save")
+		us.getLogger().Error(ctx, "save delivery logs failed", logger.FieldError, err, "count", len(logs), logger.FieldUserType, request.audience().UserTypes)
+	}
+}
+
+// invalidateUserTypes deletes the cache keys of userTypes and bumps their generations, along with the generation
+// of the audiences of any type, so the multi type audiences cached by every instance are not read anymore,
+// every key is deleted and every generation bumped even when one fails
+func (us *UserService) invalidateUserTypes(ctx context.Context, userTypes ...UserType) (err error) {
+	cachePolicy := us.getCachePolicy()
+	var keys []string
+	var generationKeys []string
+	seen := make(map[UserType]bool)
+	for _, userType := range append(userTypes, anyUserType) {
+		if seen[userType] {
+			continue
 		}
-		if err != nil {
-			resp.FailedNotifyUsers = append(resp.FailedNotifyUsers, NotifyUserResult{
-				UserId:  user.Id,
-				Message: err.Error(),
+		seen[userType] = true
+		if userType != anyUserType {
+			keys = append(keys, cachePolicy.keyByType(userType))
+		}
+		generationKeys = append(generationKeys, cachePolicy.generationKey(userType))
+	}
+
+	// generations outlive the users cached before them, so an expired generation never reads them again
+	for _, key := range generationKeys {
+		start := time.Now()
+		errSet := us.cacheRepository.Set(ctx, key, newCacheGeneration(), cachePolicy.longestTtl())
+		us.observeRepository(RepositoryCache, "Set", start)
+		if errSet != nil {
+			us.getLogger().Error(ctx, "bump users cache generation failed", logger.FieldError, errSet, "key", key)
+			if err == nil {
+				err = us.repositoryError(RepositoryCache, "Set", errSet)
+			} else {
+				us.countRepositoryError(RepositoryCache, "Set")
+			}
+		}
+	}
+
+	for _, key := range keys {
+		us.cacheGenerations.bump(key)
+		start := time.Now()
+		errDelete := us.cacheRepository.Delete(ctx, key)
+		us.observeRepository(RepositoryCache, "Delete", start)
+		if errDelete != nil {
+			us.getLogger().Error(ctx, "delete users cache failed", logger.FieldError, errDelete, "key", key)
+			if err == nil {
+				err = us.repositoryError(RepositoryCache, "Delete", errDelete)
+			} else {
+				us.countRepositoryError(RepositoryCache, "Delete")
+			}
+		}
+	}
+	return err
+}
+
+// getUserTypeRegistry gets the registry of known user types, falling back to the built in types when not set
+func (us *UserService) getUserTypeRegistry() *UserTypeRegistry {
+	if us.userTypeRegistry == nil {
+		return defaultUserTypeRegistry
+	}
+	return us.userTypeRegistry
+}
+
+// getCache gets key from cache in its own span
+func (us *UserService) getCache(ctx context.Context, key string) (response string, err error) {
+	ctx, span := us.getTracer().Start(ctx, "CacheRepository.Get", tracing.NewAttribute(AttributeCacheKey, key))
+	defer span.End()
+
+	start := time.Now()
+	response, err = us.cacheRepository.Get(ctx, key)
+	us.observeRepository(RepositoryCache, "Get", start)
+	span.SetAttributes(tracing.NewAttribute(AttributeCacheHit, err == nil))
+	return response, err
+}
+
+// repositoryError counts the failed call to a repository and wraps its error
+func (us *UserService) repositoryError(repository string, operation string, err error) error {
+	us.countRepositoryError(repository, operation)
+	return wrapDependencyError(err)
+}
+
+// observeRepository records the latency of a repository call started at start
+func (us *UserService) observeRepository(repository string, operation string, start time.Time) {
+	us.getMetrics().Observe(MetricRepositoryDurationSeconds, time.Since(start).Seconds(),
+		metrics.NewLabel(MetricLabelRepository, repository), metrics.NewLabel(MetricLabelOperation, operation))
+}
+
+func (us *UserService) countRepositoryError(repository string, operation string) {
+	us.getMetrics().Inc(MetricRepositoryErrorsTotal,
+		metrics.NewLabel(MetricLabelRepository, repository), metrics.NewLabel(MetricLabelOperation, operation))
+}
+
+// getMetrics gets metrics, falling back to metrics.Noop when not set
+func (us *UserService) getMetrics() metrics.Metrics {
+	if us.metrics == nil {
+		return metrics.Noop()
+	}
+	return us.metrics
+}
+
+// getJson gets jsonHandler, falling back to the json package handler when not set
+func (us *UserService) getJson() json.Handler {
+	if us.jsonHandler == nil {
+		return json.Instance()
+	}
+	return us.jsonHandler
+}
+
+// getValidator gets validator, falling back to the validator package handler when not set
+func (us *UserService) getValidator() validator.Handler {
+	if us.validator == nil {
+		return validator.Instance()
+	}
+	return us.validator
+}
+
+// getCachePolicy gets cachePolicy with the codec of getCacheCodec, so the cache keys name the codec the users are encoded with
+func (us *UserService) getCachePolicy() CachePolicy {
+	cachePolicy := us.cachePolicy
+	cachePolicy.Codec = us.getCacheCodec()
+	return cachePolicy
+}
+
+// getCacheCodec gets the cache policy codec, falling back to jsonHandler when set then to the codec package handler
+func (us *UserService) getCacheCodec() codec.Handler {
+	if us.cachePolicy.Codec == nil && us.jsonHandler != nil {
+		return codec.Json(us.jsonHandler)
+	}
+	return us.cachePolicy.codec()
+}
+
+// getEmailScoreThreshold gets emailScoreThreshold, falling back to EmailScoreThreshold when not set
+func (us *UserService) getEmailScoreThreshold() int {
+	if us.emailScoreThreshold == nil {
+		return EmailScoreThreshold
+	}
+	return *us.emailScoreThreshold
+}
+
+// getTracer gets tracer, falling back to tracing.Noop when not set
+func (us *UserService) getTracer() tracing.Tracer {
+	if us.tracer == nil {
+		return tracing.Noop()
+	}
+	return us.tracer
+}
+
+// getLogger gets logger, falling back to logger.Default when not set
+func (us *UserService) getLogger() logger.Logger {
+	if us.logger == nil {
+		return logger.Default()
+	}
+	return us.logger
+}
+
+// now gets the current time from clock, falling back to the system time when clock is not set
+func (us *UserService) now() time.Time {
+	if us.clock == nil {
+		return time.Now()
+	}
+	return us.clock.Now()
+}
+
+// wrapDependencyError keeps an error a dependency classified as retryable,
+// a context deadline becomes a Timeout and any other error an Internal
+func wrapDependencyError(err error) error {
+	if custerror.IsRetryable(err) {
+		return err
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return custerror.WrapTimeout(err, "")
+	}
+	return custerror.WrapInternal(err, "")
+}
+
+// notConfiguredError reports a call needing an optional dependency the service was built without,
+// an Internal error since it is a setup mistake that retrying never fixes
+func notConfiguredError(dependency string) error {
+	return custerror.NewInternal(dependency+" not configured", custerror.WithCode(ErrorCodeNotConfigured))
+}
+
+func filterUsers(users []User, filter func(user User) bool) (filtered []User) {
+	for _, user := range users {
+		if filter(user) {
+			filtered = append(filtered, user)
+		}
+	}
+	return filtered
+}
+
+// getNotificationChannel decides the channel used to notify user based on their score
+func getNotificationChannel(user User, emailScoreThreshold int) string {
+	if user.Score > emailScoreThreshold {
+		return NotificationChannelEmail
+	}
+	return NotificationChannelPhone
+}
+
+// getNotificationIdentifier gets the user contact used by channel
+func getNotificationIdentifier(user User, channel string) string {
+	if channel == NotificationChannelEmail {
+		return user.Email
+	}
+	return user.PhoneNumber
+}
+
+func createDeliveryLogs(request NotifyUsersByTypeRequest, users []User, resp NotifyUsersByTypeResponse, now time.Time, emailScoreThreshold int) []DeliveryLog {
+	usersById := make(map[int64]User, len(users))
+	for _, user := range users {
+		usersById[user.Id] = user
+	}
+
+	logs := make([]DeliveryLog, 0, len(resp.FailedNotifyUsers)+len(resp.SuccessNotifyUsers)+len(resp.DeferredNotifyUsers)+len(resp.SkippedNotifyUsers)+len(resp.UnsubscribedNotifyUsers)+len(resp.InvalidContactNotifyUsers))
+	appendLogs := func(results []NotifyUserResult, status string) {
+		for _, result := range results {
+			// results of users not found were never sent
+			user, ok := usersById[result.UserId]
+			if !ok {
+				continue
+			}
+			channel := getNotificationChannel(user, emailScoreThreshold)
+			logs = append(logs, DeliveryLog{
+				UserId:            result.UserId,
+				UserType:          user.Type,
+				Channel:           channel,
+				Identifier:        getNotificationIdentifier(user, channel),
+				RequestMessage:    request.Message,
+				Topic:             request.Topic,
+				Status:            status,
+				Message:           result.Message,
+				ProviderMessageId: result.ProviderMessageId,
+				CreatedAt:         now,
 			})
-		} else {
-			resp.SuccessNotifyUsers = append(resp.SuccessNotifyUsers, NotifyUserResult{
-				UserId: user.Id,
+		}
+	}
+	appendLogs(resp.FailedNotifyUsers, DeliveryStatusFailed)
+	appendLogs(resp.SuccessNotifyUsers, DeliveryStatusSent)
+	appendLogs(resp.DeferredNotifyUsers, DeliveryStatusDeferred)
+	appendLogs(resp.SkippedNotifyUsers, DeliveryStatusSkipped)
+	appendLogs(resp.UnsubscribedNotifyUsers, DeliveryStatusUnsubscribed)
+	appendLogs(resp.InvalidContactNotifyUsers, DeliveryStatusInvalidContact)
+
+	return logs
+}
+
+// filterFailedUsers picks the users with a failed result, failed users no longer active are returned as failed results
+func filterFailedUsers(users []User, failedResults []NotifyUserResult) (failedUsers []User, missingResults []NotifyUserResult) {
+	usersById := make(map[int64]User, len(users))
+	for _, user := range users {
+		usersById[user.Id] = user
+	}
+
+	seen := make(map[int64]bool, len(failedResults))
+	for _, result := range failedResults {
+		if seen[result.UserId] {
+			continue
+		}
+		seen[result.UserId] = true
+
+		user, ok := usersById[result.UserId]
+		if !ok {
+			missingResults = append(missingResults, NotifyUserResult{
+				UserId:  result.UserId,
+				Message: "user is no longer active",
 			})
+			continue
 		}
+		failedUsers = append(failedUsers, user)
 	}
-	return resp
+	return failedUsers, missingResults
+}
+
+// getMissingUserResults gets a failed result for every id without a user
+func getMissingUserResults(ids []int64, users []User) (results []NotifyUserResult) {
+	found := make(map[int64]bool, len(users))
+	for _, user := range users {
+		found[user.Id] = true
+	}
+
+	for _, id := range ids {
+		if found[id] {
+			continue
+		}
+		found[id] = true
+		results = append(results, NotifyUserResult{
+			UserId:  id,
+			Message: "user not found",
+		})
+	}
+	return results
+}
+
+func getLatestDeliveryLog(logs []DeliveryLog) DeliveryLog {
+	latest := logs[0]
+	for _, log := range logs[1:] {
+		if log.Id > latest.Id {
+			latest = log
+		}
+	}
+	return latest
 }
 
 func createGetActiveUsersByTypeRequest(request NotifyUsersByTypeRequest) GetUsersByTypeRequest {
 	return GetUsersByTypeRequest{
-		UserType:  request.UserType,
+		UserType:  request.audience().UserTypes[0],
+		IsDeleted: false,
+		IsActive:  true,
+	}
+}
+
+func createGetActiveUsersByIdsRequest(ids []int64) GetUsersByIdsRequest {
+	return GetUsersByIdsRequest{
+		Ids:       ids,
+		IsDeleted: false,
+		IsActive:  true,
+	}
+}
+
+func createGetActiveUsersByAudienceRequest(audience AudienceFilter) GetUsersByAudienceRequest {
+	return GetUsersByAudienceRequest{
+		Audience:  audience,
 		IsDeleted: false,
 		IsActive:  true,
 	}
@@ -1,15 +1,19 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/golang/mock/gomock"
+	"github.com/practice/sharing/util/codec"
 	"github.com/practice/sharing/util/custerror"
 	"github.com/practice/sharing/util/json"
+	"github.com/practice/sharing/util/metrics"
 )
 
 type getActiveUsersByTypeTestParam struct {
@@ -25,22 +29,32 @@ type getActiveUsersByTypeTestResult struct {
 	cleanupFunc func()
 }
 
-// getActiveUsersByType_fail_errUnmarshal defines failure, caused by error json.Unmarshal
+// getActiveUsersByType_succ_errUnmarshal defines success with error json.Unmarshal, the undecodable entry
+// is a cache miss overwritten with the users from the database
 // (when trying to get from cache)
-func getActiveUsersByType_fail_errUnmarshal(req getActiveUsersByTypeTestParam) (result getActiveUsersByTypeTestResult) {
+func getActiveUsersByType_succ_errUnmarshal(req getActiveUsersByTypeTestParam) (result getActiveUsersByTypeTestResult) {
 	cacheKey := getCacheKeyActiveUsersByType(req.request.UserType)
+	getUsersReq := createGetActiveUsersByTypeRequest(req.request)
 	cacheGetResp := ""
-	unmarshalErr := errors.New("failed")
+	var cachedUsers []User
+	resp := []User{{Id: 1, Type: UserTypePremium, Score: 60}}
+	respString := `[{"id":1,"type":"premium","score":60}]`
 
 	req.mocks.cacheRepository.EXPECT().Get(req.ctx, cacheKey).
 		Return(cacheGetResp, nil)
 	json.SetHandler(req.mocks.jsonHandler)
-	req.mocks.jsonHandler.EXPECT().Unmarshal([]byte(cacheGetResp), &result.expectedRes).
-		Return(unmarshalErr)
+	req.mocks.jsonHandler.EXPECT().Unmarshal([]byte(cacheGetResp), &cachedUsers).
+		Return(errors.New("failed"))
+	req.mocks.userRepository.EXPECT().GetByTypeAndState(req.ctx, getUsersReq).
+		Return(resp, nil)
+	req.mocks.jsonHandler.EXPECT().Marshal(resp).
+		Return([]byte(respString), nil)
+	req.mocks.cacheRepository.EXPECT().Set(req.ctx, cacheKey, respString, CacheTtlActiveUserByType).
+		Return(nil)
 
-	result.expectedRes = nil
-	result.expectedErr = custerror.NewInternal(unmarshalErr.Error())
-	result.shouldWait = false
+	result.expectedRes = resp
+	result.expectedErr = nil
+	result.shouldWait = true
 	result.cleanupFunc = func() {
 		json.SetHandler(json.Default())
 	}
@@ -101,6 +115,46 @@ func getActiveUsersByType_fail_errGetByTypeAndState(req getActiveUsersByTypeTest
 	return result
 }
 
+// getActiveUsersByType_fail_unavailableGetByTypeAndState defines failure, caused by userRepository.GetByTypeAndState
+// being unavailable, which is kept retryable instead of becoming internal
+// (when trying to get from database)
+func getActiveUsersByType_fail_unavailableGetByTypeAndState(req getActiveUsersByTypeTestParam) (result getActiveUsersByTypeTestResult) {
+	cacheKey := getCacheKeyActiveUsersByType(req.request.UserType)
+	getUsersReq := createGetActiveUsersByTypeRequest(req.request)
+	errGetUsers := custerror.NewUnavailable("database unavailable")
+
+	req.mocks.cacheRepository.EXPECT().Get(req.ctx, cacheKey).
+		Return("", errors.New("failed"))
+	req.mocks.userRepository.EXPECT().GetByTypeAndState(req.ctx, getUsersReq).
+		Return(nil, errGetUsers)
+
+	result.expectedRes = nil
+	result.expectedErr = errGetUsers
+	result.shouldWait = false
+	result.cleanupFunc = nil
+	return result
+}
+
+// getActiveUsersByType_succ_unavailableCacheGet defines success with cacheRepository.Get being unavailable,
+// the users are not written back to the cache
+// (when trying to get from database)
+func getActiveUsersByType_succ_unavailableCacheGet(req getActiveUsersByTypeTestParam) (result getActiveUsersByTypeTestResult) {
+	cacheKey := getCacheKeyActiveUsersByType(req.request.UserType)
+	getUsersReq := createGetActiveUsersByTypeRequest(req.request)
+	resp := []User{{Id: 1, Type: UserTypePremium, Score: 60}}
+
+	req.mocks.cacheRepository.EXPECT().Get(req.ctx, cacheKey).
+		Return("", custerror.NewTimeout("cache timeout"))
+	req.mocks.userRepository.EXPECT().GetByTypeAndState(req.ctx, getUsersReq).
+		Return(resp, nil)
+
+	result.expectedRes = resp
+	result.expectedErr = nil
+	result.shouldWait = true
+	result.cleanupFunc = nil
+	return result
+}
+
 // getActiveUsersByType_fail_resultEmptyGetByTypeAndState defines failure, caused by empty result from userRepository.GetByTypeAndState
 // (when trying to get from database)
 func getActiveUsersByType_fail_resultEmptyGetByTypeAndState(req getActiveUsersByTypeTestParam) (result getActiveUsersByTypeTestResult) {
@@ -224,12 +278,76 @@ func getActiveUsersByType_succ_errCacheGetAndCacheSet(req getActiveUsersByTypeTe
 	return result
 }
 
+// getActiveUsersByType_fail_unknownUserType defines failure, caused by a user type not registered
+// (before trying to get from cache)
+func getActiveUsersByType_fail_unknownUserType(req getActiveUsersByTypeTestParam) (result getActiveUsersByTypeTestResult) {
+	result.expectedRes = nil
+	result.expectedErr = custerror.NewBadRequest("unknown user type " + string(req.request.UserType))
+	result.shouldWait = false
+	result.cleanupFunc = nil
+	return result
+}
+
+// getActiveUsersByType_succ_audienceErrCacheGet defines success getting an audience with an error from cacheRepository.Get
+// (when trying to get from database)
+func getActiveUsersByType_succ_audienceErrCacheGet(req getActiveUsersByTypeTestParam) (result getActiveUsersByTypeTestResult) {
+	audience := *req.request.Audience
+	cacheKey := getCacheKeyActiveUsersByAudience(audience)
+	getUsersReq := createGetActiveUsersByAudienceRequest(audience)
+	resp := []User{
+		{
+			Id:          1,
+			Name:        "name",
+			Type:        UserTypePremium,
+			PhoneNumber: "088888888",
+			Email:       "email@test.mail",
+			Score:       60,
+		},
+	}
+	respString := `[{"id":1, "name": "name", "type": "premium", "phone_number": "088888888", "email": "email@test.mail", "score": 60}]`
+
+	for _, userType := range []UserType{UserTypeBasic, UserTypePremium} {
+		req.mocks.cacheRepository.EXPECT().Get(req.ctx, DefaultCachePolicy().generationKey(userType)).
+			Return("", errors.New("not found"))
+	}
+	req.mocks.cacheRepository.EXPECT().Get(req.ctx, cacheKey).
+		Return("", errors.New("failed"))
+	req.mocks.userRepository.EXPECT().GetByAudienceAndState(req.ctx, getUsersReq).
+		Return(resp, nil)
+	json.SetHandler(req.mocks.jsonHandler)
+	req.mocks.jsonHandler.EXPECT().Marshal(resp).
+		Return([]byte(respString), nil)
+	req.mocks.cacheRepository.EXPECT().Set(req.ctx, cacheKey, respString, CacheTtlActiveUserByType).
+		Return(nil)
+
+	result.expectedRes = resp
+	result.expectedErr = nil
+	result.shouldWait = true
+	result.cleanupFunc = func() {
+		json.SetHandler(json.Default())
+	}
+	return result
+}
+
 func TestUserService_getActiveUsersByType(t *testing.T) {
 	ctx := context.Background()
 	request := NotifyUsersByTypeRequest{
 		Message:  "test",
 		UserType: UserTypePremium,
 	}
+	unknownTypeRequest := NotifyUsersByTypeRequest{
+		Message:  "test",
+		UserType: "unknown",
+	}
+	minScore := 50
+	audienceRequest := NotifyUsersByTypeRequest{
+		Message: "test",
+		Audience: &AudienceFilter{
+			UserTypes: []UserType{UserTypePremium, UserTypeBasic},
+			MinScore:  &minScore,
+			HasEmail:  true,
+		},
+	}
 
 	type args struct {
 		ctx     context.Context
@@ -241,9 +359,9 @@ func TestUserService_getActiveUsersByType(t *testing.T) {
 		testCaseFunc func(req getActiveUsersByTypeTestParam) (result getActiveUsersByTypeTestResult)
 	}{
 		{
-			name:         "getActiveUsersByType fail, error json.Unmarshal",
+			name:         "getActiveUsersByType success, error json.Unmarshal",
 			args:         args{ctx: ctx, request: request},
-			testCaseFunc: getActiveUsersByType_fail_errUnmarshal,
+			testCaseFunc: getActiveUsersByType_succ_errUnmarshal,
 		},
 		{
 			name:         "getActiveUsersByType success no error",
@@ -255,6 +373,16 @@ func TestUserService_getActiveUsersByType(t *testing.T) {
 			args:         args{ctx: ctx, request: request},
 			testCaseFunc: getActiveUsersByType_fail_errGetByTypeAndState,
 		},
+		{
+			name:         "getActiveUsersByType fail, unavailable userRepository.GetByTypeAndState",
+			args:         args{ctx: ctx, request: request},
+			testCaseFunc: getActiveUsersByType_fail_unavailableGetByTypeAndState,
+		},
+		{
+			name:         "getActiveUsersByType success, unavailable cacheRepository.Get",
+			args:         args{ctx: ctx, request: request},
+			testCaseFunc: getActiveUsersByType_succ_unavailableCacheGet,
+		},
 		{
 			name:         "getActiveUsersByType fail, empty result userRepository.GetByTypeAndState",
 			args:         args{ctx: ctx, request: request},
@@ -275,6 +403,16 @@ func TestUserService_getActiveUsersByType(t *testing.T) {
 			args:         args{ctx: ctx, request: request},
 			testCaseFunc: getActiveUsersByType_succ_errCacheGetAndCacheSet,
 		},
+		{
+			name:         "getActiveUsersByType fail, unknown user type",
+			args:         args{ctx: ctx, request: unknownTypeRequest},
+			testCaseFunc: getActiveUsersByType_fail_unknownUserType,
+		},
+		{
+			name:         "getActiveUsersByType success on audience, error cacheRepository.Get",
+			args:         args{ctx: ctx, request: audienceRequest},
+			testCaseFunc: getActiveUsersByType_succ_audienceErrCacheGet,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -346,8 +484,115 @@ func assertErr(want error, expected error) bool {
 		}
 	}
 
+	if custerror.GetCode(want) != custerror.GetCode(expected) {
+		return false
+	}
 	if want.Error() == expected.Error() {
 		return true
 	}
 	return false
 }
+
+func TestUserService_getActiveUsersByType_metrics(t *testing.T) {
+	ctx := context.Background()
+	request := NotifyUsersByTypeRequest{Message: "test", UserType: UserTypePremium}
+	cacheKey := getCacheKeyActiveUsersByType(request.UserType)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cacheRepository := NewMockCacheRepository(ctrl)
+	userRepository := NewMockUserRepository(ctrl)
+	cacheRepository.EXPECT().Get(ctx, cacheKey).Return(`[{"id":1}]`, nil)
+	cacheRepository.EXPECT().Get(ctx, cacheKey).Return("", custerror.NewTimeout("cache timeout"))
+	userRepository.EXPECT().GetByTypeAndState(ctx, createGetActiveUsersByTypeRequest(request)).Return(nil, errors.New("failed"))
+	prometheus := metrics.NewPrometheus()
+
+	us := &UserService{
+		userRepository:  userRepository,
+		cacheRepository: cacheRepository,
+		metrics:         prometheus,
+	}
+	if _, err := us.getActiveUsersByType(ctx, request); err != nil {
+		t.Fatalf("getActiveUsersByType() error = %v", err)
+	}
+	if _, err := us.getActiveUsersByType(ctx, request); err == nil {
+		t.Fatalf("getActiveUsersByType() error = nil, want repository error")
+	}
+
+	var buffer bytes.Buffer
+	if _, err := prometheus.WriteTo(&buffer); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	// durations vary between runs, so only their counts are compared
+	wantLines := []string{
+		"user_service_cache_hits_total 1",
+		"user_service_cache_misses_total 1",
+		`user_service_repository_errors_total{operation="GetByTypeAndState",repository="user"} 1`,
+		`user_service_repository_errors_total{operation="Get",repository="cache"} 1`,
+		`user_service_repository_duration_seconds_count{operation="Get",repository="cache"} 2`,
+		`user_service_repository_duration_seconds_count{operation="GetByTypeAndState",repository="user"} 1`,
+	}
+	for _, line := range wantLines {
+		if !strings.Contains(buffer.String(), line+"\n") {
+			t.Errorf("WriteTo() = %v, want line %v", buffer.String(), line)
+		}
+	}
+}
+
+func TestUserService_getCachePolicy_codecKey(t *testing.T) {
+	codec.SetHandler(codec.Gob())
+	defer codec.SetHandler(codec.Default())
+
+	// users are encoded as JSON by jsonHandler, so their key does not name the gob codec package handler
+	us := &UserService{jsonHandler: json.Default()}
+	if got, want := us.getCachePolicy().keyByType(UserTypePremium), "users:v2:premium"; got != want {
+		t.Errorf("keyByType() with jsonHandler got = %v, want %v", got, want)
+	}
+
+	us = &UserService{}
+	if got, want := us.getCachePolicy().keyByType(UserTypePremium), "users:v2:gob:premium"; got != want {
+		t.Errorf("keyByType() without jsonHandler got = %v, want %v", got, want)
+	}
+}
+
+func TestUserService_metrics_failuresNotReturned(t *testing.T) {
+	ctx := context.Background()
+	audience := AudienceFilter{UserTypes: []UserType{UserTypePremium}}
+	cacheKey := getCacheKeyActiveUsersByType(UserTypePremium)
+	user := User{Id: 1, PhoneNumber: "0811", Type: UserTypePremium}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cacheRepository := NewMockCacheRepository(ctrl)
+	cacheRepository.EXPECT().Set(ctx, cacheKey, gomock.Any(), CacheTtlActiveUserByType).Return(errors.New("failed"))
+	queue := NewMockNotificationQueue(ctrl)
+	queue.EXPECT().Push(ctx, gomock.Any()).Return(errors.New("failed"))
+	prometheus := metrics.NewPrometheus()
+
+	us := &UserService{
+		cacheRepository:   cacheRepository,
+		quietHours:        &QuietHours{StartHour: 21, EndHour: 8, Action: QuietHoursActionDefer},
+		notificationQueue: queue,
+		metrics:           prometheus,
+	}
+	// the failures are only logged or reported in the response, they are still counted
+	us.setActiveUsersCache(ctx, audience, cacheKey, []User{user}, us.cacheGenerations.get(cacheKey))
+	if status, _ := us.holdPhoneNotification(ctx, user, "message", "", time.Date(2024, 1, 1, 22, 0, 0, 0, time.UTC)); status != DeliveryStatusFailed {
+		t.Errorf("holdPhoneNotification() status = %v, want %v", status, DeliveryStatusFailed)
+	}
+
+	var buffer bytes.Buffer
+	if _, err := prometheus.WriteTo(&buffer); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	for _, line := range []string{
+		`user_service_repository_errors_total{operation="Set",repository="cache"} 1`,
+		`user_service_repository_errors_total{operation="Push",repository="notification_queue"} 1`,
+	} {
+		if !strings.Contains(buffer.String(), line+"\n") {
+			t.Errorf("WriteTo() = %v, want line %v", buffer.String(), line)
+		}
+	}
+}
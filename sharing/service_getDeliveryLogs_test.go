@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/practice/sharing/util/custerror"
+)
+
+type getDeliveryLogsTestParam struct {
+	ctx     context.Context
+	request GetDeliveryLogsRequest
+	mocks   userServiceMocks
+}
+
+type getDeliveryLogsTestResult struct {
+	expectedRes []DeliveryLog
+	expectedErr error
+}
+
+// getDeliveryLogs_fail_errValidate defines failure, caused by a time range ending before it starts
+func getDeliveryLogs_fail_errValidate(req getDeliveryLogsTestParam) (result getDeliveryLogsTestResult) {
+	result.expectedRes = nil
+	result.expectedErr = custerror.NewBadRequest("to should not be before from")
+	return result
+}
+
+// getDeliveryLogs_fail_errFind defines failure, caused by error deliveryLogRepository.Find
+func getDeliveryLogs_fail_errFind(req getDeliveryLogsTestParam) (result getDeliveryLogsTestResult) {
+	errFind := errors.New("failed")
+
+	req.mocks.deliveryLogRepository.EXPECT().Find(req.ctx, req.request).
+		Return(nil, errFind)
+
+	result.expectedRes = nil
+	result.expectedErr = custerror.NewInternal(errFind.Error())
+	return result
+}
+
+// getDeliveryLogs_succ defines success returning logs from deliveryLogRepository.Find
+func getDeliveryLogs_succ(req getDeliveryLogsTestParam) (result getDeliveryLogsTestResult) {
+	logs := []DeliveryLog{
+		{
+			Id:       1,
+			UserId:   req.request.UserId,
+			UserType: UserTypePremium,
+			Channel:  NotificationChannelEmail,
+			Status:   req.request.Status,
+		},
+	}
+
+	req.mocks.deliveryLogRepository.EXPECT().Find(req.ctx, req.request).
+		Return(logs, nil)
+
+	result.expectedRes = logs
+	result.expectedErr = nil
+	return result
+}
+
+func TestUserService_GetDeliveryLogs(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	request := GetDeliveryLogsRequest{
+		UserId: 1,
+		Status: DeliveryStatusFailed,
+		From:   now.Add(-1 * time.Hour),
+		To:     now,
+	}
+	invalidRequest := request
+	invalidRequest.From, invalidRequest.To = request.To, request.From
+
+	type args struct {
+		ctx     context.Context
+		request GetDeliveryLogsRequest
+	}
+	tests := []struct {
+		name         string
+		args         args
+		testCaseFunc func(req getDeliveryLogsTestParam) (result getDeliveryLogsTestResult)
+	}{
+		{
+			name:         "GetDeliveryLogs fail, error validator.Validate",
+			args:         args{ctx: ctx, request: invalidRequest},
+			testCaseFunc: getDeliveryLogs_fail_errValidate,
+		},
+		{
+			name:         "GetDeliveryLogs fail, error deliveryLogRepository.Find",
+			args:         args{ctx: ctx, request: request},
+			testCaseFunc: getDeliveryLogs_fail_errFind,
+		},
+		{
+			name:         "GetDeliveryLogs success",
+			args:         args{ctx: ctx, request: request},
+			testCaseFunc: getDeliveryLogs_succ,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mocks := userServiceMocks{
+				deliveryLogRepository: NewMockDeliveryLogRepository(ctrl),
+			}
+			testCaseResp := tt.testCaseFunc(getDeliveryLogsTestParam{
+				ctx:     tt.args.ctx,
+				request: tt.args.request,
+				mocks:   mocks,
+			})
+
+			us := &UserService{
+				deliveryLogRepository: mocks.deliveryLogRepository,
+			}
+			gotLogs, err := us.GetDeliveryLogs(tt.args.ctx, tt.args.request)
+			if !assertErr(err, testCaseResp.expectedErr) {
+				t.Errorf("GetDeliveryLogs() error = %v, wantErr %v", err, testCaseResp.expectedErr)
+				return
+			}
+			if !reflect.DeepEqual(gotLogs, testCaseResp.expectedRes) {
+				t.Errorf("GetDeliveryLogs() gotLogs = %v, want %v", gotLogs, testCaseResp.expectedRes)
+			}
+		})
+	}
+}
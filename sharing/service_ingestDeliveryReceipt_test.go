@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/practice/sharing/util/custerror"
+)
+
+type ingestDeliveryReceiptTestParam struct {
+	ctx     context.Context
+	request DeliveryReceiptRequest
+	mocks   userServiceMocks
+}
+
+type ingestDeliveryReceiptTestResult struct {
+	expectedRes DeliveryLog
+	expectedErr error
+}
+
+// deliveryLogMatcher matches a delivery log ignoring UpdatedAt, which is set from the current time
+type deliveryLogMatcher struct {
+	expected DeliveryLog
+}
+
+func deliveryLogEq(expected DeliveryLog) gomock.Matcher {
+	return deliveryLogMatcher{expected: expected}
+}
+
+func (dm deliveryLogMatcher) Matches(x interface{}) bool {
+	log, ok := x.(DeliveryLog)
+	if !ok {
+		return false
+	}
+	log.UpdatedAt = dm.expected.UpdatedAt
+	return reflect.DeepEqual(log, dm.expected)
+}
+
+func (dm deliveryLogMatcher) String() string {
+	return fmt.Sprintf("delivery log %v", dm.expected)
+}
+
+func getDeliveryLogsByReceipt(request DeliveryReceiptRequest) GetDeliveryLogsRequest {
+	return GetDeliveryLogsRequest{
+		Channel:           request.Channel,
+		ProviderMessageId: request.ProviderMessageId,
+	}
+}
+
+// ingestDeliveryReceipt_fail_errValidate defines failure, caused by an unknown receipt status
+func ingestDeliveryReceipt_fail_errValidate(req ingestDeliveryReceiptTestParam) (result ingestDeliveryReceiptTestResult) {
+	result.expectedErr = custerror.NewBadRequest("status should be delivered, bounced or failed")
+	return result
+}
+
+// ingestDeliveryReceipt_fail_errFind defines failure, caused by error deliveryLogRepository.Find
+func ingestDeliveryReceipt_fail_errFind(req ingestDeliveryReceiptTestParam) (result ingestDeliveryReceiptTestResult) {
+	errFind := errors.New("failed")
+
+	req.mocks.deliveryLogRepository.EXPECT().Find(req.ctx, getDeliveryLogsByReceipt(req.request)).
+		Return(nil, errFind)
+
+	result.expectedErr = custerror.NewInternal(errFind.Error())
+	return result
+}
+
+// ingestDeliveryReceipt_fail_notFound defines failure, caused by no delivery sent with the receipt provider message id
+func ingestDeliveryReceipt_fail_notFound(req ingestDeliveryReceiptTestParam) (result ingestDeliveryReceiptTestResult) {
+	req.mocks.deliveryLogRepository.EXPECT().Find(req.ctx, getDeliveryLogsByReceipt(req.request)).
+		Return(nil, nil)
+
+	result.expectedErr = custerror.NewNotFound("delivery not found")
+	return result
+}
+
+// ingestDeliveryReceipt_fail_finalStatus defines failure, caused by a receipt for a delivery already bounced
+func ingestDeliveryReceipt_fail_finalStatus(req ingestDeliveryReceiptTestParam) (result ingestDeliveryReceiptTestResult) {
+	logs := []DeliveryLog{
+		{Id: 1, Channel: req.request.Channel, ProviderMessageId: req.request.ProviderMessageId, Status: DeliveryStatusBounced},
+	}
+
+	req.mocks.deliveryLogRepository.EXPECT().Find(req.ctx, getDeliveryLogsByReceipt(req.request)).
+		Return(logs, nil)
+
+	result.expectedRes = logs[0]
+	result.expectedErr = custerror.NewBadRequest("delivery status can not change from bounced to delivered")
+	return result
+}
+
+// ingestDeliveryReceipt_succ_duplicate defines success without update on a receipt already applied
+func ingestDeliveryReceipt_succ_duplicate(req ingestDeliveryReceiptTestParam) (result ingestDeliveryReceiptTestResult) {
+	logs := []DeliveryLog{
+		{Id: 1, Channel: req.request.Channel, ProviderMessageId: req.request.ProviderMessageId, Status: DeliveryStatusDelivered},
+	}
+
+	req.mocks.deliveryLogRepository.EXPECT().Find(req.ctx, getDeliveryLogsByReceipt(req.request)).
+		Return(logs, nil)
+
+	result.expectedRes = logs[0]
+	return result
+}
+
+// ingestDeliveryReceipt_fail_errUpdate defines failure, caused by error deliveryLogRepository.Update
+func ingestDeliveryReceipt_fail_errUpdate(req ingestDeliveryReceiptTestParam) (result ingestDeliveryReceiptTestResult) {
+	errUpdate := errors.New("failed")
+	logs := []DeliveryLog{
+		{Id: 1, Channel: req.request.Channel, ProviderMessageId: req.request.ProviderMessageId, Status: DeliveryStatusSent},
+	}
+	updatedLog := logs[0]
+	updatedLog.Status = req.request.Status
+
+	req.mocks.deliveryLogRepository.EXPECT().Find(req.ctx, getDeliveryLogsByReceipt(req.request)).
+		Return(logs, nil)
+	req.mocks.deliveryLogRepository.EXPECT().Update(req.ctx, deliveryLogEq(updatedLog)).
+		Return(errUpdate)
+
+	result.expectedErr = custerror.NewInternal(errUpdate.Error())
+	return result
+}
+
+// ingestDeliveryReceipt_succ defines success updating the latest delivery with the provider message id
+func ingestDeliveryReceipt_succ(req ingestDeliveryReceiptTestParam) (result ingestDeliveryReceiptTestResult) {
+	logs := []DeliveryLog{
+		{Id: 3, Channel: req.request.Channel, ProviderMessageId: req.request.ProviderMessageId, Status: DeliveryStatusSent},
+		{Id: 1, Channel: req.request.Channel, ProviderMessageId: req.request.ProviderMessageId, Status: DeliveryStatusSent},
+	}
+	updatedLog := logs[0]
+	updatedLog.Status = req.request.Status
+
+	req.mocks.deliveryLogRepository.EXPECT().Find(req.ctx, getDeliveryLogsByReceipt(req.request)).
+		Return(logs, nil)
+	req.mocks.deliveryLogRepository.EXPECT().Update(req.ctx, deliveryLogEq(updatedLog)).
+		Return(nil)
+
+	result.expectedRes = updatedLog
+	return result
+}
+
+func TestUserService_IngestDeliveryReceipt(t *testing.T) {
+	ctx := context.Background()
+	request := DeliveryReceiptRequest{
+		Channel:           NotificationChannelPhone,
+		ProviderMessageId: "SM0001",
+		Status:            DeliveryStatusDelivered,
+	}
+	invalidRequest := request
+	invalidRequest.Status = DeliveryStatusSent
+
+	type args struct {
+		ctx     context.Context
+		request DeliveryReceiptRequest
+	}
+	tests := []struct {
+		name         string
+		args         args
+		testCaseFunc func(req ingestDeliveryReceiptTestParam) (result ingestDeliveryReceiptTestResult)
+	}{
+		{
+			name:         "IngestDeliveryReceipt fail, error validator.Validate",
+			args:         args{ctx: ctx, request: invalidRequest},
+			testCaseFunc: ingestDeliveryReceipt_fail_errValidate,
+		},
+		{
+			name:         "IngestDeliveryReceipt fail, error deliveryLogRepository.Find",
+			args:         args{ctx: ctx, request: request},
+			testCaseFunc: ingestDeliveryReceipt_fail_errFind,
+		},
+		{
+			name:         "IngestDeliveryReceipt fail, delivery not found",
+			args:         args{ctx: ctx, request: request},
+			testCaseFunc: ingestDeliveryReceipt_fail_notFound,
+		},
+		{
+			name:         "IngestDeliveryReceipt fail, delivery status is final",
+			args:         args{ctx: ctx, request: request},
+			testCaseFunc: ingestDeliveryReceipt_fail_finalStatus,
+		},
+		{
+			name:         "IngestDeliveryReceipt success, duplicate receipt",
+			args:         args{ctx: ctx, request: request},
+			testCaseFunc: ingestDeliveryReceipt_succ_duplicate,
+		},
+		{
+			name:         "IngestDeliveryReceipt fail, error deliveryLogRepository.Update",
+			args:         args{ctx: ctx, request: request},
+			testCaseFunc: ingestDeliveryReceipt_fail_errUpdate,
+		},
+		{
+			name:         "IngestDeliveryReceipt success",
+			args:         args{ctx: ctx, request: request},
+			testCaseFunc: ingestDeliveryReceipt_succ,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mocks := userServiceMocks{
+				deliveryLogRepository: NewMockDeliveryLogRepository(ctrl),
+			}
+			testCaseResp := tt.testCaseFunc(ingestDeliveryReceiptTestParam{
+				ctx:     tt.args.ctx,
+				request: tt.args.request,
+				mocks:   mocks,
+			})
+
+			us := &UserService{
+				deliveryLogRepository: mocks.deliveryLogRepository,
+			}
+			gotLog, err := us.IngestDeliveryReceipt(tt.args.ctx, tt.args.request)
+			if !assertErr(err, testCaseResp.expectedErr) {
+				t.Errorf("IngestDeliveryReceipt() error = %v, wantErr %v", err, testCaseResp.expectedErr)
+				return
+			}
+			if !deliveryLogEq(testCaseResp.expectedRes).Matches(gotLog) {
+				t.Errorf("IngestDeliveryReceipt() gotLog = %v, want %v", gotLog, testCaseResp.expectedRes)
+			}
+		})
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/practice/sharing/util/custerror"
+)
+
+func TestUserService_InvalidateUserType(t *testing.T) {
+	ctx := context.Background()
+	premiumKey := getCacheKeyActiveUsersByType(UserTypePremium)
+	premiumGenerationKey := DefaultCachePolicy().generationKey(UserTypePremium)
+	anyGenerationKey := DefaultCachePolicy().generationKey(anyUserType)
+	generationTtl := DefaultCachePolicy().longestTtl()
+
+	tests := []struct {
+		name       string
+		userType   UserType
+		setupMocks func(cacheRepository *MockCacheRepository)
+		wantErr    error
+	}{
+		{
+			name:     "InvalidateUserType fail, unknown user type",
+			userType: "gold",
+			wantErr:  custerror.NewBadRequest("unknown user type gold"),
+		},
+		{
+			name:     "InvalidateUserType fail, error cacheRepository.Delete",
+			userType: UserTypePremium,
+			setupMocks: func(cacheRepository *MockCacheRepository) {
+				cacheRepository.EXPECT().Set(ctx, premiumGenerationKey, gomock.Any(), generationTtl).Return(nil)
+				cacheRepository.EXPECT().Set(ctx, anyGenerationKey, gomock.Any(), generationTtl).Return(nil)
+				cacheRepository.EXPECT().Delete(ctx, premiumKey).Return(errors.New("failed"))
+			},
+			wantErr: custerror.NewInternal("failed"),
+		},
+		{
+			name:     "InvalidateUserType fail, unavailable cacheRepository.Delete",
+			userType: UserTypePremium,
+			setupMocks: func(cacheRepository *MockCacheRepository) {
+				cacheRepository.EXPECT().Set(ctx, premiumGenerationKey, gomock.Any(), generationTtl).Return(nil)
+				cacheRepository.EXPECT().Set(ctx, anyGenerationKey, gomock.Any(), generationTtl).Return(nil)
+				cacheRepository.EXPECT().Delete(ctx, premiumKey).Return(custerror.NewUnavailable("cache down"))
+			},
+			wantErr: custerror.NewUnavailable("cache down"),
+		},
+		{
+			name:     "InvalidateUserType fail, error cacheRepository.Set generation",
+			userType: UserTypePremium,
+			setupMocks: func(cacheRepository *MockCacheRepository) {
+				cacheRepository.EXPECT().Set(ctx, premiumGenerationKey, gomock.Any(), generationTtl).Return(errors.New("failed"))
+				cacheRepository.EXPECT().Set(ctx, anyGenerationKey, gomock.Any(), generationTtl).Return(nil)
+				cacheRepository.EXPECT().Delete(ctx, premiumKey).Return(nil)
+			},
+			wantErr: custerror.NewInternal("failed"),
+		},
+		{
+			name:     "InvalidateUserType success",
+			userType: UserTypePremium,
+			setupMocks: func(cacheRepository *MockCacheRepository) {
+				cacheRepository.EXPECT().Set(ctx, premiumGenerationKey, gomock.Any(), generationTtl).Return(nil)
+				cacheRepository.EXPECT().Set(ctx, anyGenerationKey, gomock.Any(), generationTtl).Return(nil)
+				cacheRepository.EXPECT().Delete(ctx, premiumKey).Return(nil)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cacheRepository := NewMockCacheRepository(ctrl)
+			if tt.setupMocks != nil {
+				tt.setupMocks(cacheRepository)
+			}
+
+			us := &UserService{
+				cacheRepository: cacheRepository,
+			}
+			err := us.InvalidateUserType(ctx, tt.userType)
+			if !assertErr(err, tt.wantErr) {
+				t.Errorf("InvalidateUserType() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUserService_OnUserChanged(t *testing.T) {
+	ctx := context.Background()
+	premium := &User{Id: 1, Type: UserTypePremium}
+	basic := &User{Id: 1, Type: UserTypeBasic}
+	expectGenerations := func(cacheRepository *MockCacheRepository, userTypes ...UserType) {
+		for _, userType := range append(userTypes, anyUserType) {
+			cacheRepository.EXPECT().Set(ctx, DefaultCachePolicy().generationKey(userType), gomock.Any(), gomock.Any()).Return(nil)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		request    UserChangedRequest
+		setupMocks func(cacheRepository *MockCacheRepository)
+		wantErr    error
+	}{
+		{
+			name:    "OnUserChanged fail, error validator.Validate",
+			request: UserChangedRequest{},
+			wantErr: custerror.NewBadRequest("previous or current user should be set"),
+		},
+		{
+			name:    "OnUserChanged success, created",
+			request: UserChangedRequest{Current: premium},
+			setupMocks: func(cacheRepository *MockCacheRepository) {
+				expectGenerations(cacheRepository, UserTypePremium)
+				cacheRepository.EXPECT().Delete(ctx, getCacheKeyActiveUsersByType(UserTypePremium)).Return(nil)
+			},
+		},
+		{
+			name:    "OnUserChanged success, deleted",
+			request: UserChangedRequest{Previous: premium},
+			setupMocks: func(cacheRepository *MockCacheRepository) {
+				expectGenerations(cacheRepository, UserTypePremium)
+				cacheRepository.EXPECT().Delete(ctx, getCacheKeyActiveUsersByType(UserTypePremium)).Return(nil)
+			},
+		},
+		{
+			name:    "OnUserChanged success, type changed",
+			request: UserChangedRequest{Previous: basic, Current: premium},
+			setupMocks: func(cacheRepository *MockCacheRepository) {
+				expectGenerations(cacheRepository, UserTypeBasic, UserTypePremium)
+				cacheRepository.EXPECT().Delete(ctx, getCacheKeyActiveUsersByType(UserTypeBasic)).Return(nil)
+				cacheRepository.EXPECT().Delete(ctx, getCacheKeyActiveUsersByType(UserTypePremium)).Return(nil)
+			},
+		},
+		{
+			name:    "OnUserChanged success, type unchanged",
+			request: UserChangedRequest{Previous: premium, Current: &User{Id: 1, Type: UserTypePremium, Score: 80}},
+			setupMocks: func(cacheRepository *MockCacheRepository) {
+				expectGenerations(cacheRepository, UserTypePremium)
+				cacheRepository.EXPECT().Delete(ctx, getCacheKeyActiveUsersByType(UserTypePremium)).Return(nil)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cacheRepository := NewMockCacheRepository(ctrl)
+			if tt.setupMocks != nil {
+				tt.setupMocks(cacheRepository)
+			}
+
+			us := &UserService{
+				cacheRepository: cacheRepository,
+			}
+			err := us.OnUserChanged(ctx, tt.request)
+			if !assertErr(err, tt.wantErr) {
+				t.Errorf("OnUserChanged() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUserService_getActiveUsersByType_invalidatedWhileLoading(t *testing.T) {
+	ctx := context.Background()
+	request := NotifyUsersByTypeRequest{Message: "test", UserType: UserTypePremium}
+	cacheKey := getCacheKeyActiveUsersByType(UserTypePremium)
+	users := []User{{Id: 1, Type: UserTypePremium}}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	userRepository := NewMockUserRepository(ctrl)
+	cacheRepository := NewMockCacheRepository(ctrl)
+	us := &UserService{
+		userRepository:  userRepository,
+		cacheRepository: cacheRepository,
+	}
+
+	// the users are invalidated after being loaded and before being cached, so they are not cached
+	cacheRepository.EXPECT().Set(ctx, gomock.Not(cacheKey), gomock.Any(), gomock.Any()).Return(nil).Times(2)
+	cacheRepository.EXPECT().Delete(ctx, cacheKey).Return(nil)
+	userRepository.EXPECT().GetByTypeAndState(ctx, createGetActiveUsersByTypeRequest(request)).
+		DoAndReturn(func(ctx context.Context, request GetUsersByTypeRequest) ([]User, error) {
+			if err := us.InvalidateUserType(ctx, UserTypePremium); err != nil {
+				t.Errorf("InvalidateUserType() error = %v", err)
+			}
+			return users, nil
+		})
+	cacheRepository.EXPECT().Set(gomock.Any(), cacheKey, gomock.Any(), gomock.Any()).Times(0)
+
+	generation := us.cacheGenerations.get(cacheKey)
+	gotUsers, err := us.loadActiveUsers(ctx, request.audience(), request)
+	if err != nil || len(gotUsers) != 1 {
+		t.Fatalf("loadActiveUsers() = %v, %v", gotUsers, err)
+	}
+	us.setActiveUsersCache(ctx, request.audience(), cacheKey, gotUsers, generation)
+}
+
+func TestUserService_setActiveUsersCache_invalidatedWhileSetting(t *testing.T) {
+	ctx := context.Background()
+	audience := AudienceFilter{UserTypes: []UserType{UserTypePremium}}
+	cacheKey := getCacheKeyActiveUsersByType(UserTypePremium)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cacheRepository := NewMockCacheRepository(ctrl)
+	us := &UserService{cacheRepository: cacheRepository}
+
+	// the invalidation deletes the key before the set lands, the key is deleted again after it
+	gomock.InOrder(
+		cacheRepository.EXPECT().Set(ctx, cacheKey, gomock.Any(), CacheTtlActiveUserByType).
+			DoAndReturn(func(ctx context.Context, key string, data string, ttl time.Duration) error {
+				us.cacheGenerations.bump(key)
+				return nil
+			}),
+		cacheRepository.EXPECT().Delete(ctx, cacheKey).Return(nil),
+	)
+
+	us.setActiveUsersCache(ctx, audience, cacheKey, []User{{Id: 1, Type: UserTypePremium}}, us.cacheGenerations.get(cacheKey))
+}
+
+// mapCacheRepository is a CacheRepository shared by several services, as a cache shared by several instances
+type mapCacheRepository struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func (mr *mapCacheRepository) Get(ctx context.Context, key string) (response string, err error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	response, ok := mr.values[key]
+	if !ok {
+		return "", custerror.NewNotFound("key not found")
+	}
+	return response, nil
+}
+
+func (mr *mapCacheRepository) Set(ctx context.Context, key string, data string, ttl time.Duration) (err error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	if mr.values == nil {
+		mr.values = make(map[string]string)
+	}
+	mr.values[key] = data
+	return nil
+}
+
+func (mr *mapCacheRepository) Delete(ctx context.Context, key string) (err error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	delete(mr.values, key)
+	return nil
+}
+
+func TestUserService_InvalidateUserType_audienceCachedByAnotherInstance(t *testing.T) {
+	ctx := context.Background()
+	audience := AudienceFilter{UserTypes: []UserType{UserTypePremium, UserTypeBasic}}
+	cacheRepository := &mapCacheRepository{}
+	cachingInstance := &UserService{cacheRepository: cacheRepository}
+	invalidatingInstance := &UserService{cacheRepository: cacheRepository}
+
+	keyBefore, err := cachingInstance.cacheKey(ctx, audience)
+	if err != nil {
+		t.Fatalf("cacheKey() error = %v", err)
+	}
+	if err = invalidatingInstance.InvalidateUserType(ctx, UserTypeBasic); err != nil {
+		t.Fatalf("InvalidateUserType() error = %v", err)
+	}
+	keyAfter, err := cachingInstance.cacheKey(ctx, audience)
+	if err != nil {
+		t.Fatalf("cacheKey() error = %v", err)
+	}
+	if keyBefore == keyAfter {
+		t.Errorf("cacheKey() = %v after invalidating a type of the audience, want a new key", keyAfter)
+	}
+
+	unrelated := AudienceFilter{UserTypes: []UserType{UserTypePremium, UserTypeTrial}}
+	unrelatedBefore, _ := cachingInstance.cacheKey(ctx, unrelated)
+	if err = invalidatingInstance.InvalidateUserType(ctx, UserTypeBasic); err != nil {
+		t.Fatalf("InvalidateUserType() error = %v", err)
+	}
+	if unrelatedAfter, _ := cachingInstance.cacheKey(ctx, unrelated); unrelatedBefore != unrelatedAfter {
+		t.Errorf("cacheKey() = %v after invalidating a type outside the audience, want %v", unrelatedAfter, unrelatedBefore)
+	}
+}
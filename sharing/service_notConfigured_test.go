@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/practice/sharing/util/custerror"
+)
+
+func TestUserService_notConfigured(t *testing.T) {
+	ctx := context.Background()
+	us := &UserService{}
+
+	tests := []struct {
+		name    string
+		call    func() error
+		wantErr string
+	}{
+		{
+			name: "GetDeliveryLogs without delivery log repository",
+			call: func() error {
+				_, err := us.GetDeliveryLogs(ctx, GetDeliveryLogsRequest{UserId: 1})
+				return err
+			},
+			wantErr: "delivery log not configured",
+		},
+		{
+			name: "IngestDeliveryReceipt without delivery log repository",
+			call: func() error {
+				_, err := us.IngestDeliveryReceipt(ctx, DeliveryReceiptRequest{
+					Channel:           NotificationChannelEmail,
+					ProviderMessageId: "msg-1",
+					Status:            DeliveryStatusDelivered,
+				})
+				return err
+			},
+			wantErr: "delivery log not configured",
+		},
+		{
+			name: "RecordConsent without consent repository",
+			call: func() error {
+				_, err := us.RecordConsent(ctx, RecordConsentRequest{UserId: 1, Channel: NotificationChannelEmail})
+				return err
+			},
+			wantErr: "consent not configured",
+		},
+		{
+			name: "SendDeferred without notification queue",
+			call: func() error {
+				_, err := us.SendDeferred(ctx)
+				return err
+			},
+			wantErr: "notification queue not configured",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			var internal *custerror.Internal
+			if !errors.As(err, &internal) || err.Error() != tt.wantErr {
+				t.Fatalf("error = %v, want Internal %v", err, tt.wantErr)
+			}
+			if custerror.IsRetryable(err) {
+				t.Errorf("IsRetryable() = true, want false")
+			}
+			if code := custerror.GetCode(err); code != ErrorCodeNotConfigured {
+				t.Errorf("error code = %v, want %v", code, ErrorCodeNotConfigured)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/practice/sharing/util/custerror"
+)
+
+type NotifyUsersTestParam struct {
+	ctx     context.Context
+	request NotifyUsersRequest
+	mocks   userServiceMocks
+}
+
+type NotifyUsersTestResult struct {
+	expectedResp NotifyUsersByTypeResponse
+	expectedErr  error
+}
+
+// NotifyUsers_fail_errValidate defines failure, caused by empty user ids
+func NotifyUsers_fail_errValidate(req NotifyUsersTestParam) (resp NotifyUsersTestResult) {
+	resp.expectedErr = custerror.NewBadRequest("user ids should not be empty")
+	return resp
+}
+
+// NotifyUsers_fail_errGetByIdsAndState defines failure, caused by error userRepository.GetByIdsAndState
+func NotifyUsers_fail_errGetByIdsAndState(req NotifyUsersTestParam) (resp NotifyUsersTestResult) {
+	errGetUsers := errors.New("failed")
+
+	req.mocks.userRepository.EXPECT().GetByIdsAndState(req.ctx, createGetActiveUsersByIdsRequest(req.request.UserIds)).
+		Return(nil, errGetUsers)
+
+	resp.expectedErr = custerror.NewInternal(errGetUsers.Error())
+	return resp
+}
+
+// NotifyUsers_success defines success notifying the active users found and failing the ids without an active user
+func NotifyUsers_success(req NotifyUsersTestParam) (resp NotifyUsersTestResult) {
+	users := []User{user_scoreGreater50_succ, user_scoreLesser50_fail}
+
+	req.mocks.userRepository.EXPECT().GetByIdsAndState(req.ctx, createGetActiveUsersByIdsRequest(req.request.UserIds)).
+		Return(users, nil)
+	notifyUserReq := notifyUsersTestParam{
+		ctx:     req.ctx,
+		message: req.request.Message,
+		mocks:   req.mocks,
+	}
+	succCaseResp := notifyUsers_1scoreGreater50Succ(notifyUserReq)
+	failCaseResp := notifyUsers_1scoreLesser50Fail(notifyUserReq)
+	expectedResp := NotifyUsersByTypeResponse{
+		FailedNotifyUsers: append(failCaseResp.expectedRes.FailedNotifyUsers, NotifyUserResult{
+			UserId:  100,
+			Message: "user not found",
+		}),
+		SuccessNotifyUsers: succCaseResp.expectedRes.SuccessNotifyUsers,
+	}
+	expectedLogs := createDeliveryLogs(req.request.notifyUsersByTypeRequest(), users, expectedResp, time.Time{}, EmailScoreThreshold)
+	req.mocks.deliveryLogRepository.EXPECT().Save(req.ctx, deliveryLogsEq(expectedLogs)).
+		Return(nil)
+
+	resp.expectedResp = expectedResp
+	return resp
+}
+
+func TestUserService_NotifyUsers(t *testing.T) {
+	ctx := context.Background()
+	request := NotifyUsersRequest{
+		UserIds: []int64{user_scoreGreater50_succ.Id, user_scoreLesser50_fail.Id, 100},
+		Message: "message",
+	}
+
+	type args struct {
+		ctx     context.Context
+		request NotifyUsersRequest
+	}
+	tests := []struct {
+		name         string
+		args         args
+		testCaseFunc func(req NotifyUsersTestParam) (resp NotifyUsersTestResult)
+	}{
+		{
+			name:         "NotifyUsers fail, error validator.Validate",
+			args:         args{ctx: ctx, request: NotifyUsersRequest{Message: "message"}},
+			testCaseFunc: NotifyUsers_fail_errValidate,
+		},
+		{
+			name:         "NotifyUsers fail, error userRepository.GetByIdsAndState",
+			args:         args{ctx: ctx, request: request},
+			testCaseFunc: NotifyUsers_fail_errGetByIdsAndState,
+		},
+		{
+			name:         "NotifyUsers success",
+			args:         args{ctx: ctx, request: request},
+			testCaseFunc: NotifyUsers_success,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mocks := userServiceMocks{
+				userRepository: NewMockUserRepository(ctrl),
+				emailNotifier:  NewMockNotifier(ctrl),
+				phoneNotifier:  NewMockNotifier(ctrl),
+
+				deliveryLogRepository: NewMockDeliveryLogRepository(ctrl),
+			}
+			testCaseResp := tt.testCaseFunc(NotifyUsersTestParam{
+				ctx:     tt.args.ctx,
+				request: tt.args.request,
+				mocks:   mocks,
+			})
+
+			us := &UserService{
+				userRepository: mocks.userRepository,
+				phoneNotifier:  mocks.phoneNotifier,
+				emailNotifier:  mocks.emailNotifier,
+
+				deliveryLogRepository: mocks.deliveryLogRepository,
+			}
+			gotResp, err := us.NotifyUsers(tt.args.ctx, tt.args.request)
+			if !assertErr(err, testCaseResp.expectedErr) {
+				t.Errorf("NotifyUsers() error = %v, wantErr %v", err, testCaseResp.expectedErr)
+				return
+			}
+			if !reflect.DeepEqual(gotResp, testCaseResp.expectedResp) {
+				t.Errorf("NotifyUsers() gotResp = %v, want %v", gotResp, testCaseResp.expectedResp)
+			}
+		})
+	}
+}
@@ -4,8 +4,13 @@ import (
 	"context"
 	"errors"
 	"github.com/golang/mock/gomock"
+	"log/slog"
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/practice/sharing/util/logger"
+	"github.com/practice/sharing/util/metrics"
 )
 
 type notifyUsersTestParam struct {
@@ -63,7 +68,7 @@ func notifyUsers_1scoreGreater50Fail(req notifyUsersTestParam) (resp notifyUsers
 	emailNotifyErr := errors.New("failed")
 
 	req.mocks.emailNotifier.EXPECT().Notify(req.ctx, user_scoreGreater50_fail.Email, req.message).
-		Return(emailNotifyErr)
+		Return("", emailNotifyErr)
 
 	resp.expectedRes.FailedNotifyUsers = []NotifyUserResult{
 		{
@@ -77,7 +82,7 @@ func notifyUsers_1scoreGreater50Fail(req notifyUsersTestParam) (resp notifyUsers
 // notifyUsers_1scoreGreater50Succ defines resp with 1 success calling emailNotifier when score > 50
 func notifyUsers_1scoreGreater50Succ(req notifyUsersTestParam) (resp notifyUsersTestResult) {
 	req.mocks.emailNotifier.EXPECT().Notify(req.ctx, user_scoreGreater50_succ.Email, req.message).
-		Return(nil)
+		Return("", nil)
 
 	resp.expectedRes.SuccessNotifyUsers = []NotifyUserResult{
 		{
@@ -92,7 +97,7 @@ func notifyUsers_1score50Fail(req notifyUsersTestParam) (resp notifyUsersTestRes
 	phoneNotifierErr := errors.New("failed")
 
 	req.mocks.phoneNotifier.EXPECT().Notify(req.ctx, user_score50_fail.PhoneNumber, req.message).
-		Return(phoneNotifierErr)
+		Return("", phoneNotifierErr)
 
 	resp.expectedRes.FailedNotifyUsers = []NotifyUserResult{
 		{
@@ -106,7 +111,7 @@ func notifyUsers_1score50Fail(req notifyUsersTestParam) (resp notifyUsersTestRes
 // notifyUsers_1score50Succ defines resp with 1 success calling phoneNotifier when score = 50
 func notifyUsers_1score50Succ(req notifyUsersTestParam) (resp notifyUsersTestResult) {
 	req.mocks.phoneNotifier.EXPECT().Notify(req.ctx, user_score50_succ.PhoneNumber, req.message).
-		Return(nil)
+		Return("", nil)
 
 	resp.expectedRes.SuccessNotifyUsers = []NotifyUserResult{
 		{
@@ -121,7 +126,7 @@ func notifyUsers_1scoreLesser50Fail(req notifyUsersTestParam) (resp notifyUsersT
 	phoneNotifierErr := errors.New("failed")
 
 	req.mocks.phoneNotifier.EXPECT().Notify(req.ctx, user_scoreLesser50_fail.PhoneNumber, req.message).
-		Return(phoneNotifierErr)
+		Return("", phoneNotifierErr)
 
 	resp.expectedRes.FailedNotifyUsers = []NotifyUserResult{
 		{
@@ -135,7 +140,7 @@ func notifyUsers_1scoreLesser50Fail(req notifyUsersTestParam) (resp notifyUsersT
 // notifyUsers_1scoreLesser50Succ defines resp with 1 success calling phoneNotifier when score < 50
 func notifyUsers_1scoreLesser50Succ(req notifyUsersTestParam) (resp notifyUsersTestResult) {
 	req.mocks.phoneNotifier.EXPECT().Notify(req.ctx, user_scoreLesser50_succ.PhoneNumber, req.message).
-		Return(nil)
+		Return("", nil)
 
 	resp.expectedRes.SuccessNotifyUsers = []NotifyUserResult{
 		{
@@ -151,11 +156,11 @@ func notifyUsers_allFail_1scoreGreater50_1score50_1scoreLesser50(req notifyUsers
 	phoneNotifierErr := errors.New("phoneNotifier failed")
 
 	req.mocks.emailNotifier.EXPECT().Notify(req.ctx, user_scoreGreater50_fail.Email, req.message).
-		Return(emailNotifierErr)
+		Return("", emailNotifierErr)
 	req.mocks.phoneNotifier.EXPECT().Notify(req.ctx, user_score50_fail.PhoneNumber, req.message).
-		Return(phoneNotifierErr)
+		Return("", phoneNotifierErr)
 	req.mocks.phoneNotifier.EXPECT().Notify(req.ctx, user_scoreLesser50_fail.PhoneNumber, req.message).
-		Return(phoneNotifierErr)
+		Return("", phoneNotifierErr)
 
 	resp.expectedRes.FailedNotifyUsers = []NotifyUserResult{
 		{
@@ -177,11 +182,11 @@ func notifyUsers_allFail_1scoreGreater50_1score50_1scoreLesser50(req notifyUsers
 // notifyUsers_allSucc_1scoreGreater50_1score50_1scoreLesser50 defines resp with all success on 1 score > 50, 1 score = 50, & 1 score < 50
 func notifyUsers_allSucc_1scoreGreater50_1score50_1scoreLesser50(req notifyUsersTestParam) (resp notifyUsersTestResult) {
 	req.mocks.emailNotifier.EXPECT().Notify(req.ctx, user_scoreGreater50_succ.Email, req.message).
-		Return(nil)
+		Return("", nil)
 	req.mocks.phoneNotifier.EXPECT().Notify(req.ctx, user_score50_succ.PhoneNumber, req.message).
-		Return(nil)
+		Return("", nil)
 	req.mocks.phoneNotifier.EXPECT().Notify(req.ctx, user_scoreLesser50_succ.PhoneNumber, req.message).
-		Return(nil)
+		Return("", nil)
 
 	resp.expectedRes.SuccessNotifyUsers = []NotifyUserResult{
 		{
@@ -204,17 +209,17 @@ func notifyUsers_fail_1Greater50_1score50_1Lesser50_succ_1Greater50_1score50_1Le
 	phoneNotifierErr := errors.New("phoneNotifier failed")
 
 	req.mocks.emailNotifier.EXPECT().Notify(req.ctx, user_scoreGreater50_fail.Email, req.message).
-		Return(emailNotifierErr)
+		Return("", emailNotifierErr)
 	req.mocks.phoneNotifier.EXPECT().Notify(req.ctx, user_score50_fail.PhoneNumber, req.message).
-		Return(phoneNotifierErr)
+		Return("", phoneNotifierErr)
 	req.mocks.phoneNotifier.EXPECT().Notify(req.ctx, user_scoreLesser50_fail.PhoneNumber, req.message).
-		Return(phoneNotifierErr)
+		Return("", phoneNotifierErr)
 	req.mocks.emailNotifier.EXPECT().Notify(req.ctx, user_scoreGreater50_succ.Email, req.message).
-		Return(nil)
+		Return("", nil)
 	req.mocks.phoneNotifier.EXPECT().Notify(req.ctx, user_score50_succ.PhoneNumber, req.message).
-		Return(nil)
+		Return("", nil)
 	req.mocks.phoneNotifier.EXPECT().Notify(req.ctx, user_scoreLesser50_succ.PhoneNumber, req.message).
-		Return(nil)
+		Return("", nil)
 
 	resp.expectedRes.FailedNotifyUsers = []NotifyUserResult{
 		{
@@ -254,7 +259,7 @@ func notifyUsers_errEmailNotifier(req notifyUsersTestParam) (resp notifyUsersTes
 
 	for _, user := range req.users {
 		req.mocks.emailNotifier.EXPECT().Notify(req.ctx, user.Email, req.message).
-			Return(emailNotifErr)
+			Return("", emailNotifErr)
 
 		resp.expectedRes.FailedNotifyUsers = append(resp.expectedRes.FailedNotifyUsers, NotifyUserResult{
 			UserId:  user.Id,
@@ -268,7 +273,7 @@ func notifyUsers_errEmailNotifier(req notifyUsersTestParam) (resp notifyUsersTes
 func notifyUsers_succEmailNotifier(req notifyUsersTestParam) (resp notifyUsersTestResult) {
 	for _, user := range req.users {
 		req.mocks.emailNotifier.EXPECT().Notify(req.ctx, user.Email, req.message).
-			Return(nil)
+			Return("", nil)
 
 		resp.expectedRes.SuccessNotifyUsers = append(resp.expectedRes.SuccessNotifyUsers, NotifyUserResult{
 			UserId: user.Id,
@@ -283,7 +288,7 @@ func notifyUsers_errPhoneNotifier(req notifyUsersTestParam) (resp notifyUsersTes
 
 	for _, user := range req.users {
 		req.mocks.phoneNotifier.EXPECT().Notify(req.ctx, user.PhoneNumber, req.message).
-			Return(phoneNotifErr)
+			Return("", phoneNotifErr)
 
 		resp.expectedRes.FailedNotifyUsers = append(resp.expectedRes.FailedNotifyUsers, NotifyUserResult{
 			UserId:  user.Id,
@@ -297,7 +302,7 @@ func notifyUsers_errPhoneNotifier(req notifyUsersTestParam) (resp notifyUsersTes
 func notifyUsers_succPhoneNotifier(req notifyUsersTestParam) (resp notifyUsersTestResult) {
 	for _, user := range req.users {
 		req.mocks.phoneNotifier.EXPECT().Notify(req.ctx, user.PhoneNumber, req.message).
-			Return(nil)
+			Return("", nil)
 
 		resp.expectedRes.SuccessNotifyUsers = append(resp.expectedRes.SuccessNotifyUsers, NotifyUserResult{
 			UserId: user.Id,
@@ -392,9 +397,236 @@ func TestUserService_notifyUsers(t *testing.T) {
 				phoneNotifier: mocks.phoneNotifier,
 				emailNotifier: mocks.emailNotifier,
 			}
-			if gotResp := us.notifyUsers(tt.args.ctx, tt.args.users, tt.args.message); !reflect.DeepEqual(gotResp, testCaseResp.expectedRes) {
+			if gotResp := us.notifyUsers(tt.args.ctx, tt.args.users, tt.args.message, ""); !reflect.DeepEqual(gotResp, testCaseResp.expectedRes) {
 				t.Errorf("notifyUsers() = %v, want %v", gotResp, testCaseResp.expectedRes)
 			}
 		})
 	}
 }
+
+func TestUserService_notifyUsers_quietHours(t *testing.T) {
+	ctx := context.Background()
+	message := "message"
+	// 22:00 in UTC is 05:00 next day in Asia/Jakarta and 17:00 in America/New_York
+	now := time.Date(2024, 1, 1, 22, 0, 0, 0, time.UTC)
+	quietHours := QuietHours{StartHour: 21, EndHour: 8}
+	userUtc := User{Id: 1, PhoneNumber: "0811", Score: 40, Type: UserTypePremium}
+	userJakarta := User{Id: 2, PhoneNumber: "0812", Score: 40, Type: UserTypePremium, Timezone: "Asia/Jakarta"}
+	userNewYork := User{Id: 3, PhoneNumber: "0813", Score: 40, Type: UserTypePremium, Timezone: "America/New_York"}
+	userEmail := User{Id: 4, Email: "email@test.mail", Score: 60, Type: UserTypePremium}
+	users := []User{userUtc, userJakarta, userNewYork, userEmail}
+	utcSendAt := time.Date(2024, 1, 2, 8, 0, 0, 0, time.UTC)
+	jakarta, _ := userJakarta.Location()
+	jakartaSendAt := time.Date(2024, 1, 2, 8, 0, 0, 0, jakarta)
+
+	tests := []struct {
+		name       string
+		action     string
+		setupMocks func(mocks userServiceMocks, queue *MockNotificationQueue)
+		wantResp   NotifyUsersByTypeResponse
+	}{
+		{
+			name:   "notifyUsers skips phone notifications in quiet hours",
+			action: QuietHoursActionSkip,
+			setupMocks: func(mocks userServiceMocks, queue *MockNotificationQueue) {
+				mocks.phoneNotifier.EXPECT().Notify(ctx, userNewYork.PhoneNumber, message).Return("", nil)
+				mocks.emailNotifier.EXPECT().Notify(ctx, userEmail.Email, message).Return("", nil)
+			},
+			wantResp: NotifyUsersByTypeResponse{
+				SuccessNotifyUsers: []NotifyUserResult{{UserId: userNewYork.Id}, {UserId: userEmail.Id}},
+				SkippedNotifyUsers: []NotifyUserResult{
+					{UserId: userUtc.Id, Message: "quiet hours until " + utcSendAt.Format(time.RFC3339)},
+					{UserId: userJakarta.Id, Message: "quiet hours until " + jakartaSendAt.Format(time.RFC3339)},
+				},
+			},
+		},
+		{
+			name:   "notifyUsers defers phone notifications in quiet hours",
+			action: QuietHoursActionDefer,
+			setupMocks: func(mocks userServiceMocks, queue *MockNotificationQueue) {
+				queue.EXPECT().Push(ctx, DeferredNotification{
+					UserId: userUtc.Id, UserType: UserTypePremium, Identifier: userUtc.PhoneNumber, Message: message, SendAt: utcSendAt,
+				}).Return(errors.New("queue failed"))
+				queue.EXPECT().Push(ctx, DeferredNotification{
+					UserId: userJakarta.Id, UserType: UserTypePremium, Identifier: userJakarta.PhoneNumber, Message: message, SendAt: jakartaSendAt,
+				}).Return(nil)
+				mocks.phoneNotifier.EXPECT().Notify(ctx, userNewYork.PhoneNumber, message).Return("", nil)
+				mocks.emailNotifier.EXPECT().Notify(ctx, userEmail.Email, message).Return("", nil)
+			},
+			wantResp: NotifyUsersByTypeResponse{
+				FailedNotifyUsers:  []NotifyUserResult{{UserId: userUtc.Id, Message: "queue failed"}},
+				SuccessNotifyUsers: []NotifyUserResult{{UserId: userNewYork.Id}, {UserId: userEmail.Id}},
+				DeferredNotifyUsers: []NotifyUserResult{
+					{UserId: userJakarta.Id, Message: "deferred until " + jakartaSendAt.Format(time.RFC3339)},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mocks := userServiceMocks{
+				emailNotifier: NewMockNotifier(ctrl),
+				phoneNotifier: NewMockNotifier(ctrl),
+			}
+			clock := NewMockClock(ctrl)
+			clock.EXPECT().Now().Return(now).AnyTimes()
+			queue := NewMockNotificationQueue(ctrl)
+			tt.setupMocks(mocks, queue)
+
+			quietHours := quietHours
+			quietHours.Action = tt.action
+			us := &UserService{
+				phoneNotifier:     mocks.phoneNotifier,
+				emailNotifier:     mocks.emailNotifier,
+				clock:             clock,
+				quietHours:        &quietHours,
+				notificationQueue: queue,
+			}
+			if gotResp := us.notifyUsers(ctx, users, message, ""); !reflect.DeepEqual(gotResp, tt.wantResp) {
+				t.Errorf("notifyUsers() = %v, want %v", gotResp, tt.wantResp)
+			}
+		})
+	}
+}
+
+func TestUserService_notifyUsers_consent(t *testing.T) {
+	ctx := context.Background()
+	message := "message"
+	topic := "promo"
+	userOptedOutChannel := User{Id: 1, Email: "1@test.mail", Score: 60}
+	userOptedOutTopic := User{Id: 2, Email: "2@test.mail", Score: 60}
+	userOptedInTopic := User{Id: 3, PhoneNumber: "0813", Score: 40}
+	userNoConsent := User{Id: 4, PhoneNumber: "0814", Score: 40}
+	userErrConsent := User{Id: 5, PhoneNumber: "0815", Score: 40}
+	users := []User{userOptedOutChannel, userOptedOutTopic, userOptedInTopic, userNoConsent, userErrConsent}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mocks := userServiceMocks{
+		emailNotifier: NewMockNotifier(ctrl),
+		phoneNotifier: NewMockNotifier(ctrl),
+	}
+	consentRepository := NewMockConsentRepository(ctrl)
+	consentRepository.EXPECT().GetConsents(ctx, userOptedOutChannel.Id, NotificationChannelEmail, topic).
+		Return([]Consent{{UserId: userOptedOutChannel.Id, Channel: NotificationChannelEmail, OptedIn: false}}, nil)
+	consentRepository.EXPECT().GetConsents(ctx, userOptedOutTopic.Id, NotificationChannelEmail, topic).
+		Return([]Consent{
+			{UserId: userOptedOutTopic.Id, Channel: NotificationChannelEmail, Topic: topic, OptedIn: false},
+			{UserId: userOptedOutTopic.Id, Channel: NotificationChannelEmail, OptedIn: true},
+		}, nil)
+	consentRepository.EXPECT().GetConsents(ctx, userOptedInTopic.Id, NotificationChannelPhone, topic).
+		Return([]Consent{
+			{UserId: userOptedInTopic.Id, Channel: NotificationChannelPhone, OptedIn: false},
+			{UserId: userOptedInTopic.Id, Channel: NotificationChannelPhone, Topic: topic, OptedIn: true},
+		}, nil)
+	consentRepository.EXPECT().GetConsents(ctx, userNoConsent.Id, NotificationChannelPhone, topic).
+		Return(nil, nil)
+	consentRepository.EXPECT().GetConsents(ctx, userErrConsent.Id, NotificationChannelPhone, topic).
+		Return(nil, errors.New("consent failed"))
+	mocks.phoneNotifier.EXPECT().Notify(ctx, userOptedInTopic.PhoneNumber, message).Return("", nil)
+	mocks.phoneNotifier.EXPECT().Notify(ctx, userNoConsent.PhoneNumber, message).Return("", nil)
+
+	us := &UserService{
+		phoneNotifier:     mocks.phoneNotifier,
+		emailNotifier:     mocks.emailNotifier,
+		consentRepository: consentRepository,
+	}
+	wantResp := NotifyUsersByTypeResponse{
+		FailedNotifyUsers:  []NotifyUserResult{{UserId: userErrConsent.Id, Message: "consent failed"}},
+		SuccessNotifyUsers: []NotifyUserResult{{UserId: userOptedInTopic.Id}, {UserId: userNoConsent.Id}},
+		UnsubscribedNotifyUsers: []NotifyUserResult{
+			{UserId: userOptedOutChannel.Id, Message: "opted out of email"},
+			{UserId: userOptedOutTopic.Id, Message: "opted out of email"},
+		},
+	}
+	if gotResp := us.notifyUsers(ctx, users, message, topic); !reflect.DeepEqual(gotResp, wantResp) {
+		t.Errorf("notifyUsers() = %v, want %v", gotResp, wantResp)
+	}
+}
+
+func TestUserService_notifyUsers_contactPolicy(t *testing.T) {
+	ctx := context.Background()
+	message := "message"
+	userValidEmail := User{Id: 1, Email: "1@test.mail", Score: 60}
+	userInvalidEmail := User{Id: 2, Email: "2@test", Score: 60}
+	userEmptyEmail := User{Id: 3, PhoneNumber: "+628113", Score: 60}
+	userValidPhone := User{Id: 4, PhoneNumber: "+62811234567", Score: 40}
+	userInvalidPhone := User{Id: 5, PhoneNumber: "0811234567", Score: 40}
+	users := []User{userValidEmail, userInvalidEmail, userEmptyEmail, userValidPhone, userInvalidPhone}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mocks := userServiceMocks{
+		emailNotifier: NewMockNotifier(ctrl),
+		phoneNotifier: NewMockNotifier(ctrl),
+	}
+	mocks.emailNotifier.EXPECT().Notify(ctx, userValidEmail.Email, message).Return("", nil)
+	mocks.phoneNotifier.EXPECT().Notify(ctx, userValidPhone.PhoneNumber, message).Return("", nil)
+
+	us := &UserService{
+		phoneNotifier: mocks.phoneNotifier,
+		emailNotifier: mocks.emailNotifier,
+		contactPolicy: &ContactPolicy{},
+	}
+	wantResp := NotifyUsersByTypeResponse{
+		SuccessNotifyUsers: []NotifyUserResult{{UserId: userValidEmail.Id}, {UserId: userValidPhone.Id}},
+		InvalidContactNotifyUsers: []NotifyUserResult{
+			{UserId: userInvalidEmail.Id, Message: "email is not a valid address"},
+			{UserId: userEmptyEmail.Id, Message: "email is empty"},
+			{UserId: userInvalidPhone.Id, Message: "phone number is not in E.164 format"},
+		},
+	}
+	if gotResp := us.notifyUsers(ctx, users, message, ""); !reflect.DeepEqual(gotResp, wantResp) {
+		t.Errorf("notifyUsers() = %v, want %v", gotResp, wantResp)
+	}
+}
+
+func TestUserService_notifyUsers_metrics(t *testing.T) {
+	ctx := context.Background()
+	message := "message"
+	userEmail := User{Id: 1, Email: "1@test.mail", Score: 60}
+	userPhone := User{Id: 2, PhoneNumber: "0812", Score: 40}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mocks := userServiceMocks{
+		emailNotifier: NewMockNotifier(ctrl),
+		phoneNotifier: NewMockNotifier(ctrl),
+	}
+	mocks.emailNotifier.EXPECT().Notify(ctx, userEmail.Email, message).Return("", nil)
+	mocks.phoneNotifier.EXPECT().Notify(ctx, userPhone.PhoneNumber, message).Return("", errors.New("failed"))
+	mockMetrics := metrics.NewMockMetrics(ctrl)
+	mockMetrics.EXPECT().Observe(MetricNotifyDurationSeconds, gomock.Any(), metrics.NewLabel(MetricLabelChannel, NotificationChannelEmail))
+	mockMetrics.EXPECT().Inc(MetricNotifyTotal, metrics.NewLabel(MetricLabelChannel, NotificationChannelEmail), metrics.NewLabel(MetricLabelStatus, MetricStatusSuccess))
+	mockMetrics.EXPECT().Observe(MetricNotifyDurationSeconds, gomock.Any(), metrics.NewLabel(MetricLabelChannel, NotificationChannelPhone))
+	mockMetrics.EXPECT().Inc(MetricNotifyTotal, metrics.NewLabel(MetricLabelChannel, NotificationChannelPhone), metrics.NewLabel(MetricLabelStatus, MetricStatusFailure))
+
+	us := &UserService{
+		phoneNotifier: mocks.phoneNotifier,
+		emailNotifier: mocks.emailNotifier,
+		metrics:       mockMetrics,
+	}
+	us.notifyUsers(ctx, []User{userEmail, userPhone}, message, "")
+}
+
+func TestUserService_userLocation_invalidTimezone(t *testing.T) {
+	ctx := context.Background()
+	user := User{Id: 1, Timezone: "Mars/Olympus"}
+	capture := logger.NewCapture()
+
+	us := &UserService{logger: capture}
+	if got := us.userLocation(ctx, user); got != time.UTC {
+		t.Errorf("userLocation() got = %v, want UTC", got)
+	}
+
+	entries := capture.Entries()
+	if len(entries) != 1 || entries[0].Level != slog.LevelWarn || entries[0].Fields["timezone"] != user.Timezone {
+		t.Errorf("userLocation() logged %v, want a warning with the invalid timezone", entries)
+	}
+}
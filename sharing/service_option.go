@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/practice/sharing/util/json"
+	"github.com/practice/sharing/util/logger"
+	"github.com/practice/sharing/util/metrics"
+	"github.com/practice/sharing/util/tracing"
+	"github.com/practice/sharing/util/validator"
+)
+
+// UserServiceOption sets an optional dependency or setting of UserService
+type UserServiceOption func(us *UserService)
+
+// NewUserService creates a UserService getting users from userRepository cached in cacheRepository,
+// WithNotifiers is required and every other option falls back to its default when not given
+func NewUserService(userRepository UserRepository, cacheRepository CacheRepository, opts ...UserServiceOption) (*UserService, error) {
+	us := &UserService{
+		userRepository:  userRepository,
+		cacheRepository: cacheRepository,
+		concurrency:     1,
+		cachePolicy:     DefaultCachePolicy(),
+	}
+	for _, opt := range opts {
+		opt(us)
+	}
+
+	if err := us.validate(); err != nil {
+		return nil, err
+	}
+	return us, nil
+}
+
+// WithNotifiers sets the notifiers of each channel
+func WithNotifiers(emailNotifier Notifier, phoneNotifier Notifier) UserServiceOption {
+	return func(us *UserService) {
+		us.emailNotifier = emailNotifier
+		us.phoneNotifier = phoneNotifier
+	}
+}
+
+// WithLogger sets the logger, logger.Default by default
+func WithLogger(logger logger.Logger) UserServiceOption {
+	return func(us *UserService) {
+		us.logger = logger
+	}
+}
+
+// WithClock sets the clock, the system time by default
+func WithClock(clock Clock) UserServiceOption {
+	return func(us *UserService) {
+		us.clock = clock
+	}
+}
+
+// WithConcurrency sets the number of users notified at once, 1 by default
+func WithConcurrency(concurrency int) UserServiceOption {
+	return func(us *UserService) {
+		us.concurrency = concurrency
+	}
+}
+
+// WithCachePolicy sets how long and under which keys active users are cached, DefaultCachePolicy by default
+func WithCachePolicy(cachePolicy CachePolicy) UserServiceOption {
+	return func(us *UserService) {
+		us.cachePolicy = cachePolicy
+	}
+}
+
+// WithCacheTtl sets how long active users are cached, CacheTtlActiveUserByType by default or when 0
+func WithCacheTtl(ttl time.Duration) UserServiceOption {
+	return func(us *UserService) {
+		us.cachePolicy.Ttl = ttl
+	}
+}
+
+// WithCacheSoftTtl returns stale cached users while refreshing them in the background after softTtl,
+// stale users are never returned by default
+func WithCacheSoftTtl(softTtl time.Duration) UserServiceOption {
+	return func(us *UserService) {
+		us.cachePolicy.SoftTtl = softTtl
+	}
+}
+
+// WithCacheKeyPrefix sets the prefix of the active users cache keys, CacheKeyPrefixActiveUsers by default
+func WithCacheKeyPrefix(prefix string) UserServiceOption {
+	return func(us *UserService) {
+		us.cachePolicy.KeyPrefix = prefix
+	}
+}
+
+// WithEmailScoreThreshold sets the score users are notified by email above, EmailScoreThreshold by default
+func WithEmailScoreThreshold(threshold int) UserServiceOption {
+	return func(us *UserService) {
+		us.emailScoreThreshold = &threshold
+	}
+}
+
+// WithDeliveryLogRepository records every notification delivery, not recorded by default
+func WithDeliveryLogRepository(deliveryLogRepository DeliveryLogRepository) UserServiceOption {
+	return func(us *UserService) {
+		us.deliveryLogRepository = deliveryLogRepository
+	}
+}
+
+// WithQuietHours holds phone notifications during quiet hours, deferred ones are pushed to notificationQueue
+func WithQuietHours(quietHours QuietHours, notificationQueue NotificationQueue) UserServiceOption {
+	return func(us *UserService) {
+		us.quietHours = &quietHours
+		us.notificationQueue = notificationQueue
+	}
+}
+
+// WithUserTypeRegistry sets the known user types, the built in types by default
+func WithUserTypeRegistry(userTypeRegistry *UserTypeRegistry) UserServiceOption {
+	return func(us *UserService) {
+		us.userTypeRegistry = userTypeRegistry
+	}
+}
+
+// WithConsentRepository checks the user consent before notifying, every user is opted in by default
+func WithConsentRepository(consentRepository ConsentRepository) UserServiceOption {
+	return func(us *UserService) {
+		us.consentRepository = consentRepository
+	}
+}
+
+// WithContactPolicy checks the user contact before notifying, contacts are not checked by default
+func WithContactPolicy(contactPolicy ContactPolicy) UserServiceOption {
+	return func(us *UserService) {
+		us.contactPolicy = &contactPolicy
+	}
+}
+
+// WithJsonHandler sets the json handler encoding the cached users and HTTP bodies, the json package handler by default
+func WithJsonHandler(jsonHandler json.Handler) UserServiceOption {
+	return func(us *UserService) {
+		us.jsonHandler = jsonHandler
+	}
+}
+
+// WithValidator sets the validator of requests, the validator package handler by default
+func WithValidator(validator validator.Handler) UserServiceOption {
+	return func(us *UserService) {
+		us.validator = validator
+	}
+}
+
+// WithMetrics sets the metrics, discarded by default
+func WithMetrics(metrics metrics.Metrics) UserServiceOption {
+	return func(us *UserService) {
+		us.metrics = metrics
+	}
+}
+
+// WithTracer sets the tracer, not traced by default
+func WithTracer(tracer tracing.Tracer) UserServiceOption {
+	return func(us *UserService) {
+		us.tracer = tracer
+	}
+}
+
+// validate checks the dependencies and settings of a constructed UserService, reporting every problem at once
+func (us *UserService) validate() error {
+	var errs []error
+	if us.userRepository == nil {
+		errs = append(errs, errors.New("user repository is required"))
+	}
+	if us.cacheRepository == nil {
+		errs = append(errs, errors.New("cache repository is required"))
+	}
+	if us.emailNotifier == nil || us.phoneNotifier == nil {
+		errs = append(errs, errors.New("email and phone notifiers are required"))
+	}
+	if us.concurrency < 1 {
+		errs = append(errs, errors.New("concurrency should be at least 1"))
+	}
+	if err := us.cachePolicy.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if us.quietHours != nil {
+		if err := us.quietHours.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+		if us.quietHours.Action == QuietHoursActionDefer && us.notificationQueue == nil {
+			errs = append(errs, errors.New("notification queue is required to defer during quiet hours"))
+		}
+	}
+	if us.contactPolicy != nil {
+		if err := us.contactPolicy.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/practice/sharing/util/custerror"
+	"github.com/practice/sharing/util/json"
+	"github.com/practice/sharing/util/validator"
+)
+
+func TestNewUserService(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	userRepository := NewMockUserRepository(ctrl)
+	cacheRepository := NewMockCacheRepository(ctrl)
+	notifier := NewMockNotifier(ctrl)
+
+	tests := []struct {
+		name            string
+		userRepository  UserRepository
+		cacheRepository CacheRepository
+		opts            []UserServiceOption
+		wantErrs        []string
+	}{
+		{
+			name:            "NewUserService success, defaults",
+			userRepository:  userRepository,
+			cacheRepository: cacheRepository,
+			opts:            []UserServiceOption{WithNotifiers(notifier, notifier)},
+		},
+		{
+			name:            "NewUserService success, every option",
+			userRepository:  userRepository,
+			cacheRepository: cacheRepository,
+			opts: []UserServiceOption{
+				WithNotifiers(notifier, notifier),
+				WithConcurrency(8),
+				WithCacheTtl(5 * time.Minute),
+				WithQuietHours(QuietHours{StartHour: 21, EndHour: 8, Action: QuietHoursActionDefer}, NewMemoryNotificationQueue()),
+				WithContactPolicy(ContactPolicy{NormalizePhoneNumber: true, DefaultCountryCode: "62"}),
+			},
+		},
+		{
+			name:            "NewUserService success, cache policy without ttl falls back to the default",
+			userRepository:  userRepository,
+			cacheRepository: cacheRepository,
+			opts: []UserServiceOption{
+				WithNotifiers(notifier, notifier),
+				WithCachePolicy(CachePolicy{TtlByUserType: map[UserType]time.Duration{UserTypePremium: 30 * time.Second}}),
+			},
+		},
+		{
+			name: "NewUserService fail, missing dependencies",
+			wantErrs: []string{
+				"user repository is required",
+				"cache repository is required",
+				"email and phone notifiers are required",
+			},
+		},
+		{
+			name:            "NewUserService fail, invalid settings",
+			userRepository:  userRepository,
+			cacheRepository: cacheRepository,
+			opts: []UserServiceOption{
+				WithNotifiers(notifier, notifier),
+				WithConcurrency(0),
+				WithCacheTtl(-1),
+				WithQuietHours(QuietHours{StartHour: 24, EndHour: 8, Action: QuietHoursActionDefer}, nil),
+				WithContactPolicy(ContactPolicy{DefaultCountryCode: "+62"}),
+			},
+			wantErrs: []string{
+				"concurrency should be at least 1",
+				"cache ttl should be positive",
+				"quiet hours start hour should be between 0 and 23",
+				"notification queue is required to defer during quiet hours",
+				"contact policy default country code should be 1 to 3 digits",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			us, err := NewUserService(tt.userRepository, tt.cacheRepository, tt.opts...)
+			if tt.wantErrs == nil {
+				if err != nil || us == nil {
+					t.Errorf("NewUserService() = %v, %v, want a UserService", us, err)
+				}
+				return
+			}
+			if err == nil || us != nil {
+				t.Fatalf("NewUserService() = %v, %v, want error", us, err)
+			}
+			if got := strings.Split(err.Error(), "\n"); !reflect.DeepEqual(got, tt.wantErrs) {
+				t.Errorf("NewUserService() error = %v, want %v", got, tt.wantErrs)
+			}
+		})
+	}
+}
+
+func TestUserService_notifyUsers_concurrency(t *testing.T) {
+	ctx := context.Background()
+	message := "message"
+	concurrency := 3
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var users []User
+	var wantResp NotifyUsersByTypeResponse
+	for i := 1; i <= 10; i++ {
+		users = append(users, User{Id: int64(i), Email: fmt.Sprintf("%d@test.mail", i), Score: 60})
+		wantResp.SuccessNotifyUsers = append(wantResp.SuccessNotifyUsers, NotifyUserResult{UserId: int64(i)})
+	}
+
+	var running, maxRunning int32
+	emailNotifier := NewMockNotifier(ctrl)
+	emailNotifier.EXPECT().Notify(ctx, gomock.Any(), message).
+		DoAndReturn(func(ctx context.Context, identifier string, message string) (string, error) {
+			current := atomic.AddInt32(&running, 1)
+			for {
+				max := atomic.LoadInt32(&maxRunning)
+				if current <= max || atomic.CompareAndSwapInt32(&maxRunning, max, current) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			return "", nil
+		}).Times(len(users))
+
+	us, err := NewUserService(NewMockUserRepository(ctrl), NewMockCacheRepository(ctrl),
+		WithNotifiers(emailNotifier, NewMockNotifier(ctrl)), WithConcurrency(concurrency))
+	if err != nil {
+		t.Fatalf("NewUserService() error = %v", err)
+	}
+	if gotResp := us.notifyUsers(ctx, users, message, ""); !reflect.DeepEqual(gotResp, wantResp) {
+		t.Errorf("notifyUsers() = %v, want %v", gotResp, wantResp)
+	}
+	if maxRunning < 2 || maxRunning > int32(concurrency) {
+		t.Errorf("notifyUsers() notified up to %d users at once, want between 2 and %d", maxRunning, concurrency)
+	}
+}
+
+func TestUserService_handlers(t *testing.T) {
+	ctx := context.Background()
+	request := NotifyUsersByTypeRequest{Message: "test", UserType: UserTypePremium}
+	cacheKey := getCacheKeyActiveUsersByType(request.UserType)
+	users := []User{{Id: 1, Type: UserTypePremium}}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// the injected handlers are used instead of the package handlers, which are left untouched
+	jsonHandler := json.NewMockHandler(ctrl)
+	validatorHandler := validator.NewMockHandler(ctrl)
+	cacheRepository := NewMockCacheRepository(ctrl)
+	validatorHandler.EXPECT().Validate(request).Return(custerror.NewBadRequest("rejected"))
+	cacheRepository.EXPECT().Get(ctx, cacheKey).Return(`[{"id":1,"type":"premium"}]`, nil)
+	jsonHandler.EXPECT().Unmarshal([]byte(`[{"id":1,"type":"premium"}]`), gomock.Any()).
+		DoAndReturn(func(bytesData []byte, result interface{}) error {
+			*result.(*[]User) = users
+			return nil
+		})
+
+	us, err := NewUserService(NewMockUserRepository(ctrl), cacheRepository,
+		WithNotifiers(NewMockNotifier(ctrl), NewMockNotifier(ctrl)), WithJsonHandler(jsonHandler), WithValidator(validatorHandler))
+	if err != nil {
+		t.Fatalf("NewUserService() error = %v", err)
+	}
+	if _, err = us.NotifyUsersByType(ctx, request); err == nil || err.Error() != "rejected" {
+		t.Errorf("NotifyUsersByType() error = %v, want the injected validator error", err)
+	}
+	if gotUsers, err := us.getActiveUsersByType(ctx, request); err != nil || !reflect.DeepEqual(gotUsers, users) {
+		t.Errorf("getActiveUsersByType() = %v, %v, want %v", gotUsers, err, users)
+	}
+}
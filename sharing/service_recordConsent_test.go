@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/practice/sharing/util/custerror"
+)
+
+func TestUserService_RecordConsent(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	request := RecordConsentRequest{
+		UserId:  1,
+		Channel: NotificationChannelPhone,
+		Topic:   "promo",
+		OptedIn: false,
+	}
+	consent := Consent{
+		UserId:    request.UserId,
+		Channel:   request.Channel,
+		Topic:     request.Topic,
+		OptedIn:   request.OptedIn,
+		UpdatedAt: now,
+	}
+
+	tests := []struct {
+		name        string
+		request     RecordConsentRequest
+		setupMocks  func(consentRepository *MockConsentRepository)
+		wantConsent Consent
+		wantErr     error
+	}{
+		{
+			name:    "RecordConsent fail, error validator.Validate",
+			request: RecordConsentRequest{UserId: 1, Channel: "fax"},
+			wantErr: custerror.NewBadRequest("channel should be email or phone"),
+		},
+		{
+			name:    "RecordConsent fail, error consentRepository.Save",
+			request: request,
+			setupMocks: func(consentRepository *MockConsentRepository) {
+				consentRepository.EXPECT().Save(ctx, consent).Return(errors.New("failed"))
+			},
+			wantErr: custerror.NewInternal("failed"),
+		},
+		{
+			name:    "RecordConsent success",
+			request: request,
+			setupMocks: func(consentRepository *MockConsentRepository) {
+				consentRepository.EXPECT().Save(ctx, consent).Return(nil)
+			},
+			wantConsent: consent,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			consentRepository := NewMockConsentRepository(ctrl)
+			clock := NewMockClock(ctrl)
+			clock.EXPECT().Now().Return(now).AnyTimes()
+			if tt.setupMocks != nil {
+				tt.setupMocks(consentRepository)
+			}
+
+			us := &UserService{
+				consentRepository: consentRepository,
+				clock:             clock,
+			}
+			gotConsent, err := us.RecordConsent(ctx, tt.request)
+			if !assertErr(err, tt.wantErr) {
+				t.Errorf("RecordConsent() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(gotConsent, tt.wantConsent) {
+				t.Errorf("RecordConsent() gotConsent = %v, want %v", gotConsent, tt.wantConsent)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/practice/sharing/util/custerror"
+	"github.com/practice/sharing/util/json"
+	"github.com/practice/sharing/util/validator"
+)
+
+type retryFailedTestParam struct {
+	ctx     context.Context
+	request RetryFailedRequest
+	mocks   userServiceMocks
+}
+
+type retryFailedTestResult struct {
+	expectedResp NotifyUsersByTypeResponse
+	expectedErr  error
+	cleanupFunc  func()
+}
+
+// retryFailed_fail_errValidate defines failure, caused by a previous response without failed users
+func retryFailed_fail_errValidate(req retryFailedTestParam) (resp retryFailedTestResult) {
+	resp.expectedErr = custerror.NewBadRequest("previous response should have failed users")
+	return resp
+}
+
+// retryFailed_fail_errGetByIdsAndState defines failure, caused by error userRepository.GetByIdsAndState
+func retryFailed_fail_errGetByIdsAndState(req retryFailedTestParam) (resp retryFailedTestResult) {
+	errGetUsers := errors.New("failed")
+
+	req.mocks.userRepository.EXPECT().GetByIdsAndState(req.ctx, createGetActiveUsersByIdsRequest([]int64{2, 7})).
+		Return(nil, errGetUsers)
+
+	resp.expectedErr = custerror.NewInternal(errGetUsers.Error())
+	return resp
+}
+
+// retryFailed_succ defines success notifying only the failed users still active, resolved again by id,
+// keeping previous successes and reporting inactive users as failed
+func retryFailed_succ(req retryFailedTestParam) (resp retryFailedTestResult) {
+	users := []User{user_scoreGreater50_succ}
+
+	req.mocks.userRepository.EXPECT().GetByIdsAndState(req.ctx, createGetActiveUsersByIdsRequest([]int64{2, 7})).
+		Return(users, nil)
+	notifyUserCaseResp := notifyUsers_succEmailNotifier(notifyUsersTestParam{
+		ctx:     req.ctx,
+		users:   users,
+		message: req.request.Message,
+		mocks:   req.mocks,
+	})
+	expectedLogs := createDeliveryLogs(req.request.notifyUsersByTypeRequest(), users, notifyUserCaseResp.expectedRes, time.Time{}, EmailScoreThreshold)
+	req.mocks.deliveryLogRepository.EXPECT().Save(req.ctx, deliveryLogsEq(expectedLogs)).
+		Return(nil)
+
+	resp.expectedResp = NotifyUsersByTypeResponse{
+		SuccessNotifyUsers: append(req.request.PreviousResponse.SuccessNotifyUsers, notifyUserCaseResp.expectedRes.SuccessNotifyUsers...),
+		FailedNotifyUsers: []NotifyUserResult{
+			{UserId: 7, Message: "user is no longer active"},
+		},
+		DeferredNotifyUsers:       req.request.PreviousResponse.DeferredNotifyUsers,
+		SkippedNotifyUsers:        req.request.PreviousResponse.SkippedNotifyUsers,
+		UnsubscribedNotifyUsers:   req.request.PreviousResponse.UnsubscribedNotifyUsers,
+		InvalidContactNotifyUsers: req.request.PreviousResponse.InvalidContactNotifyUsers,
+	}
+	return resp
+}
+
+func TestUserService_RetryFailed(t *testing.T) {
+	ctx := context.Background()
+	request := RetryFailedRequest{
+		Message:  "message",
+		UserType: UserTypePremium,
+		PreviousResponse: NotifyUsersByTypeResponse{
+			FailedNotifyUsers: []NotifyUserResult{
+				{UserId: 2, Message: "failed"},
+				{UserId: 7, Message: "failed"},
+				{UserId: 2, Message: "failed"},
+			},
+			SuccessNotifyUsers: []NotifyUserResult{
+				{UserId: 1},
+			},
+			DeferredNotifyUsers:       []NotifyUserResult{{UserId: 3, Message: "deferred until 2024-01-01T07:00:00Z"}},
+			SkippedNotifyUsers:        []NotifyUserResult{{UserId: 4, Message: "quiet hours until 2024-01-01T07:00:00Z"}},
+			UnsubscribedNotifyUsers:   []NotifyUserResult{{UserId: 5, Message: "opted out of phone"}},
+			InvalidContactNotifyUsers: []NotifyUserResult{{UserId: 6, Message: "phone number is empty"}},
+		},
+	}
+	// a NotifyUsers response has no user type nor audience
+	requestByIds := request
+	requestByIds.UserType = ""
+	requestNoFailed := request
+	requestNoFailed.PreviousResponse = NotifyUsersByTypeResponse{
+		SuccessNotifyUsers: request.PreviousResponse.SuccessNotifyUsers,
+	}
+
+	type args struct {
+		ctx     context.Context
+		request RetryFailedRequest
+	}
+	tests := []struct {
+		name         string
+		args         args
+		testCaseFunc func(req retryFailedTestParam) (resp retryFailedTestResult)
+	}{
+		{
+			name:         "RetryFailed fail, error validator.Validate",
+			args:         args{ctx: ctx, request: requestNoFailed},
+			testCaseFunc: retryFailed_fail_errValidate,
+		},
+		{
+			name:         "RetryFailed fail, error userRepository.GetByIdsAndState",
+			args:         args{ctx: ctx, request: request},
+			testCaseFunc: retryFailed_fail_errGetByIdsAndState,
+		},
+		{
+			name:         "RetryFailed success",
+			args:         args{ctx: ctx, request: request},
+			testCaseFunc: retryFailed_succ,
+		},
+		{
+			name:         "RetryFailed success, NotifyUsers response",
+			args:         args{ctx: ctx, request: requestByIds},
+			testCaseFunc: retryFailed_succ,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mocks := userServiceMocks{
+				userRepository:   NewMockUserRepository(ctrl),
+				cacheRepository:  NewMockCacheRepository(ctrl),
+				emailNotifier:    NewMockNotifier(ctrl),
+				phoneNotifier:    NewMockNotifier(ctrl),
+				jsonHandler:      json.NewMockHandler(ctrl),
+				validatorHandler: validator.NewMockHandler(ctrl),
+
+				deliveryLogRepository: NewMockDeliveryLogRepository(ctrl),
+			}
+			testCaseResp := tt.testCaseFunc(retryFailedTestParam{
+				ctx:     tt.args.ctx,
+				request: tt.args.request,
+				mocks:   mocks,
+			})
+			if testCaseResp.cleanupFunc != nil {
+				defer testCaseResp.cleanupFunc()
+			}
+
+			us := &UserService{
+				userRepository:  mocks.userRepository,
+				cacheRepository: mocks.cacheRepository,
+				phoneNotifier:   mocks.phoneNotifier,
+				emailNotifier:   mocks.emailNotifier,
+
+				deliveryLogRepository: mocks.deliveryLogRepository,
+			}
+			gotResp, err := us.RetryFailed(tt.args.ctx, tt.args.request)
+			if !assertErr(err, testCaseResp.expectedErr) {
+				t.Errorf("RetryFailed() error = %v, wantErr %v", err, testCaseResp.expectedErr)
+				return
+			}
+			if !reflect.DeepEqual(gotResp, testCaseResp.expectedResp) {
+				t.Errorf("RetryFailed() gotResp = %v, want %v", gotResp, testCaseResp.expectedResp)
+			}
+		})
+	}
+}
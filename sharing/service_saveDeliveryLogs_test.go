@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/practice/sharing/util/logger"
+)
+
+func TestUserService_saveDeliveryLogs_errSave(t *testing.T) {
+	ctx := logger.WithFields(context.Background(), logger.FieldRequestId, "req-1")
+	now := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	request := NotifyUsersByTypeRequest{Message: "message", UserType: UserTypePremium}
+	users := []User{{Id: 1, Type: UserTypePremium, Email: "email@test.mail", Score: 60}}
+	resp := NotifyUsersByTypeResponse{SuccessNotifyUsers: []NotifyUserResult{{UserId: 1}}}
+	errSave := errors.New("failed")
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	deliveryLogRepository := NewMockDeliveryLogRepository(ctrl)
+	deliveryLogRepository.EXPECT().Save(ctx, createDeliveryLogs(request, users, resp, now, EmailScoreThreshold)).Return(errSave)
+	clock := NewMockClock(ctrl)
+	clock.EXPECT().Now().Return(now)
+	capture := logger.NewCapture()
+
+	us := &UserService{
+		deliveryLogRepository: deliveryLogRepository,
+		clock:                 clock,
+		logger:                capture,
+	}
+	us.saveDeliveryLogs(ctx, request, users, resp)
+
+	want := []logger.Entry{
+		{
+			Level:   slog.LevelError,
+			Message: "save delivery logs failed",
+			Fields: map[string]interface{}{
+				logger.FieldRequestId: "req-1",
+				logger.FieldError:     errSave,
+				"count":               1,
+				logger.FieldUserType:  []UserType{UserTypePremium},
+			},
+		},
+	}
+	if got := capture.Entries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("saveDeliveryLogs() logged %v, want %v", got, want)
+	}
+}
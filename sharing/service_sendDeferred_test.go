@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/practice/sharing/util/custerror"
+)
+
+func TestUserService_SendDeferred(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	phoneNotifier := NewMockNotifier(ctrl)
+	deliveryLogRepository := NewMockDeliveryLogRepository(ctrl)
+	clock := NewMockClock(ctrl)
+	clock.EXPECT().Now().Return(now).AnyTimes()
+	queue := NewMemoryNotificationQueue()
+	notifications := []DeferredNotification{
+		{UserId: 1, UserType: UserTypePremium, Identifier: "0811", Message: "message", SendAt: now.Add(-1 * time.Hour)},
+		{UserId: 2, UserType: UserTypePremium, Identifier: "0812", Message: "message", SendAt: now},
+		{UserId: 3, UserType: UserTypePremium, Identifier: "0813", Message: "message", SendAt: now.Add(1 * time.Hour)},
+	}
+	for _, notification := range notifications {
+		if err := queue.Push(ctx, notification); err != nil {
+			t.Fatalf("Push() error = %v", err)
+		}
+	}
+
+	phoneNotifier.EXPECT().Notify(ctx, "0811", "message").Return("SM0811", nil)
+	phoneNotifier.EXPECT().Notify(ctx, "0812", "message").Return("", errors.New("failed"))
+	deliveryLogRepository.EXPECT().Save(ctx, []DeliveryLog{
+		{UserId: 1, UserType: UserTypePremium, Channel: NotificationChannelPhone, Identifier: "0811", RequestMessage: "message", Status: DeliveryStatusSent, ProviderMessageId: "SM0811", CreatedAt: now},
+		{UserId: 2, UserType: UserTypePremium, Channel: NotificationChannelPhone, Identifier: "0812", RequestMessage: "message", Status: DeliveryStatusFailed, Message: "failed", CreatedAt: now},
+	}).Return(nil)
+
+	us := &UserService{
+		phoneNotifier:         phoneNotifier,
+		deliveryLogRepository: deliveryLogRepository,
+		clock:                 clock,
+		notificationQueue:     queue,
+	}
+	gotResp, err := us.SendDeferred(ctx)
+	if err != nil {
+		t.Fatalf("SendDeferred() error = %v", err)
+	}
+	wantResp := NotifyUsersByTypeResponse{
+		FailedNotifyUsers:  []NotifyUserResult{{UserId: 2, Message: "failed"}},
+		SuccessNotifyUsers: []NotifyUserResult{{UserId: 1, ProviderMessageId: "SM0811"}},
+	}
+	if !reflect.DeepEqual(gotResp, wantResp) {
+		t.Errorf("SendDeferred() gotResp = %v, want %v", gotResp, wantResp)
+	}
+
+	// notifications not due yet stay in the queue
+	remaining, err := queue.PopDue(ctx, now.Add(1*time.Hour))
+	if err != nil || !reflect.DeepEqual(remaining, notifications[2:]) {
+		t.Errorf("PopDue() = %v, %v, want %v", remaining, err, notifications[2:])
+	}
+}
+
+func TestUserService_SendDeferred_retryable(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	retryAt := now.Add(DeferredRetryDelay)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	phoneNotifier := NewMockNotifier(ctrl)
+	deliveryLogRepository := NewMockDeliveryLogRepository(ctrl)
+	clock := NewMockClock(ctrl)
+	clock.EXPECT().Now().Return(now).AnyTimes()
+	queue := NewMemoryNotificationQueue()
+	notification := DeferredNotification{UserId: 1, UserType: UserTypePremium, Identifier: "0811", Message: "message", SendAt: now}
+	if err := queue.Push(ctx, notification); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+
+	phoneNotifier.EXPECT().Notify(ctx, "0811", "message").Return("", custerror.NewTooManyRequests("throttled"))
+	deliveryLogRepository.EXPECT().Save(ctx, []DeliveryLog{
+		{UserId: 1, UserType: UserTypePremium, Channel: NotificationChannelPhone, Identifier: "0811", RequestMessage: "message", Status: DeliveryStatusDeferred, Message: "deferred until 2024-01-01T08:05:00Z", CreatedAt: now},
+	}).Return(nil)
+
+	us := &UserService{
+		phoneNotifier:         phoneNotifier,
+		deliveryLogRepository: deliveryLogRepository,
+		clock:                 clock,
+		notificationQueue:     queue,
+	}
+	gotResp, err := us.SendDeferred(ctx)
+	if err != nil {
+		t.Fatalf("SendDeferred() error = %v", err)
+	}
+	wantResp := NotifyUsersByTypeResponse{
+		DeferredNotifyUsers: []NotifyUserResult{{UserId: 1, Message: "deferred until 2024-01-01T08:05:00Z"}},
+	}
+	if !reflect.DeepEqual(gotResp, wantResp) {
+		t.Errorf("SendDeferred() gotResp = %v, want %v", gotResp, wantResp)
+	}
+
+	// the throttled notification is queued again after the retry delay
+	notification.SendAt = retryAt
+	notification.Attempts = 1
+	remaining, err := queue.PopDue(ctx, retryAt)
+	if err != nil || !reflect.DeepEqual(remaining, []DeferredNotification{notification}) {
+		t.Errorf("PopDue() = %v, %v, want %v", remaining, err, []DeferredNotification{notification})
+	}
+}
+
+func TestUserService_SendDeferred_recheck(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	topic := "promo"
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	phoneNotifier := NewMockNotifier(ctrl)
+	deliveryLogRepository := NewMockDeliveryLogRepository(ctrl)
+	consentRepository := NewMockConsentRepository(ctrl)
+	clock := NewMockClock(ctrl)
+	clock.EXPECT().Now().Return(now).AnyTimes()
+	queue := NewMemoryNotificationQueue()
+	notifications := []DeferredNotification{
+		{UserId: 1, UserType: UserTypePremium, Identifier: "+6281100000001", Message: "message", Topic: topic, SendAt: now},
+		{UserId: 2, UserType: UserTypePremium, Identifier: "+6281100000002", Message: "message", Topic: topic, SendAt: now},
+		{UserId: 3, UserType: UserTypePremium, Identifier: "not a phone", Message: "message", Topic: topic, SendAt: now},
+	}
+	for _, notification := range notifications {
+		if err := queue.Push(ctx, notification); err != nil {
+			t.Fatalf("Push() error = %v", err)
+		}
+	}
+
+	// user 2 opted out of the topic after the notification was deferred
+	consentRepository.EXPECT().GetConsents(ctx, int64(1), NotificationChannelPhone, topic).Return(nil, nil)
+	consentRepository.EXPECT().GetConsents(ctx, int64(2), NotificationChannelPhone, topic).
+		Return([]Consent{{UserId: 2, Channel: NotificationChannelPhone, Topic: topic, OptedIn: false}}, nil)
+	phoneNotifier.EXPECT().Notify(ctx, "+6281100000001", "message").Return("SM1", nil)
+	var gotLogs []DeliveryLog
+	deliveryLogRepository.EXPECT().Save(ctx, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, logs []DeliveryLog) error {
+			gotLogs = logs
+			return nil
+		})
+
+	us := &UserService{
+		phoneNotifier:         phoneNotifier,
+		deliveryLogRepository: deliveryLogRepository,
+		consentRepository:     consentRepository,
+		contactPolicy:         &ContactPolicy{},
+		clock:                 clock,
+		notificationQueue:     queue,
+	}
+	gotResp, err := us.SendDeferred(ctx)
+	if err != nil {
+		t.Fatalf("SendDeferred() error = %v", err)
+	}
+	if len(gotResp.SuccessNotifyUsers) != 1 || gotResp.SuccessNotifyUsers[0].UserId != 1 {
+		t.Errorf("SendDeferred() SuccessNotifyUsers = %v, want user 1", gotResp.SuccessNotifyUsers)
+	}
+	wantUnsubscribed := []NotifyUserResult{{UserId: 2, Message: "opted out of phone"}}
+	if !reflect.DeepEqual(gotResp.UnsubscribedNotifyUsers, wantUnsubscribed) {
+		t.Errorf("SendDeferred() UnsubscribedNotifyUsers = %v, want %v", gotResp.UnsubscribedNotifyUsers, wantUnsubscribed)
+	}
+	if len(gotResp.InvalidContactNotifyUsers) != 1 || gotResp.InvalidContactNotifyUsers[0].UserId != 3 {
+		t.Errorf("SendDeferred() InvalidContactNotifyUsers = %v, want user 3", gotResp.InvalidContactNotifyUsers)
+	}
+
+	wantStatuses := []string{DeliveryStatusSent, DeliveryStatusUnsubscribed, DeliveryStatusInvalidContact}
+	if len(gotLogs) != len(wantStatuses) {
+		t.Fatalf("saved logs = %v, want %d logs", gotLogs, len(wantStatuses))
+	}
+	for i, log := range gotLogs {
+		if log.Status != wantStatuses[i] || log.Topic != topic {
+			t.Errorf("saved log %d = %v, want status %v with topic %v", i, log, wantStatuses[i], topic)
+		}
+	}
+}
+
+func TestUserService_SendDeferred_maxAttempts(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	phoneNotifier := NewMockNotifier(ctrl)
+	clock := NewMockClock(ctrl)
+	clock.EXPECT().Now().Return(now).AnyTimes()
+	queue := NewMemoryNotificationQueue()
+	notification := DeferredNotification{UserId: 1, UserType: UserTypePremium, Identifier: "0811", Message: "message", SendAt: now, Attempts: DeferredMaxAttempts - 1}
+	if err := queue.Push(ctx, notification); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+
+	phoneNotifier.EXPECT().Notify(ctx, "0811", "message").Return("", custerror.NewTooManyRequests("throttled"))
+
+	us := &UserService{
+		phoneNotifier:     phoneNotifier,
+		clock:             clock,
+		notificationQueue: queue,
+	}
+	gotResp, err := us.SendDeferred(ctx)
+	if err != nil {
+		t.Fatalf("SendDeferred() error = %v", err)
+	}
+	wantResp := NotifyUsersByTypeResponse{
+		FailedNotifyUsers: []NotifyUserResult{{UserId: 1, Message: "failed after 5 attempts: throttled"}},
+	}
+	if !reflect.DeepEqual(gotResp, wantResp) {
+		t.Errorf("SendDeferred() gotResp = %v, want %v", gotResp, wantResp)
+	}
+
+	// the notification is not queued again
+	remaining, err := queue.PopDue(ctx, now.Add(24*time.Hour))
+	if err != nil || len(remaining) != 0 {
+		t.Errorf("PopDue() = %v, %v, want none", remaining, err)
+	}
+}
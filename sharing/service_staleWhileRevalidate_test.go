@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/practice/sharing/util/codec"
+)
+
+func TestUserService_getActiveUsersByType_staleWhileRevalidate(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	request := NotifyUsersByTypeRequest{Message: "test", UserType: UserTypePremium}
+	cacheKey := getCacheKeyActiveUsersByType(request.UserType)
+	cachedUsers := []User{{Id: 1, Type: UserTypePremium}}
+	refreshedUsers := []User{{Id: 1, Type: UserTypePremium}, {Id: 2, Type: UserTypePremium}}
+	cachedJson := func(cachedAt time.Time) string {
+		return fmt.Sprintf(`{"cached_at":%q,"users":[{"id":1,"type":"premium"}]}`, cachedAt.Format(time.RFC3339))
+	}
+
+	tests := []struct {
+		name        string
+		cached      string
+		wantRefresh bool
+	}{
+		{name: "fresh, not refreshed", cached: cachedJson(now.Add(-10 * time.Second))},
+		{name: "cached without time, not refreshed", cached: `[{"id":1,"type":"premium"}]`},
+		{name: "stale, returned and refreshed in the background", cached: cachedJson(now.Add(-30 * time.Second)), wantRefresh: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cacheRepository := NewMockCacheRepository(ctrl)
+			userRepository := NewMockUserRepository(ctrl)
+			clock := NewMockClock(ctrl)
+			clock.EXPECT().Now().Return(now).AnyTimes()
+			cacheRepository.EXPECT().Get(ctx, cacheKey).Return(tt.cached, nil)
+
+			// the refresh blocks until released so a second stale read happens while it runs
+			release := make(chan struct{})
+			refreshed := make(chan string, 1)
+			if tt.wantRefresh {
+				cacheRepository.EXPECT().Get(ctx, cacheKey).Return(tt.cached, nil)
+				userRepository.EXPECT().GetByTypeAndState(gomock.Any(), createGetActiveUsersByTypeRequest(request)).
+					DoAndReturn(func(ctx context.Context, request GetUsersByTypeRequest) ([]User, error) {
+						<-release
+						return refreshedUsers, nil
+					})
+				cacheRepository.EXPECT().Set(gomock.Any(), cacheKey, gomock.Any(), time.Minute).
+					DoAndReturn(func(ctx context.Context, key string, data string, ttl time.Duration) error {
+						refreshed <- data
+						return nil
+					})
+			}
+
+			us := &UserService{
+				userRepository:  userRepository,
+				cacheRepository: cacheRepository,
+				clock:           clock,
+				cachePolicy:     CachePolicy{Ttl: time.Minute, SoftTtl: 20 * time.Second},
+			}
+			gotUsers, err := us.getActiveUsersByType(ctx, request)
+			if err != nil {
+				t.Fatalf("getActiveUsersByType() error = %v", err)
+			}
+			if !reflect.DeepEqual(gotUsers, cachedUsers) {
+				t.Errorf("getActiveUsersByType() gotUsers = %v, want %v", gotUsers, cachedUsers)
+			}
+			if !tt.wantRefresh {
+				return
+			}
+
+			if _, err = us.getActiveUsersByType(ctx, request); err != nil {
+				t.Fatalf("getActiveUsersByType() error = %v", err)
+			}
+			close(release)
+			select {
+			case data := <-refreshed:
+				users, cachedAt, errDecode := decodeCachedUsers(codec.Default(), data)
+				if errDecode != nil || !reflect.DeepEqual(users, refreshedUsers) || !cachedAt.Equal(now) {
+					t.Errorf("refreshed cache = %v, want %v cached at %v", data, refreshedUsers, now)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("cache not refreshed")
+			}
+		})
+	}
+}
@@ -3,9 +3,11 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/golang/mock/gomock"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/practice/sharing/util/json"
 	"github.com/practice/sharing/util/validator"
@@ -17,6 +19,8 @@ type userServiceMocks struct {
 	phoneNotifier   *MockNotifier
 	emailNotifier   *MockNotifier
 
+	deliveryLogRepository *MockDeliveryLogRepository
+
 	jsonHandler      *json.MockHandler
 	validatorHandler *validator.MockHandler
 }
@@ -34,6 +38,34 @@ type NotifyUsersByTypeTestResult struct {
 	cleanupFunc  func()
 }
 
+// deliveryLogsMatcher matches delivery logs ignoring CreatedAt, which is set from the current time
+type deliveryLogsMatcher struct {
+	expected []DeliveryLog
+}
+
+func deliveryLogsEq(expected []DeliveryLog) gomock.Matcher {
+	return deliveryLogsMatcher{expected: expected}
+}
+
+func (dm deliveryLogsMatcher) Matches(x interface{}) bool {
+	logs, ok := x.([]DeliveryLog)
+	if !ok || len(logs) != len(dm.expected) {
+		return false
+	}
+	for i := range logs {
+		log := logs[i]
+		log.CreatedAt = dm.expected[i].CreatedAt
+		if !reflect.DeepEqual(log, dm.expected[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (dm deliveryLogsMatcher) String() string {
+	return fmt.Sprintf("delivery logs %v", dm.expected)
+}
+
 func NotifyUsersByType_fail_errValidate(req NotifyUsersByTypeTestParam) (resp NotifyUsersByTypeTestResult) {
 	validateErr := errors.New("failed")
 
@@ -54,7 +86,7 @@ func NotifyUsersByType_fail_errgetActiveUsersByType(req NotifyUsersByTypeTestPar
 	validator.SetHandler(req.mocks.validatorHandler)
 	req.mocks.validatorHandler.EXPECT().Validate(req.request).
 		Return(nil)
-	getUserCaseResp := getActiveUsersByType_fail_errUnmarshal(getActiveUsersByTypeTestParam{
+	getUserCaseResp := getActiveUsersByType_fail_errGetByTypeAndState(getActiveUsersByTypeTestParam{
 		ctx:     req.ctx,
 		request: req.request,
 		mocks:   req.mocks,
@@ -64,7 +96,6 @@ func NotifyUsersByType_fail_errgetActiveUsersByType(req NotifyUsersByTypeTestPar
 	resp.expectedErr = getUserCaseResp.expectedErr
 	resp.shouldWait = getUserCaseResp.shouldWait
 	resp.cleanupFunc = func() {
-		getUserCaseResp.cleanupFunc()
 		validator.SetHandler(validator.Default())
 	}
 	return resp
@@ -86,6 +117,10 @@ func NotifyUsersByType_success(req NotifyUsersByTypeTestParam) (resp NotifyUsers
 		mocks:   req.mocks,
 	})
 
+	expectedLogs := createDeliveryLogs(req.request, getUserCaseResp.expectedRes, notifyUserCaseResp.expectedRes, time.Time{}, EmailScoreThreshold)
+	req.mocks.deliveryLogRepository.EXPECT().Save(req.ctx, deliveryLogsEq(expectedLogs)).
+		Return(nil)
+
 	resp.expectedResp = notifyUserCaseResp.expectedRes
 	resp.expectedErr = nil
 	resp.shouldWait = getUserCaseResp.shouldWait
@@ -140,6 +175,8 @@ func TestUserService_NotifyUsersByType(t *testing.T) {
 				phoneNotifier:    NewMockNotifier(ctrl),
 				jsonHandler:      json.NewMockHandler(ctrl),
 				validatorHandler: validator.NewMockHandler(ctrl),
+
+				deliveryLogRepository: NewMockDeliveryLogRepository(ctrl),
 			}
 			testCaseResp := tt.testCaseFunc(NotifyUsersByTypeTestParam{
 				ctx:     tt.args.ctx,
@@ -155,6 +192,8 @@ func TestUserService_NotifyUsersByType(t *testing.T) {
 				cacheRepository: mocks.cacheRepository,
 				phoneNotifier:   mocks.phoneNotifier,
 				emailNotifier:   mocks.emailNotifier,
+
+				deliveryLogRepository: mocks.deliveryLogRepository,
 			}
 			gotResp, err := us.NotifyUsersByType(tt.args.ctx, tt.args.request)
 			if !assertErr(err, testCaseResp.expectedErr) {
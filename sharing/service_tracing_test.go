@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/practice/sharing/util/tracing"
+)
+
+func TestUserService_NotifyUsersByType_tracing(t *testing.T) {
+	ctx := context.Background()
+	request := NotifyUsersByTypeRequest{Message: "message", UserType: UserTypePremium}
+	users := []User{
+		{Id: 1, Type: UserTypePremium, Email: "1@test.mail", Score: 60},
+		{Id: 2, Type: UserTypePremium, PhoneNumber: "0812", Score: 40},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cacheRepository := NewMockCacheRepository(ctrl)
+	userRepository := NewMockUserRepository(ctrl)
+	emailNotifier := NewMockNotifier(ctrl)
+	phoneNotifier := NewMockNotifier(ctrl)
+	cacheRepository.EXPECT().Get(gomock.Any(), getCacheKeyActiveUsersByType(request.UserType)).Return("", errors.New("missing"))
+	cacheRepository.EXPECT().Set(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	userRepository.EXPECT().GetByTypeAndState(gomock.Any(), createGetActiveUsersByTypeRequest(request)).Return(users, nil)
+
+	// the notifier gets the Notify span to propagate to the provider
+	var traceParents []string
+	emailNotifier.EXPECT().Notify(gomock.Any(), users[0].Email, request.Message).
+		DoAndReturn(func(ctx context.Context, identifier string, message string) (string, error) {
+			traceParents = append(traceParents, tracing.TraceParent(ctx))
+			return "", nil
+		})
+	phoneNotifier.EXPECT().Notify(gomock.Any(), users[1].PhoneNumber, request.Message).
+		DoAndReturn(func(ctx context.Context, identifier string, message string) (string, error) {
+			traceParents = append(traceParents, tracing.TraceParent(ctx))
+			return "", errors.New("failed")
+		})
+	tracer := tracing.NewMemory()
+
+	us := &UserService{
+		userRepository:  userRepository,
+		cacheRepository: cacheRepository,
+		emailNotifier:   emailNotifier,
+		phoneNotifier:   phoneNotifier,
+		tracer:          tracer,
+	}
+	if _, err := us.NotifyUsersByType(ctx, request); err != nil {
+		t.Fatalf("NotifyUsersByType() error = %v", err)
+	}
+
+	spans := tracer.Spans()
+	wantNames := []string{"CacheRepository.Get", "UserRepository.GetByTypeAndState", "Notifier.Notify", "Notifier.Notify", "UserService.NotifyUsersByType"}
+	if len(spans) != len(wantNames) {
+		t.Fatalf("Spans() = %v, want %v", spans, wantNames)
+	}
+	root := spans[len(spans)-1]
+	for i, span := range spans {
+		if span.Name != wantNames[i] {
+			t.Errorf("Spans()[%d].Name = %v, want %v", i, span.Name, wantNames[i])
+		}
+		if i < len(spans)-1 && (span.TraceId != root.TraceId || span.ParentSpanId != root.SpanId) {
+			t.Errorf("Spans()[%d] = %+v, want child of %+v", i, span.SpanContext, root.SpanContext)
+		}
+	}
+	if spans[0].Attributes[AttributeCacheHit] != false || spans[1].Attributes[AttributeUserCount] != 2 {
+		t.Errorf("Spans() attributes = %v, %v", spans[0].Attributes, spans[1].Attributes)
+	}
+	if spans[2].Err != nil || spans[3].Err == nil || spans[3].Attributes[AttributeChannel] != NotificationChannelPhone {
+		t.Errorf("Spans() notify = %+v, %+v, want the phone notify failed", spans[2], spans[3])
+	}
+	if root.Attributes[AttributeSuccessCount] != 1 || root.Attributes[AttributeFailedCount] != 1 {
+		t.Errorf("Spans() root attributes = %v", root.Attributes)
+	}
+	for i, traceParent := range traceParents {
+		if want := "00-" + root.TraceId + "-" + spans[2+i].SpanId + "-01"; traceParent != want {
+			t.Errorf("Notify() traceparent = %v, want %v", traceParent, want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/practice/sharing/util/custerror"
+)
+
+type UserType string
+
+const (
+	UserTypePremium UserType = "premium"
+	UserTypeBasic   UserType = "basic"
+	UserTypeTrial   UserType = "trial"
+)
+
+var defaultUserTypeRegistry = DefaultUserTypeRegistry()
+
+// UserTypeRegistry holds the user types known by the service, types are registered at startup
+type UserTypeRegistry struct {
+	mu    sync.RWMutex
+	types map[UserType]bool
+}
+
+func NewUserTypeRegistry(userTypes ...UserType) *UserTypeRegistry {
+	registry := &UserTypeRegistry{types: make(map[UserType]bool, len(userTypes))}
+	registry.Register(userTypes...)
+	return registry
+}
+
+// DefaultUserTypeRegistry gets a registry of the user types built into the service
+func DefaultUserTypeRegistry() *UserTypeRegistry {
+	return NewUserTypeRegistry(UserTypePremium, UserTypeBasic, UserTypeTrial)
+}
+
+func (ur *UserTypeRegistry) Register(userTypes ...UserType) {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+
+	for _, userType := range userTypes {
+		ur.types[userType] = true
+	}
+}
+
+func (ur *UserTypeRegistry) IsKnown(userType UserType) bool {
+	ur.mu.RLock()
+	defer ur.mu.RUnlock()
+
+	return ur.types[userType]
+}
+
+// Validate rejects the first unknown user type with a custerror.BadRequest
+func (ur *UserTypeRegistry) Validate(userTypes ...UserType) error {
+	for _, userType := range userTypes {
+		if !ur.IsKnown(userType) {
+			return custerror.NewBadRequest("unknown user type "+string(userType),
+				custerror.WithCode(ErrorCodeUserTypeUnknown), custerror.WithDetail("user_type", string(userType)))
+		}
+	}
+	return nil
+}
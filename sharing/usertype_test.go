@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/practice/sharing/util/custerror"
+)
+
+func TestUserTypeRegistry_Validate(t *testing.T) {
+	registry := NewUserTypeRegistry(UserTypePremium)
+	registry.Register("enterprise")
+
+	tests := []struct {
+		name      string
+		userTypes []UserType
+		wantErr   error
+	}{
+		{
+			name:      "Validate success, registered at construction and startup",
+			userTypes: []UserType{UserTypePremium, "enterprise"},
+		},
+		{
+			name:      "Validate fail, built in type not registered",
+			userTypes: []UserType{UserTypePremium, UserTypeTrial},
+			wantErr:   custerror.NewBadRequest("unknown user type trial"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := registry.Validate(tt.userTypes...); !assertErr(err, tt.wantErr) {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
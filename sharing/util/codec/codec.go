@@ -0,0 +1,82 @@
+package codec
+
+import (
+	"sync"
+
+	"github.com/practice/sharing/util/json"
+)
+
+// NameJson is the name of the Default handler
+const NameJson = "json"
+
+var instance Handler
+var syncOnce sync.Once
+
+// mutex guards instance, which may be replaced while goroutines are using it
+var mutex sync.RWMutex
+
+func init() {
+	if instance == nil {
+		syncOnce.Do(func() {
+			instance = Default()
+		})
+	}
+}
+
+type jsonCodec struct {
+	handler json.Handler
+}
+
+// Default gets the handler encoding with the json package handler, so cached data stays readable JSON
+func Default() Handler {
+	return &jsonCodec{}
+}
+
+// Json gets a handler encoding with handler, the json package handler when nil
+func Json(handler json.Handler) Handler {
+	return &jsonCodec{handler: handler}
+}
+
+// SetHandler replaces the handler used by the package functions, it is safe to call concurrently with them
+func SetHandler(handler Handler) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	instance = handler
+}
+
+// Instance gets the handler used by the package functions
+func Instance() Handler {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return instance
+}
+
+func (jc *jsonCodec) Marshal(data interface{}) (bytesData []byte, err error) {
+	if jc.handler == nil {
+		return json.Marshal(data)
+	}
+	return jc.handler.Marshal(data)
+}
+
+func (jc *jsonCodec) Unmarshal(bytesData []byte, result interface{}) (err error) {
+	if jc.handler == nil {
+		return json.Unmarshal(bytesData, result)
+	}
+	return jc.handler.Unmarshal(bytesData, result)
+}
+
+func (jc *jsonCodec) Name() string {
+	return NameJson
+}
+
+func Marshal(data interface{}) (bytesData []byte, err error) {
+	return Instance().Marshal(data)
+}
+
+func Unmarshal(bytesData []byte, result interface{}) (err error) {
+	return Instance().Unmarshal(bytesData, result)
+}
+
+func Name() string {
+	return Instance().Name()
+}
@@ -0,0 +1,69 @@
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+// benchmarks compare the handlers with encoding/json on cached user lists of several sizes,
+// bytes/op reports the encoded size
+func benchmarkHandlers() []Handler {
+	return []Handler{
+		Gob(),
+		Compress(Gob(), DefaultCompressThreshold),
+		Compress(Default(), DefaultCompressThreshold),
+	}
+}
+
+var benchmarkCounts = []int{10, 1000}
+
+func BenchmarkMarshal(b *testing.B) {
+	for _, count := range benchmarkCounts {
+		data := newCachedUsers(count)
+		b.Run(fmt.Sprintf("encoding/json/%d", count), func(b *testing.B) {
+			var bytesData []byte
+			for i := 0; i < b.N; i++ {
+				bytesData, _ = json.Marshal(data)
+			}
+			b.ReportMetric(float64(len(bytesData)), "bytes/op")
+		})
+		for _, handler := range benchmarkHandlers() {
+			handler := handler
+			b.Run(fmt.Sprintf("%s/%d", handler.Name(), count), func(b *testing.B) {
+				var bytesData []byte
+				for i := 0; i < b.N; i++ {
+					bytesData, _ = handler.Marshal(data)
+				}
+				b.ReportMetric(float64(len(bytesData)), "bytes/op")
+			})
+		}
+	}
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	for _, count := range benchmarkCounts {
+		data := newCachedUsers(count)
+		b.Run(fmt.Sprintf("encoding/json/%d", count), func(b *testing.B) {
+			bytesData, _ := json.Marshal(data)
+			for i := 0; i < b.N; i++ {
+				var result cachedUsers
+				if err := json.Unmarshal(bytesData, &result); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		for _, handler := range benchmarkHandlers() {
+			handler := handler
+			b.Run(fmt.Sprintf("%s/%d", handler.Name(), count), func(b *testing.B) {
+				bytesData, _ := handler.Marshal(data)
+				for i := 0; i < b.N; i++ {
+					var result cachedUsers
+					if err := handler.Unmarshal(bytesData, &result); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package codec
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// user mirrors the users cached by the service
+type user struct {
+	Id          int64  `json:"id"`
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	PhoneNumber string `json:"phone_number"`
+	Email       string `json:"email"`
+	Score       int    `json:"score"`
+	Timezone    string `json:"timezone"`
+}
+
+type cachedUsers struct {
+	CachedAt time.Time `json:"cached_at"`
+	Users    []user    `json:"users"`
+}
+
+func newCachedUsers(count int) cachedUsers {
+	cached := cachedUsers{CachedAt: time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)}
+	for i := 0; i < count; i++ {
+		cached.Users = append(cached.Users, user{
+			Id:          int64(i + 1),
+			Name:        "name",
+			Type:        "premium",
+			PhoneNumber: "+628112345678",
+			Email:       "email@test.mail",
+			Score:       i % 100,
+			Timezone:    "Asia/Jakarta",
+		})
+	}
+	return cached
+}
+
+func TestHandlers_roundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		handler  Handler
+		count    int
+		wantName string
+	}{
+		{name: "json", handler: Default(), count: 10, wantName: "json"},
+		{name: "gob", handler: Gob(), count: 10, wantName: "gob"},
+		{name: "gob compressed, below threshold", handler: Compress(Gob(), 0), count: 1, wantName: "gob+gzip"},
+		{name: "gob compressed, above threshold", handler: Compress(Gob(), 0), count: 100, wantName: "gob+gzip"},
+		{name: "json compressed, above threshold", handler: Compress(Default(), 64), count: 10, wantName: "json+gzip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := newCachedUsers(tt.count)
+			bytesData, err := tt.handler.Marshal(want)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			var got cachedUsers
+			if err = tt.handler.Unmarshal(bytesData, &got); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Unmarshal() got = %v, want %v", got, want)
+			}
+			if name := tt.handler.Name(); name != tt.wantName {
+				t.Errorf("Name() got = %v, want %v", name, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestCompress_threshold(t *testing.T) {
+	handler := Compress(Default(), 64)
+
+	small, err := handler.Marshal("small")
+	if err != nil || small[0] != frameRaw || string(small[1:]) != `"small"` {
+		t.Errorf("Marshal() small = %q, %v, want raw frame", small, err)
+	}
+
+	large, err := handler.Marshal(strings.Repeat("a", 1000))
+	if err != nil || large[0] != frameGzip || len(large) >= 1000 {
+		t.Errorf("Marshal() large = %d bytes, %v, want a smaller gzip frame", len(large), err)
+	}
+
+	var result string
+	for _, bytesData := range [][]byte{nil, {9, 1, 2}, {frameGzip, 1, 2}} {
+		if err = handler.Unmarshal(bytesData, &result); err == nil {
+			t.Errorf("Unmarshal(%v) error = nil, want error", bytesData)
+		}
+	}
+}
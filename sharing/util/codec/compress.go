@@ -0,0 +1,80 @@
+package codec
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// DefaultCompressThreshold is the size in bytes data is compressed above
+const DefaultCompressThreshold = 1024
+
+// the first byte of data encoded by a Compress handler tells whether the rest is compressed
+const (
+	frameRaw  byte = 0
+	frameGzip byte = 1
+)
+
+type compressCodec struct {
+	handler   Handler
+	threshold int
+}
+
+// Compress gets a handler gzipping the data encoded by handler when larger than threshold bytes,
+// DefaultCompressThreshold when threshold is 0 or less
+func Compress(handler Handler, threshold int) Handler {
+	if threshold <= 0 {
+		threshold = DefaultCompressThreshold
+	}
+	return &compressCodec{handler: handler, threshold: threshold}
+}
+
+func (cc *compressCodec) Marshal(data interface{}) (bytesData []byte, err error) {
+	encoded, err := cc.handler.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(encoded) <= cc.threshold {
+		return append([]byte{frameRaw}, encoded...), nil
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteByte(frameGzip)
+	writer := gzip.NewWriter(&buffer)
+	if _, err = writer.Write(encoded); err != nil {
+		return nil, err
+	}
+	if err = writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (cc *compressCodec) Unmarshal(bytesData []byte, result interface{}) (err error) {
+	if len(bytesData) == 0 {
+		return fmt.Errorf("%s: empty data", cc.Name())
+	}
+
+	switch bytesData[0] {
+	case frameRaw:
+		return cc.handler.Unmarshal(bytesData[1:], result)
+	case frameGzip:
+		reader, err := gzip.NewReader(bytes.NewReader(bytesData[1:]))
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		encoded, err := io.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		return cc.handler.Unmarshal(encoded, result)
+	}
+	return fmt.Errorf("%s: unknown frame %d", cc.Name(), bytesData[0])
+}
+
+// Name gets the name of the wrapped handler followed by +gzip, e.g. gob+gzip
+func (cc *compressCodec) Name() string {
+	return cc.handler.Name() + "+gzip"
+}
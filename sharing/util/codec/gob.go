@@ -0,0 +1,33 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+// NameGob is the name of the Gob handler
+const NameGob = "gob"
+
+type gobCodec struct{}
+
+// Gob gets a handler encoding with encoding/gob, more compact and faster to decode than JSON
+// but readable only by Go, every value is encoded along with its type description
+func Gob() Handler {
+	return &gobCodec{}
+}
+
+func (gc *gobCodec) Marshal(data interface{}) (bytesData []byte, err error) {
+	var buffer bytes.Buffer
+	if err = gob.NewEncoder(&buffer).Encode(data); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (gc *gobCodec) Unmarshal(bytesData []byte, result interface{}) (err error) {
+	return gob.NewDecoder(bytes.NewReader(bytesData)).Decode(result)
+}
+
+func (gc *gobCodec) Name() string {
+	return NameGob
+}
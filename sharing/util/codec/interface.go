@@ -0,0 +1,8 @@
+package codec
+
+type Handler interface {
+	Marshal(data interface{}) (bytesData []byte, err error)
+	Unmarshal(bytesData []byte, result interface{}) (err error)
+	// Name identifies the encoding, data encoded by handlers with different names is not interchangeable
+	Name() string
+}
@@ -1,13 +1,41 @@
 package custerror
 
+import "strings"
+
+// FieldViolation describes a request field breaking a validation rule
+type FieldViolation struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
 type BadRequest struct {
-	message string
+	base
+	violations []FieldViolation
+}
+
+func NewBadRequest(message string, opts ...Option) *BadRequest {
+	return &BadRequest{base: newBase(message, CodeBadRequest, opts)}
+}
+
+// WrapBadRequest creates a BadRequest caused by cause, with the cause message when message is empty
+func WrapBadRequest(cause error, message string, opts ...Option) *BadRequest {
+	return NewBadRequest(wrapMessage(cause, message), append([]Option{WithCause(cause)}, opts...)...)
 }
 
-func NewBadRequest(message string) *BadRequest {
-	return &BadRequest{message: message}
+// NewBadRequestWithViolations creates a BadRequest aggregating every violation, its message joins the violation messages
+func NewBadRequestWithViolations(violations []FieldViolation, opts ...Option) *BadRequest {
+	messages := make([]string, 0, len(violations))
+	for _, violation := range violations {
+		messages = append(messages, violation.Message)
+	}
+	return &BadRequest{
+		base:       newBase(strings.Join(messages, "; "), CodeBadRequest, opts),
+		violations: violations,
+	}
 }
 
-func (br *BadRequest) Error() string {
-	return br.message
+// Violations gets the field violations causing the error, empty when created without violations
+func (br *BadRequest) Violations() []FieldViolation {
+	return br.violations
 }
@@ -0,0 +1,28 @@
+package custerror
+
+import (
+	"errors"
+	"net/http"
+)
+
+// IsRetryable reports whether the outermost custerror in the err chain is a TooManyRequests,
+// Unavailable or Timeout, which may succeed when the same call is made again later
+func IsRetryable(err error) bool {
+	var statusErr statusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	switch statusErr.(type) {
+	case *TooManyRequests, *Unavailable, *Timeout:
+		return true
+	}
+	return false
+}
+
+// IsClientError reports whether the outermost custerror in the err chain is caused by the request,
+// e.g. BadRequest or NotFound, which fails the same way when the same call is made again.
+// TooManyRequests is retryable rather than a client error
+func IsClientError(err error) bool {
+	status := GetHttpStatus(err)
+	return status >= http.StatusBadRequest && status < http.StatusInternalServerError && !IsRetryable(err)
+}
@@ -0,0 +1,38 @@
+package custerror
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name            string
+		err             error
+		wantRetryable   bool
+		wantClientError bool
+	}{
+		{name: "nil", err: nil},
+		{name: "BadRequest", err: NewBadRequest("invalid"), wantClientError: true},
+		{name: "NotFound", err: NewNotFound("not found"), wantClientError: true},
+		{name: "Conflict", err: NewConflict("duplicate"), wantClientError: true},
+		{name: "TooManyRequests", err: NewTooManyRequests("throttled"), wantRetryable: true},
+		{name: "Unavailable", err: NewUnavailable("down"), wantRetryable: true},
+		{name: "Timeout", err: NewTimeout("slow"), wantRetryable: true},
+		{name: "wrapped Unavailable", err: fmt.Errorf("notify: %w", NewUnavailable("down")), wantRetryable: true},
+		{name: "Internal wrapping Unavailable", err: WrapInternal(NewUnavailable("down"), "")},
+		{name: "Internal", err: NewInternal("failed")},
+		{name: "plain error", err: errors.New("failed")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.wantRetryable {
+				t.Errorf("IsRetryable() = %v, want %v", got, tt.wantRetryable)
+			}
+			if got := IsClientError(tt.err); got != tt.wantClientError {
+				t.Errorf("IsClientError() = %v, want %v", got, tt.wantClientError)
+			}
+		})
+	}
+}
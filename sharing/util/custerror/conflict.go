@@ -0,0 +1,15 @@
+package custerror
+
+// Conflict is a conflict with the current state of a resource, e.g. a duplicate
+type Conflict struct {
+	base
+}
+
+func NewConflict(message string, opts ...Option) *Conflict {
+	return &Conflict{base: newBase(message, CodeConflict, opts)}
+}
+
+// WrapConflict creates a Conflict caused by cause, with the cause message when message is empty
+func WrapConflict(cause error, message string, opts ...Option) *Conflict {
+	return NewConflict(wrapMessage(cause, message), append([]Option{WithCause(cause)}, opts...)...)
+}
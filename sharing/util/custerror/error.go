@@ -0,0 +1,111 @@
+package custerror
+
+import "errors"
+
+// Code is a stable machine readable identifier of an error, clients may rely on it unlike the message
+type Code string
+
+const (
+	CodeBadRequest Code = "bad_request"
+	CodeNotFound   Code = "not_found"
+	CodeInternal   Code = "internal"
+
+	CodeConflict        Code = "conflict"
+	CodeTooManyRequests Code = "too_many_requests"
+	CodeUnavailable     Code = "unavailable"
+	CodeTimeout         Code = "timeout"
+)
+
+// Error is implemented by every custerror kind
+type Error interface {
+	error
+	// Code gets the error code, the code of the error kind unless set by WithCode
+	Code() Code
+	// Details gets the optional details of the error, nil when none was set by WithDetail
+	Details() map[string]string
+}
+
+// Option sets an optional field of an error at creation
+type Option func(e *base)
+
+// WithCause wraps cause, which stays reachable by errors.Is & errors.As
+func WithCause(cause error) Option {
+	return func(e *base) {
+		e.cause = cause
+	}
+}
+
+// WithCode replaces the error kind code by a more specific one, e.g. "user_type_unknown"
+func WithCode(code Code) Option {
+	return func(e *base) {
+		e.code = code
+	}
+}
+
+// WithDetail adds a detail describing the error, e.g. the id of the missing resource
+func WithDetail(key string, value string) Option {
+	return func(e *base) {
+		if e.details == nil {
+			e.details = make(map[string]string)
+		}
+		e.details[key] = value
+	}
+}
+
+// base holds the fields shared by every error kind
+type base struct {
+	message string
+	code    Code
+	cause   error
+	details map[string]string
+}
+
+func newBase(message string, code Code, opts []Option) base {
+	e := base{message: message, code: code}
+	for _, opt := range opts {
+		opt(&e)
+	}
+	return e
+}
+
+// wrapMessage gets message, or the cause message when message is empty
+func wrapMessage(cause error, message string) string {
+	if message == "" && cause != nil {
+		return cause.Error()
+	}
+	return message
+}
+
+func (e *base) Error() string {
+	return e.message
+}
+
+func (e *base) Unwrap() error {
+	return e.cause
+}
+
+func (e *base) Code() Code {
+	return e.code
+}
+
+func (e *base) Details() map[string]string {
+	return e.details
+}
+
+// GetCode gets the code of the outermost custerror in the err chain, CodeInternal for any other error
+func GetCode(err error) Code {
+	var customErr Error
+	if errors.As(err, &customErr) {
+		return customErr.Code()
+	}
+	return CodeInternal
+}
+
+// GetDetails gets the details of the outermost custerror in the err chain
+func GetDetails(err error) map[string]string {
+	var customErr Error
+	if errors.As(err, &customErr) {
+		return customErr.Details()
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package custerror
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestWrapInternal(t *testing.T) {
+	cause := errors.New("connection refused")
+	err := fmt.Errorf("get users: %w", WrapInternal(cause, ""))
+
+	if !errors.Is(err, cause) {
+		t.Errorf("errors.Is() = false, want cause %v reachable", cause)
+	}
+	var internal *Internal
+	if !errors.As(err, &internal) {
+		t.Fatalf("errors.As() = false, want *Internal")
+	}
+	if internal.Error() != cause.Error() {
+		t.Errorf("Error() = %v, want %v", internal.Error(), cause.Error())
+	}
+	if got := WrapInternal(cause, "get users").Error(); got != "get users" {
+		t.Errorf("Error() = %v, want get users", got)
+	}
+}
+
+func TestGetCode(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantCode    Code
+		wantDetails map[string]string
+	}{
+		{
+			name:     "kind code",
+			err:      NewNotFound("user not found"),
+			wantCode: CodeNotFound,
+		},
+		{
+			name:        "specific code with details",
+			err:         NewBadRequest("unknown user type gold", WithCode("user_type_unknown"), WithDetail("user_type", "gold")),
+			wantCode:    "user_type_unknown",
+			wantDetails: map[string]string{"user_type": "gold"},
+		},
+		{
+			name:     "outermost custerror",
+			err:      WrapInternal(NewBadRequest("invalid"), "failed"),
+			wantCode: CodeInternal,
+		},
+		{
+			name:     "plain error",
+			err:      errors.New("failed"),
+			wantCode: CodeInternal,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GetCode(tt.err); got != tt.wantCode {
+				t.Errorf("GetCode() = %v, want %v", got, tt.wantCode)
+			}
+			if got := GetDetails(tt.err); !reflect.DeepEqual(got, tt.wantDetails) {
+				t.Errorf("GetDetails() = %v, want %v", got, tt.wantDetails)
+			}
+		})
+	}
+}
+
+func TestGetStatus(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		wantHttpStatus int
+		wantGrpcCode   GrpcCode
+	}{
+		{name: "nil", err: nil, wantHttpStatus: http.StatusOK, wantGrpcCode: GrpcCodeOk},
+		{name: "BadRequest", err: NewBadRequest("invalid"), wantHttpStatus: http.StatusBadRequest, wantGrpcCode: GrpcCodeInvalidArgument},
+		{name: "NotFound", err: NewNotFound("not found"), wantHttpStatus: http.StatusNotFound, wantGrpcCode: GrpcCodeNotFound},
+		{name: "Internal", err: NewInternal("failed"), wantHttpStatus: http.StatusInternalServerError, wantGrpcCode: GrpcCodeInternal},
+		{name: "Conflict", err: NewConflict("duplicate"), wantHttpStatus: http.StatusConflict, wantGrpcCode: GrpcCodeAborted},
+		{name: "TooManyRequests", err: NewTooManyRequests("throttled"), wantHttpStatus: http.StatusTooManyRequests, wantGrpcCode: GrpcCodeResourceExhausted},
+		{name: "Unavailable", err: NewUnavailable("down"), wantHttpStatus: http.StatusServiceUnavailable, wantGrpcCode: GrpcCodeUnavailable},
+		{name: "Timeout", err: NewTimeout("slow"), wantHttpStatus: http.StatusGatewayTimeout, wantGrpcCode: GrpcCodeDeadlineExceeded},
+		{name: "Internal wrapping NotFound", err: WrapInternal(NewNotFound("not found"), ""), wantHttpStatus: http.StatusInternalServerError, wantGrpcCode: GrpcCodeInternal},
+		{name: "wrapped NotFound", err: fmt.Errorf("get: %w", NewNotFound("not found")), wantHttpStatus: http.StatusNotFound, wantGrpcCode: GrpcCodeNotFound},
+		{name: "plain error", err: errors.New("failed"), wantHttpStatus: http.StatusInternalServerError, wantGrpcCode: GrpcCodeInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GetHttpStatus(tt.err); got != tt.wantHttpStatus {
+				t.Errorf("GetHttpStatus() = %v, want %v", got, tt.wantHttpStatus)
+			}
+			if got := GetGrpcCode(tt.err); got != tt.wantGrpcCode {
+				t.Errorf("GetGrpcCode() = %v, want %v", got, tt.wantGrpcCode)
+			}
+		})
+	}
+}
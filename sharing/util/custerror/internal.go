@@ -1,13 +1,14 @@
 package custerror
 
 type Internal struct {
-	message string
+	base
 }
 
-func NewInternal(message string) *Internal {
-	return &Internal{message: message}
+func NewInternal(message string, opts ...Option) *Internal {
+	return &Internal{base: newBase(message, CodeInternal, opts)}
 }
 
-func (i *Internal) Error() string {
-	return i.message
+// WrapInternal creates an Internal caused by cause, with the cause message when message is empty
+func WrapInternal(cause error, message string, opts ...Option) *Internal {
+	return NewInternal(wrapMessage(cause, message), append([]Option{WithCause(cause)}, opts...)...)
 }
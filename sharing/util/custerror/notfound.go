@@ -1,13 +1,14 @@
 package custerror
 
 type NotFound struct {
-	message string
+	base
 }
 
-func NewNotFound(message string) *NotFound {
-	return &NotFound{message: message}
+func NewNotFound(message string, opts ...Option) *NotFound {
+	return &NotFound{base: newBase(message, CodeNotFound, opts)}
 }
 
-func (nf *NotFound) Error() string {
-	return nf.message
+// WrapNotFound creates a NotFound caused by cause, with the cause message when message is empty
+func WrapNotFound(cause error, message string, opts ...Option) *NotFound {
+	return NewNotFound(wrapMessage(cause, message), append([]Option{WithCause(cause)}, opts...)...)
 }
@@ -0,0 +1,110 @@
+package custerror
+
+import (
+	"errors"
+	"net/http"
+)
+
+// GrpcCode mirrors the canonical gRPC status codes of google.golang.org/grpc/codes,
+// it converts directly with codes.Code(custerror.GetGrpcCode(err))
+type GrpcCode uint32
+
+const (
+	GrpcCodeOk                GrpcCode = 0
+	GrpcCodeInvalidArgument   GrpcCode = 3
+	GrpcCodeDeadlineExceeded  GrpcCode = 4
+	GrpcCodeNotFound          GrpcCode = 5
+	GrpcCodeResourceExhausted GrpcCode = 8
+	GrpcCodeAborted           GrpcCode = 10
+	GrpcCodeInternal          GrpcCode = 13
+	GrpcCodeUnavailable       GrpcCode = 14
+)
+
+// statusError is implemented by every error kind to map itself to transport statuses
+type statusError interface {
+	error
+	httpStatus() int
+	grpcCode() GrpcCode
+}
+
+func (br *BadRequest) httpStatus() int {
+	return http.StatusBadRequest
+}
+
+func (br *BadRequest) grpcCode() GrpcCode {
+	return GrpcCodeInvalidArgument
+}
+
+func (nf *NotFound) httpStatus() int {
+	return http.StatusNotFound
+}
+
+func (nf *NotFound) grpcCode() GrpcCode {
+	return GrpcCodeNotFound
+}
+
+func (i *Internal) httpStatus() int {
+	return http.StatusInternalServerError
+}
+
+func (i *Internal) grpcCode() GrpcCode {
+	return GrpcCodeInternal
+}
+
+func (c *Conflict) httpStatus() int {
+	return http.StatusConflict
+}
+
+func (c *Conflict) grpcCode() GrpcCode {
+	return GrpcCodeAborted
+}
+
+func (tmr *TooManyRequests) httpStatus() int {
+	return http.StatusTooManyRequests
+}
+
+func (tmr *TooManyRequests) grpcCode() GrpcCode {
+	return GrpcCodeResourceExhausted
+}
+
+func (u *Unavailable) httpStatus() int {
+	return http.StatusServiceUnavailable
+}
+
+func (u *Unavailable) grpcCode() GrpcCode {
+	return GrpcCodeUnavailable
+}
+
+func (t *Timeout) httpStatus() int {
+	return http.StatusGatewayTimeout
+}
+
+func (t *Timeout) grpcCode() GrpcCode {
+	return GrpcCodeDeadlineExceeded
+}
+
+// GetHttpStatus maps the outermost custerror in the err chain to an HTTP status,
+// any other error is an internal server error and a nil error is OK
+func GetHttpStatus(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	var statusErr statusError
+	if errors.As(err, &statusErr) {
+		return statusErr.httpStatus()
+	}
+	return http.StatusInternalServerError
+}
+
+// GetGrpcCode maps the outermost custerror in the err chain to a gRPC status code,
+// any other error is internal and a nil error is OK
+func GetGrpcCode(err error) GrpcCode {
+	if err == nil {
+		return GrpcCodeOk
+	}
+	var statusErr statusError
+	if errors.As(err, &statusErr) {
+		return statusErr.grpcCode()
+	}
+	return GrpcCodeInternal
+}
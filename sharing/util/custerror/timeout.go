@@ -0,0 +1,15 @@
+package custerror
+
+// Timeout is a dependency not responding in time, it may be retried later
+type Timeout struct {
+	base
+}
+
+func NewTimeout(message string, opts ...Option) *Timeout {
+	return &Timeout{base: newBase(message, CodeTimeout, opts)}
+}
+
+// WrapTimeout creates a Timeout caused by cause, with the cause message when message is empty
+func WrapTimeout(cause error, message string, opts ...Option) *Timeout {
+	return NewTimeout(wrapMessage(cause, message), append([]Option{WithCause(cause)}, opts...)...)
+}
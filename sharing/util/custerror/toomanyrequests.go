@@ -0,0 +1,15 @@
+package custerror
+
+// TooManyRequests is a request throttled by a rate limit, it may be retried later
+type TooManyRequests struct {
+	base
+}
+
+func NewTooManyRequests(message string, opts ...Option) *TooManyRequests {
+	return &TooManyRequests{base: newBase(message, CodeTooManyRequests, opts)}
+}
+
+// WrapTooManyRequests creates a TooManyRequests caused by cause, with the cause message when message is empty
+func WrapTooManyRequests(cause error, message string, opts ...Option) *TooManyRequests {
+	return NewTooManyRequests(wrapMessage(cause, message), append([]Option{WithCause(cause)}, opts...)...)
+}
@@ -0,0 +1,15 @@
+package custerror
+
+// Unavailable is a dependency temporarily unable to serve, it may be retried later
+type Unavailable struct {
+	base
+}
+
+func NewUnavailable(message string, opts ...Option) *Unavailable {
+	return &Unavailable{base: newBase(message, CodeUnavailable, opts)}
+}
+
+// WrapUnavailable creates a Unavailable caused by cause, with the cause message when message is empty
+func WrapUnavailable(cause error, message string, opts ...Option) *Unavailable {
+	return NewUnavailable(wrapMessage(cause, message), append([]Option{WithCause(cause)}, opts...)...)
+}
@@ -1,6 +1,13 @@
 package json
 
+import "io"
+
 type Handler interface {
 	Marshal(data interface{}) (bytesData []byte, err error)
 	Unmarshal(bytesData []byte, result interface{}) (err error)
+	// Encode writes data to writer without buffering the whole encoding, followed by a newline
+	Encode(writer io.Writer, data interface{}) (err error)
+	// Decode reads a single JSON value of reader into result without buffering the whole input,
+	// io.EOF when reader is empty, reader may be read past the value so it should not be decoded again
+	Decode(reader io.Reader, result interface{}) (err error)
 }
@@ -2,12 +2,16 @@ package json
 
 import (
 	"encoding/json"
+	"io"
 	"sync"
 )
 
 var instance Handler
 var syncOnce sync.Once
 
+// mutex guards instance, which may be replaced while goroutines are using it
+var mutex sync.RWMutex
+
 func init() {
 	if instance == nil {
 		syncOnce.Do(func() {
@@ -22,10 +26,20 @@ func Default() Handler {
 	return &defaultJsonHandler{}
 }
 
+// SetHandler replaces the handler used by the package functions, it is safe to call concurrently with them
 func SetHandler(handler Handler) {
+	mutex.Lock()
+	defer mutex.Unlock()
 	instance = handler
 }
 
+// Instance gets the handler used by the package functions
+func Instance() Handler {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return instance
+}
+
 func (djh *defaultJsonHandler) Marshal(data interface{}) (bytesData []byte, err error) {
 	return json.Marshal(data)
 }
@@ -34,10 +48,26 @@ func (djh *defaultJsonHandler) Unmarshal(bytesData []byte, result interface{}) (
 	return json.Unmarshal(bytesData, result)
 }
 
+func (djh *defaultJsonHandler) Encode(writer io.Writer, data interface{}) (err error) {
+	return json.NewEncoder(writer).Encode(data)
+}
+
+func (djh *defaultJsonHandler) Decode(reader io.Reader, result interface{}) (err error) {
+	return json.NewDecoder(reader).Decode(result)
+}
+
 func Marshal(data interface{}) (bytesData []byte, err error) {
-	return instance.Marshal(data)
+	return Instance().Marshal(data)
 }
 
 func Unmarshal(bytesData []byte, result interface{}) (err error) {
-	return instance.Unmarshal(bytesData, result)
+	return Instance().Unmarshal(bytesData, result)
+}
+
+func Encode(writer io.Writer, data interface{}) (err error) {
+	return Instance().Encode(writer, data)
+}
+
+func Decode(reader io.Reader, result interface{}) (err error) {
+	return Instance().Decode(reader, result)
 }
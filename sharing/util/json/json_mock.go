@@ -5,6 +5,7 @@
 package json
 
 import (
+	io "io"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
@@ -33,6 +34,34 @@ func (m *MockHandler) EXPECT() *MockHandlerMockRecorder {
 	return m.recorder
 }
 
+// Decode mocks base method.
+func (m *MockHandler) Decode(reader io.Reader, result interface{}) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Decode", reader, result)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Decode indicates an expected call of Decode.
+func (mr *MockHandlerMockRecorder) Decode(reader, result interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Decode", reflect.TypeOf((*MockHandler)(nil).Decode), reader, result)
+}
+
+// Encode mocks base method.
+func (m *MockHandler) Encode(writer io.Writer, data interface{}) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Encode", writer, data)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Encode indicates an expected call of Encode.
+func (mr *MockHandlerMockRecorder) Encode(writer, data interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Encode", reflect.TypeOf((*MockHandler)(nil).Encode), writer, data)
+}
+
 // Marshal mocks base method.
 func (m *MockHandler) Marshal(data interface{}) ([]byte, error) {
 	m.ctrl.T.Helper()
@@ -0,0 +1,63 @@
+package json
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSetHandler_concurrent(t *testing.T) {
+	defer SetHandler(Default())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			SetHandler(Default())
+		}()
+		go func() {
+			defer wg.Done()
+			var result []int
+			if err := Unmarshal([]byte("[1,2]"), &result); err != nil || len(result) != 2 {
+				t.Errorf("Unmarshal() = %v, %v, want [1 2]", result, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if _, ok := Instance().(*defaultJsonHandler); !ok {
+		t.Errorf("Instance() = %T, want the default handler", Instance())
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	type user struct {
+		Id   int64  `json:"id"`
+		Name string `json:"name"`
+	}
+	users := []user{{Id: 1, Name: "a"}, {Id: 2, Name: "b"}}
+
+	var buffer bytes.Buffer
+	if err := Encode(&buffer, users); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	if got, want := buffer.String(), `[{"id":1,"name":"a"},{"id":2,"name":"b"}]`+"\n"; got != want {
+		t.Errorf("Encode() got = %q, want %q", got, want)
+	}
+
+	var got []user
+	if err := Decode(&buffer, &got); err != nil || !reflect.DeepEqual(got, users) {
+		t.Errorf("Decode() = %v, %v, want %v", got, err, users)
+	}
+	if err := Decode(strings.NewReader(""), &got); !errors.Is(err, io.EOF) {
+		t.Errorf("Decode() error = %v, want io.EOF", err)
+	}
+	if err := Decode(strings.NewReader(`[{"id":`), &got); err == nil {
+		t.Errorf("Decode() error = nil, want error")
+	}
+}
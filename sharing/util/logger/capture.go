@@ -0,0 +1,56 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// Entry is a logged entry kept by Capture, Fields holds the ctx fields and args by key
+type Entry struct {
+	Level   slog.Level
+	Message string
+	Fields  map[string]interface{}
+}
+
+// Capture is a Logger keeping every entry in memory so tests can assert what was logged
+type Capture struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+func NewCapture() *Capture {
+	return &Capture{}
+}
+
+// Entries gets a copy of the entries logged so far, in logging order
+func (c *Capture) Entries() []Entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Entry(nil), c.entries...)
+}
+
+func (c *Capture) Info(ctx context.Context, message string, args ...interface{}) {
+	c.log(ctx, slog.LevelInfo, message, args)
+}
+
+func (c *Capture) Warn(ctx context.Context, message string, args ...interface{}) {
+	c.log(ctx, slog.LevelWarn, message, args)
+}
+
+func (c *Capture) Error(ctx context.Context, message string, args ...interface{}) {
+	c.log(ctx, slog.LevelError, message, args)
+}
+
+func (c *Capture) log(ctx context.Context, level slog.Level, message string, args []interface{}) {
+	pairs := append(Fields(ctx), args...)
+	fields := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		fields[fmt.Sprint(pairs[i])] = pairs[i+1]
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = append(c.entries, Entry{Level: level, Message: message, Fields: fields})
+}
@@ -0,0 +1,11 @@
+package logger
+
+import "context"
+
+// Logger writes structured entries, args are alternating keys and values
+// added after the fields of ctx set by WithFields
+type Logger interface {
+	Info(ctx context.Context, message string, args ...interface{})
+	Warn(ctx context.Context, message string, args ...interface{})
+	Error(ctx context.Context, message string, args ...interface{})
+}
@@ -0,0 +1,64 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+)
+
+const (
+	FieldRequestId = "request_id"
+	FieldUserType  = "user_type"
+	FieldError     = "error"
+)
+
+type fieldsKey struct{}
+
+// WithFields gets a ctx whose entries are logged with args, alternating keys and values, e.g. the request id
+func WithFields(ctx context.Context, args ...interface{}) context.Context {
+	fields := Fields(ctx)
+	merged := make([]interface{}, 0, len(fields)+len(args))
+	merged = append(merged, fields...)
+	merged = append(merged, args...)
+	return context.WithValue(ctx, fieldsKey{}, merged)
+}
+
+// Fields gets the fields added to ctx by WithFields
+func Fields(ctx context.Context) []interface{} {
+	fields, _ := ctx.Value(fieldsKey{}).([]interface{})
+	return fields
+}
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// Default creates a Logger writing to slog.Default
+func Default() Logger {
+	return &slogLogger{}
+}
+
+// Slog creates a Logger writing to logger
+func Slog(logger *slog.Logger) Logger {
+	return &slogLogger{logger: logger}
+}
+
+func (sl *slogLogger) Info(ctx context.Context, message string, args ...interface{}) {
+	sl.log(ctx, slog.LevelInfo, message, args)
+}
+
+func (sl *slogLogger) Warn(ctx context.Context, message string, args ...interface{}) {
+	sl.log(ctx, slog.LevelWarn, message, args)
+}
+
+func (sl *slogLogger) Error(ctx context.Context, message string, args ...interface{}) {
+	sl.log(ctx, slog.LevelError, message, args)
+}
+
+func (sl *slogLogger) log(ctx context.Context, level slog.Level, message string, args []interface{}) {
+	// slog.Default is read on every entry so a later slog.SetDefault is followed
+	logger := sl.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger.Log(ctx, level, message, append(Fields(ctx), args...)...)
+}
@@ -0,0 +1,48 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSlog(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := Slog(slog.New(slog.NewJSONHandler(&buffer, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if attr.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return attr
+		},
+	})))
+	ctx := WithFields(context.Background(), FieldRequestId, "req-1")
+
+	logger.Error(ctx, "save failed", FieldError, errors.New("disk full"), "count", 2)
+
+	want := `{"level":"ERROR","msg":"save failed","request_id":"req-1","error":"disk full","count":2}`
+	if got := strings.TrimSpace(buffer.String()); got != want {
+		t.Errorf("Error() wrote %v, want %v", got, want)
+	}
+}
+
+func TestCapture(t *testing.T) {
+	capture := NewCapture()
+	ctx := WithFields(context.Background(), FieldRequestId, "req-1")
+	ctx = WithFields(ctx, FieldUserType, "premium")
+
+	capture.Info(ctx, "started")
+	capture.Warn(context.Background(), "cache unavailable", "key", "users:premium")
+
+	want := []Entry{
+		{Level: slog.LevelInfo, Message: "started", Fields: map[string]interface{}{FieldRequestId: "req-1", FieldUserType: "premium"}},
+		{Level: slog.LevelWarn, Message: "cache unavailable", Fields: map[string]interface{}{"key": "users:premium"}},
+	}
+	if got := capture.Entries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Entries() = %v, want %v", got, want)
+	}
+}
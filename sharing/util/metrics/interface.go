@@ -0,0 +1,9 @@
+package metrics
+
+// Metrics records measurements identified by a name and labels
+type Metrics interface {
+	// Inc adds 1 to the counter name
+	Inc(name string, labels ...Label)
+	// Observe records value, e.g. a latency in seconds, into the summary name
+	Observe(name string, value float64, labels ...Label)
+}
@@ -0,0 +1,21 @@
+package metrics
+
+type Label struct {
+	Name  string
+	Value string
+}
+
+func NewLabel(name string, value string) Label {
+	return Label{Name: name, Value: value}
+}
+
+type noopMetrics struct{}
+
+// Noop creates a Metrics discarding every measurement
+func Noop() Metrics {
+	return &noopMetrics{}
+}
+
+func (nm *noopMetrics) Inc(name string, labels ...Label) {}
+
+func (nm *noopMetrics) Observe(name string, value float64, labels ...Label) {}
@@ -0,0 +1,68 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: util/metrics/interface.go
+
+// Package metrics is a generated GoMock package.
+package metrics
+
+import (
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockMetrics is a mock of Metrics interface.
+type MockMetrics struct {
+	ctrl     *gomock.Controller
+	recorder *MockMetricsMockRecorder
+}
+
+// MockMetricsMockRecorder is the mock recorder for MockMetrics.
+type MockMetricsMockRecorder struct {
+	mock *MockMetrics
+}
+
+// NewMockMetrics creates a new mock instance.
+func NewMockMetrics(ctrl *gomock.Controller) *MockMetrics {
+	mock := &MockMetrics{ctrl: ctrl}
+	mock.recorder = &MockMetricsMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockMetrics) EXPECT() *MockMetricsMockRecorder {
+	return m.recorder
+}
+
+// Inc mocks base method.
+func (m *MockMetrics) Inc(name string, labels ...Label) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{name}
+	for _, a := range labels {
+		varargs = append(varargs, a)
+	}
+	m.ctrl.Call(m, "Inc", varargs...)
+}
+
+// Inc indicates an expected call of Inc.
+func (mr *MockMetricsMockRecorder) Inc(name interface{}, labels ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{name}, labels...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Inc", reflect.TypeOf((*MockMetrics)(nil).Inc), varargs...)
+}
+
+// Observe mocks base method.
+func (m *MockMetrics) Observe(name string, value float64, labels ...Label) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{name, value}
+	for _, a := range labels {
+		varargs = append(varargs, a)
+	}
+	m.ctrl.Call(m, "Observe", varargs...)
+}
+
+// Observe indicates an expected call of Observe.
+func (mr *MockMetricsMockRecorder) Observe(name, value interface{}, labels ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{name, value}, labels...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Observe", reflect.TypeOf((*MockMetrics)(nil).Observe), varargs...)
+}
@@ -0,0 +1,173 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	typeCounter = "counter"
+	typeSummary = "summary"
+
+	contentTypePrometheus = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// Prometheus keeps measurements in memory and exposes them in the Prometheus text format,
+// observations are exposed as summaries without quantiles
+type Prometheus struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+type family struct {
+	metricType string
+	series     map[string]*series
+}
+
+type series struct {
+	labels string
+	count  uint64
+	sum    float64
+}
+
+func NewPrometheus() *Prometheus {
+	return &Prometheus{families: make(map[string]*family)}
+}
+
+func (p *Prometheus) Inc(name string, labels ...Label) {
+	p.record(name, typeCounter, 1, labels)
+}
+
+func (p *Prometheus) Observe(name string, value float64, labels ...Label) {
+	p.record(name, typeSummary, value, labels)
+}
+
+func (p *Prometheus) record(name string, metricType string, value float64, labels []Label) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	f, ok := p.families[name]
+	if !ok {
+		f = &family{metricType: metricType, series: make(map[string]*series)}
+		p.families[name] = f
+	}
+	key := formatLabels(labels)
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: key}
+		f.series[key] = s
+	}
+	s.count++
+	s.sum += value
+}
+
+// WriteTo writes every measurement in the Prometheus text format, sorted by name and labels,
+// the measurements are copied first so a slow writer does not block the recording
+func (p *Prometheus) WriteTo(w io.Writer) (n int64, err error) {
+	writer := &countingWriter{writer: bufio.NewWriter(w)}
+	for _, f := range p.snapshot() {
+		writer.writeLine("# TYPE ", f.name, " ", f.metricType)
+		for _, s := range f.series {
+			if f.metricType == typeCounter {
+				writer.writeLine(f.name, s.labels, " ", strconv.FormatUint(s.count, 10))
+				continue
+			}
+			writer.writeLine(f.name, "_sum", s.labels, " ", strconv.FormatFloat(s.sum, 'g', -1, 64))
+			writer.writeLine(f.name, "_count", s.labels, " ", strconv.FormatUint(s.count, 10))
+		}
+	}
+	if writer.err == nil {
+		writer.err = writer.writer.Flush()
+	}
+	return writer.n, writer.err
+}
+
+// familySnapshot is a copy of a family with its series sorted by labels
+type familySnapshot struct {
+	name       string
+	metricType string
+	series     []series
+}
+
+// snapshot copies every family sorted by name
+func (p *Prometheus) snapshot() []familySnapshot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	snapshots := make([]familySnapshot, 0, len(p.families))
+	for name, f := range p.families {
+		snapshots = append(snapshots, familySnapshot{name: name, metricType: f.metricType, series: sortedSeries(f)})
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].name < snapshots[j].name
+	})
+	return snapshots
+}
+
+// ServeHTTP exposes the measurements to a Prometheus scrape
+func (p *Prometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", contentTypePrometheus)
+	p.WriteTo(w)
+}
+
+// sortedSeries copies the series of f sorted by labels
+func sortedSeries(f *family) []series {
+	sorted := make([]series, 0, len(f.series))
+	for _, s := range f.series {
+		sorted = append(sorted, *s)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].labels < sorted[j].labels
+	})
+	return sorted
+}
+
+// formatLabels formats labels sorted by name, e.g. {channel="email",status="success"}, empty without labels
+func formatLabels(labels []Label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	sorted := append([]Label(nil), labels...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	var builder strings.Builder
+	builder.WriteByte('{')
+	for i, label := range sorted {
+		if i > 0 {
+			builder.WriteByte(',')
+		}
+		builder.WriteString(label.Name)
+		builder.WriteString(`="`)
+		builder.WriteString(labelValueReplacer.Replace(label.Value))
+		builder.WriteByte('"')
+	}
+	builder.WriteByte('}')
+	return builder.String()
+}
+
+// labelValueReplacer escapes label values as required by the text format
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+type countingWriter struct {
+	writer *bufio.Writer
+	n      int64
+	err    error
+}
+
+func (cw *countingWriter) writeLine(parts ...string) {
+	for _, part := range append(parts, "\n") {
+		if cw.err != nil {
+			return
+		}
+		var written int
+		written, cw.err = cw.writer.WriteString(part)
+		cw.n += int64(written)
+	}
+}
@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPrometheus_WriteTo(t *testing.T) {
+	prometheus := NewPrometheus()
+	prometheus.Inc("notify_total", NewLabel("status", "success"), NewLabel("channel", "email"))
+	prometheus.Inc("notify_total", NewLabel("channel", "email"), NewLabel("status", "success"))
+	prometheus.Inc("notify_total", NewLabel("channel", "phone"), NewLabel("status", "failure"))
+	prometheus.Inc("cache_hits_total")
+	prometheus.Observe("notify_duration_seconds", 0.25, NewLabel("channel", "email"))
+	prometheus.Observe("notify_duration_seconds", 0.5, NewLabel("channel", "email"))
+	prometheus.Inc("repository_errors_total", NewLabel("operation", `Get"By\Ids`))
+
+	want := `# TYPE cache_hits_total counter
+cache_hits_total 1
+# TYPE notify_duration_seconds summary
+notify_duration_seconds_sum{channel="email"} 0.75
+notify_duration_seconds_count{channel="email"} 2
+# TYPE notify_total counter
+notify_total{channel="email",status="success"} 2
+notify_total{channel="phone",status="failure"} 1
+# TYPE repository_errors_total counter
+repository_errors_total{operation="Get\"By\\Ids"} 1
+`
+	var buffer bytes.Buffer
+	n, err := prometheus.WriteTo(&buffer)
+	if err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	if got := buffer.String(); got != want || n != int64(len(want)) {
+		t.Errorf("WriteTo() = %v, %v, want %v, %v", n, got, len(want), want)
+	}
+}
+
+// recordingWriter records a measurement on every write, like a slow scrape racing with the service
+type recordingWriter struct {
+	bytes.Buffer
+	prometheus *Prometheus
+}
+
+func (rw *recordingWriter) Write(p []byte) (int, error) {
+	rw.prometheus.Inc("scrape_writes_total")
+	return rw.Buffer.Write(p)
+}
+
+func TestPrometheus_WriteTo_recordWhileWriting(t *testing.T) {
+	prometheus := NewPrometheus()
+	prometheus.Inc("cache_hits_total")
+
+	writer := &recordingWriter{prometheus: prometheus}
+	done := make(chan error, 1)
+	go func() {
+		_, err := prometheus.WriteTo(writer)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("WriteTo() error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("WriteTo() blocked recording while writing")
+	}
+	if want := "# TYPE cache_hits_total counter\ncache_hits_total 1\n"; writer.String() != want {
+		t.Errorf("WriteTo() = %v, want %v", writer.String(), want)
+	}
+}
+
+func TestPrometheus_ServeHTTP(t *testing.T) {
+	prometheus := NewPrometheus()
+	prometheus.Inc("cache_misses_total")
+
+	recorder := httptest.NewRecorder()
+	prometheus.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if got := recorder.Header().Get("Content-Type"); got != contentTypePrometheus {
+		t.Errorf("ServeHTTP() content type = %v, want %v", got, contentTypePrometheus)
+	}
+	if want := "# TYPE cache_misses_total counter\ncache_misses_total 1\n"; recorder.Body.String() != want {
+		t.Errorf("ServeHTTP() body = %v, want %v", recorder.Body.String(), want)
+	}
+}
@@ -0,0 +1,17 @@
+package tracing
+
+import "context"
+
+type Tracer interface {
+	// Start starts a span named name, child of the span in ctx if any, the returned ctx carries the new span
+	Start(ctx context.Context, name string, attributes ...Attribute) (context.Context, Span)
+}
+
+type Span interface {
+	SetAttributes(attributes ...Attribute)
+	// RecordError marks the span as failed with err, a nil err is ignored
+	RecordError(err error)
+	// End finishes the span, it is exported once ended
+	End()
+	SpanContext() SpanContext
+}
@@ -0,0 +1,104 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SpanData is an ended span kept by Memory
+type SpanData struct {
+	SpanContext
+	ParentSpanId string
+	Name         string
+	Attributes   map[string]interface{}
+	Err          error
+	StartedAt    time.Time
+	EndedAt      time.Time
+}
+
+// Memory is a Tracer keeping every ended span in memory so tests can assert what was traced
+type Memory struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (m *Memory) Start(ctx context.Context, name string, attributes ...Attribute) (context.Context, Span) {
+	parent := SpanFromContext(ctx).SpanContext()
+	traceId := parent.TraceId
+	if traceId == "" {
+		traceId = newId(16)
+	}
+
+	span := &memorySpan{
+		memory: m,
+		data: SpanData{
+			SpanContext:  SpanContext{TraceId: traceId, SpanId: newId(8)},
+			ParentSpanId: parent.SpanId,
+			Name:         name,
+			Attributes:   make(map[string]interface{}, len(attributes)),
+			StartedAt:    time.Now(),
+		},
+	}
+	span.SetAttributes(attributes...)
+	return ContextWithSpan(ctx, span), span
+}
+
+// Spans gets a copy of the spans ended so far, in ending order
+func (m *Memory) Spans() []SpanData {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]SpanData(nil), m.spans...)
+}
+
+func (m *Memory) export(data SpanData) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.spans = append(m.spans, data)
+}
+
+type memorySpan struct {
+	memory *Memory
+	mu     sync.Mutex
+	data   SpanData
+	ended  bool
+}
+
+func (ms *memorySpan) SetAttributes(attributes ...Attribute) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for _, attribute := range attributes {
+		ms.data.Attributes[attribute.Key] = attribute.Value
+	}
+}
+
+func (ms *memorySpan) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.data.Err = err
+}
+
+func (ms *memorySpan) End() {
+	ms.mu.Lock()
+	if ms.ended {
+		ms.mu.Unlock()
+		return
+	}
+	ms.ended = true
+	ms.data.EndedAt = time.Now()
+	data := ms.data
+	ms.mu.Unlock()
+
+	ms.memory.export(data)
+}
+
+func (ms *memorySpan) SpanContext() SpanContext {
+	return ms.data.SpanContext
+}
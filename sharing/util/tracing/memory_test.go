@@ -0,0 +1,43 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestMemory(t *testing.T) {
+	memory := NewMemory()
+	errNotify := errors.New("failed")
+
+	ctx, parent := memory.Start(context.Background(), "parent", NewAttribute("user_type", "premium"))
+	childCtx, child := memory.Start(ctx, "child")
+	child.RecordError(errNotify)
+	child.End()
+	child.End()
+	parent.End()
+
+	spans := memory.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("Spans() = %v, want 2 spans", spans)
+	}
+	gotChild, gotParent := spans[0], spans[1]
+	if gotChild.Name != "child" || gotParent.Name != "parent" {
+		t.Errorf("Spans() names = %v, %v, want child, parent", gotChild.Name, gotParent.Name)
+	}
+	if gotChild.TraceId != gotParent.TraceId || gotChild.ParentSpanId != gotParent.SpanId || gotParent.ParentSpanId != "" {
+		t.Errorf("Spans() child = %+v, parent = %+v, want child of parent in the same trace", gotChild.SpanContext, gotParent.SpanContext)
+	}
+	if gotChild.Err != errNotify || gotParent.Attributes["user_type"] != "premium" {
+		t.Errorf("Spans() child error = %v, parent attributes = %v", gotChild.Err, gotParent.Attributes)
+	}
+
+	want := fmt.Sprintf("00-%s-%s-01", gotChild.TraceId, gotChild.SpanId)
+	if got := TraceParent(childCtx); got != want {
+		t.Errorf("TraceParent() = %v, want %v", got, want)
+	}
+	if got := TraceParent(context.Background()); got != "" {
+		t.Errorf("TraceParent() = %v, want empty", got)
+	}
+}
@@ -0,0 +1,82 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+func NewAttribute(key string, value interface{}) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// SpanContext identifies a span across process boundaries
+type SpanContext struct {
+	TraceId string
+	SpanId  string
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceId != "" && sc.SpanId != ""
+}
+
+type spanKey struct{}
+
+// ContextWithSpan gets a ctx carrying span, spans started from it are its children
+func ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext gets the span carried by ctx, a span doing nothing when there is none
+func SpanFromContext(ctx context.Context) Span {
+	if span, ok := ctx.Value(spanKey{}).(Span); ok {
+		return span
+	}
+	return noopSpan{}
+}
+
+// TraceParent formats the span carried by ctx as a W3C traceparent header value so a Notifier
+// can propagate it to the provider, empty when ctx carries no span
+func TraceParent(ctx context.Context) string {
+	spanContext := SpanFromContext(ctx).SpanContext()
+	if !spanContext.IsValid() {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-01", spanContext.TraceId, spanContext.SpanId)
+}
+
+type noopTracer struct{}
+
+type noopSpan struct{}
+
+// Noop creates a Tracer whose spans do nothing, ctx is returned unchanged
+func Noop() Tracer {
+	return noopTracer{}
+}
+
+func (nt noopTracer) Start(ctx context.Context, name string, attributes ...Attribute) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+func (ns noopSpan) SetAttributes(attributes ...Attribute) {}
+
+func (ns noopSpan) RecordError(err error) {}
+
+func (ns noopSpan) End() {}
+
+func (ns noopSpan) SpanContext() SpanContext {
+	return SpanContext{}
+}
+
+// newId gets a random hex id of size bytes
+func newId(size int) string {
+	id := make([]byte, size)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,132 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: util/tracing/interface.go
+
+// Package tracing is a generated GoMock package.
+package tracing
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockTracer is a mock of Tracer interface.
+type MockTracer struct {
+	ctrl     *gomock.Controller
+	recorder *MockTracerMockRecorder
+}
+
+// MockTracerMockRecorder is the mock recorder for MockTracer.
+type MockTracerMockRecorder struct {
+	mock *MockTracer
+}
+
+// NewMockTracer creates a new mock instance.
+func NewMockTracer(ctrl *gomock.Controller) *MockTracer {
+	mock := &MockTracer{ctrl: ctrl}
+	mock.recorder = &MockTracerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTracer) EXPECT() *MockTracerMockRecorder {
+	return m.recorder
+}
+
+// Start mocks base method.
+func (m *MockTracer) Start(ctx context.Context, name string, attributes ...Attribute) (context.Context, Span) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, name}
+	for _, a := range attributes {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Start", varargs...)
+	ret0, _ := ret[0].(context.Context)
+	ret1, _ := ret[1].(Span)
+	return ret0, ret1
+}
+
+// Start indicates an expected call of Start.
+func (mr *MockTracerMockRecorder) Start(ctx, name interface{}, attributes ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, name}, attributes...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Start", reflect.TypeOf((*MockTracer)(nil).Start), varargs...)
+}
+
+// MockSpan is a mock of Span interface.
+type MockSpan struct {
+	ctrl     *gomock.Controller
+	recorder *MockSpanMockRecorder
+}
+
+// MockSpanMockRecorder is the mock recorder for MockSpan.
+type MockSpanMockRecorder struct {
+	mock *MockSpan
+}
+
+// NewMockSpan creates a new mock instance.
+func NewMockSpan(ctrl *gomock.Controller) *MockSpan {
+	mock := &MockSpan{ctrl: ctrl}
+	mock.recorder = &MockSpanMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSpan) EXPECT() *MockSpanMockRecorder {
+	return m.recorder
+}
+
+// End mocks base method.
+func (m *MockSpan) End() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "End")
+}
+
+// End indicates an expected call of End.
+func (mr *MockSpanMockRecorder) End() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "End", reflect.TypeOf((*MockSpan)(nil).End))
+}
+
+// RecordError mocks base method.
+func (m *MockSpan) RecordError(err error) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "RecordError", err)
+}
+
+// RecordError indicates an expected call of RecordError.
+func (mr *MockSpanMockRecorder) RecordError(err interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordError", reflect.TypeOf((*MockSpan)(nil).RecordError), err)
+}
+
+// SetAttributes mocks base method.
+func (m *MockSpan) SetAttributes(attributes ...Attribute) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{}
+	for _, a := range attributes {
+		varargs = append(varargs, a)
+	}
+	m.ctrl.Call(m, "SetAttributes", varargs...)
+}
+
+// SetAttributes indicates an expected call of SetAttributes.
+func (mr *MockSpanMockRecorder) SetAttributes(attributes ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetAttributes", reflect.TypeOf((*MockSpan)(nil).SetAttributes), attributes...)
+}
+
+// SpanContext mocks base method.
+func (m *MockSpan) SpanContext() SpanContext {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SpanContext")
+	ret0, _ := ret[0].(SpanContext)
+	return ret0
+}
+
+// SpanContext indicates an expected call of SpanContext.
+func (mr *MockSpanMockRecorder) SpanContext() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SpanContext", reflect.TypeOf((*MockSpan)(nil).SpanContext))
+}
@@ -0,0 +1,283 @@
+package validator
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/practice/sharing/util/custerror"
+)
+
+const (
+	TagName = "validate"
+
+	RuleMin = "min"
+	RuleMax = "max"
+)
+
+// tagValidator validates requests by their struct field tags, e.g. `validate:"required,max=160,oneof=premium basic"`.
+// Supported rules are required, min & max (length of strings, slices & maps, value of numbers) and oneof (strings & integers),
+// a rule on a field type it does not apply to is reported as an error.
+// Nested structs are validated with their field prefixed by the parent field.
+type tagValidator struct {
+	rulesByType sync.Map
+}
+
+type fieldRule struct {
+	name  string
+	param string
+}
+
+type fieldRules struct {
+	index  int
+	name   string
+	rules  []fieldRule
+	nested bool
+}
+
+// Tag creates a Handler validating struct tags, the request is also validated by its Validate method
+func Tag() Handler {
+	return &tagValidator{}
+}
+
+func (tv *tagValidator) Validate(request Request) error {
+	violations := NewViolations()
+	if err := tv.validateValue(reflect.ValueOf(request), "", violations); err != nil {
+		return err
+	}
+
+	if err := validateRequest(request); err != nil {
+		var badRequest *custerror.BadRequest
+		if errors.As(err, &badRequest) && len(badRequest.Violations()) > 0 {
+			violations.violations = append(violations.violations, badRequest.Violations()...)
+		} else {
+			violations.Add("", "", err.Error())
+		}
+	}
+
+	return violations.Err()
+}
+
+func (tv *tagValidator) validateValue(value reflect.Value, prefix string, violations *Violations) error {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+
+	fields, err := tv.getFieldRules(value.Type())
+	if err != nil {
+		return err
+	}
+	for _, field := range fields {
+		fieldValue := value.Field(field.index)
+		fieldName := prefix + field.name
+		for _, rule := range field.rules {
+			if message := checkRule(fieldValue, rule); message != "" {
+				violations.Add(fieldName, rule.name, getMessageName(fieldName)+" "+message)
+			}
+		}
+		if field.nested {
+			if err = tv.validateValue(fieldValue, fieldName+".", violations); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// getFieldRules parses the rules of every field of structType once, an invalid tag is reported as an error
+func (tv *tagValidator) getFieldRules(structType reflect.Type) ([]fieldRules, error) {
+	if cached, ok := tv.rulesByType.Load(structType); ok {
+		return cached.([]fieldRules), nil
+	}
+
+	var fields []fieldRules
+	for i := 0; i < structType.NumField(); i++ {
+		structField := structType.Field(i)
+		tag := structField.Tag.Get(TagName)
+		if !structField.IsExported() || tag == "-" {
+			continue
+		}
+
+		field := fieldRules{
+			index:  i,
+			name:   getFieldName(structField),
+			nested: isStruct(structField.Type),
+		}
+		if tag != "" {
+			for _, rawRule := range strings.Split(tag, ",") {
+				name, param, _ := strings.Cut(strings.TrimSpace(rawRule), "=")
+				rule := fieldRule{name: name, param: param}
+				if err := checkRuleDefinition(structField.Type, rule); err != nil {
+					return nil, fmt.Errorf("%s.%s: %w", structType.Name(), structField.Name, err)
+				}
+				field.rules = append(field.rules, rule)
+			}
+		}
+		if len(field.rules) > 0 || field.nested {
+			fields = append(fields, field)
+		}
+	}
+
+	tv.rulesByType.Store(structType, fields)
+	return fields, nil
+}
+
+// checkRuleDefinition checks rule has valid parameters and applies to fieldType,
+// e.g. min & max on a bool or oneof on a slice are reported instead of being silently ignored
+func checkRuleDefinition(fieldType reflect.Type, rule fieldRule) error {
+	if fieldType.Kind() == reflect.Ptr {
+		fieldType = fieldType.Elem()
+	}
+
+	switch rule.name {
+	case RuleRequired:
+		return nil
+	case RuleMin, RuleMax:
+		if _, err := strconv.ParseFloat(rule.param, 64); err != nil {
+			return fmt.Errorf("rule %s should have a number parameter", rule.name)
+		}
+		if !hasSize(fieldType.Kind()) {
+			return fmt.Errorf("rule %s does not apply to %s", rule.name, fieldType)
+		}
+		return nil
+	case RuleOneOf:
+		if rule.param == "" {
+			return fmt.Errorf("rule %s should have parameters", rule.name)
+		}
+		if !isOneOfKind(fieldType.Kind()) {
+			return fmt.Errorf("rule %s does not apply to %s", rule.name, fieldType)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown rule %s", rule.name)
+}
+
+// hasSize tells whether getSize supports values of kind
+func hasSize(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// isOneOfKind tells whether values of kind can be compared to the oneof options
+func isOneOfKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// checkRule gets the violation message of value breaking rule, empty when value follows rule
+func checkRule(value reflect.Value, rule fieldRule) string {
+	switch rule.name {
+	case RuleRequired:
+		if value.IsZero() {
+			return "should not be empty"
+		}
+	case RuleMin, RuleMax:
+		limit, _ := strconv.ParseFloat(rule.param, 64)
+		size, unit, ok := getSize(value)
+		if !ok || (rule.name == RuleMin && size >= limit) || (rule.name == RuleMax && size <= limit) {
+			return ""
+		}
+		bound := "at least"
+		if rule.name == RuleMax {
+			bound = "at most"
+		}
+		if unit != "" {
+			return fmt.Sprintf("should have %s %s %s", bound, rule.param, unit)
+		}
+		return fmt.Sprintf("should be %s %s", bound, rule.param)
+	case RuleOneOf:
+		if value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				return ""
+			}
+			value = value.Elem()
+		}
+		options := strings.Fields(rule.param)
+		actual := fmt.Sprint(value.Interface())
+		for _, option := range options {
+			if option == actual {
+				return ""
+			}
+		}
+		return "should be one of " + strings.Join(options, ", ")
+	}
+	return ""
+}
+
+// getSize gets the length of strings, slices & maps with its unit or the value of numbers
+func getSize(value reflect.Value) (size float64, unit string, ok bool) {
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return 0, "", false
+		}
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		return float64(len([]rune(value.String()))), "characters", true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(value.Len()), "items", true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), "", true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), "", true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), "", true
+	}
+	return 0, "", false
+}
+
+// getFieldName gets the field json name, or its name in snake case when it has none
+func getFieldName(structField reflect.StructField) string {
+	if name, _, _ := strings.Cut(structField.Tag.Get("json"), ","); name != "" && name != "-" {
+		return name
+	}
+
+	var builder strings.Builder
+	runes := []rune(structField.Name)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				builder.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
+
+// getMessageName gets the field path as words for violation messages, e.g. audience.user_types is audience user types
+func getMessageName(fieldName string) string {
+	return strings.NewReplacer(".", " ", "_", " ").Replace(fieldName)
+}
+
+func isStruct(fieldType reflect.Type) bool {
+	if fieldType.Kind() == reflect.Ptr {
+		fieldType = fieldType.Elem()
+	}
+	// time.Time and similar value types have no exported fields to validate
+	return fieldType.Kind() == reflect.Struct && fieldType.NumField() > 0 && fieldType.PkgPath() != "time"
+}
@@ -0,0 +1,145 @@
+package validator
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/practice/sharing/util/custerror"
+)
+
+type tagTestAudience struct {
+	UserTypes []string `json:"user_types" validate:"required,max=2"`
+	MinScore  *int     `validate:"min=0,max=100"`
+}
+
+type tagTestRequest struct {
+	Message  string `json:"message" validate:"required,max=10"`
+	UserType string `json:"user_type" validate:"oneof=premium basic"`
+	Audience *tagTestAudience
+	Retries  int `validate:"max=3"`
+}
+
+func (tr tagTestRequest) Validate() error {
+	return nil
+}
+
+type tagTestValidatableRequest struct {
+	Message string `json:"message" validate:"required"`
+}
+
+func (tr tagTestValidatableRequest) Validate() error {
+	return errors.New("validate method called")
+}
+
+type tagTestInvalidRequest struct {
+	Message string `validate:"max=ten"`
+}
+
+func (tr tagTestInvalidRequest) Validate() error {
+	return nil
+}
+
+type tagTestMinOnBoolRequest struct {
+	Enabled bool `validate:"min=1"`
+}
+
+func (tr tagTestMinOnBoolRequest) Validate() error {
+	return nil
+}
+
+type tagTestOneOfOnSliceRequest struct {
+	UserTypes []string `validate:"oneof=premium basic"`
+}
+
+func (tr tagTestOneOfOnSliceRequest) Validate() error {
+	return nil
+}
+
+func TestTagValidator_Validate(t *testing.T) {
+	score := 101
+	tests := []struct {
+		name           string
+		request        Request
+		wantViolations []custerror.FieldViolation
+		wantErr        bool
+	}{
+		{
+			name:    "Validate success",
+			request: tagTestRequest{Message: "message", UserType: "basic", Audience: &tagTestAudience{UserTypes: []string{"basic"}}},
+		},
+		{
+			name: "Validate fail, every violation collected",
+			request: &tagTestRequest{
+				Message:  "message longer than 10",
+				UserType: "trial",
+				Audience: &tagTestAudience{UserTypes: []string{"a", "b", "c"}, MinScore: &score},
+				Retries:  4,
+			},
+			wantViolations: []custerror.FieldViolation{
+				{Field: "message", Rule: RuleMax, Message: "message should have at most 10 characters"},
+				{Field: "user_type", Rule: RuleOneOf, Message: "user type should be one of premium, basic"},
+				{Field: "audience.user_types", Rule: RuleMax, Message: "audience user types should have at most 2 items"},
+				{Field: "audience.min_score", Rule: RuleMax, Message: "audience min score should be at most 100"},
+				{Field: "retries", Rule: RuleMax, Message: "retries should be at most 3"},
+			},
+		},
+		{
+			name:    "Validate fail, required fields",
+			request: tagTestRequest{Audience: &tagTestAudience{}},
+			wantViolations: []custerror.FieldViolation{
+				{Field: "message", Rule: RuleRequired, Message: "message should not be empty"},
+				{Field: "user_type", Rule: RuleOneOf, Message: "user type should be one of premium, basic"},
+				{Field: "audience.user_types", Rule: RuleRequired, Message: "audience user types should not be empty"},
+			},
+		},
+		{
+			name:    "Validate fail, tags and Validate method",
+			request: tagTestValidatableRequest{},
+			wantViolations: []custerror.FieldViolation{
+				{Field: "message", Rule: RuleRequired, Message: "message should not be empty"},
+				{Message: "validate method called"},
+			},
+		},
+		{
+			name:    "Validate fail, invalid tag",
+			request: tagTestInvalidRequest{},
+			wantErr: true,
+		},
+		{
+			name:    "Validate fail, min on a bool",
+			request: tagTestMinOnBoolRequest{},
+			wantErr: true,
+		},
+		{
+			name:    "Validate fail, oneof on a slice",
+			request: tagTestOneOfOnSliceRequest{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Tag().Validate(tt.request)
+			if tt.wantErr {
+				var badRequest *custerror.BadRequest
+				if err == nil || errors.As(err, &badRequest) {
+					t.Errorf("Validate() error = %v, want tag definition error", err)
+				}
+				return
+			}
+			if tt.wantViolations == nil {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			var badRequest *custerror.BadRequest
+			if !errors.As(err, &badRequest) {
+				t.Fatalf("Validate() error = %v, want *custerror.BadRequest", err)
+			}
+			if !reflect.DeepEqual(badRequest.Violations(), tt.wantViolations) {
+				t.Errorf("Validate() violations = %v, want %v", badRequest.Violations(), tt.wantViolations)
+			}
+		})
+	}
+}
@@ -1,10 +1,18 @@
 package validator
 
-import "sync"
+import (
+	"errors"
+	"sync"
+
+	"github.com/practice/sharing/util/custerror"
+)
 
 var instance Handler
 var syncOnce sync.Once
 
+// mutex guards instance, which may be replaced while goroutines are using it
+var mutex sync.RWMutex
+
 func init() {
 	if instance == nil {
 		syncOnce.Do(func() {
@@ -23,14 +31,40 @@ func Default() Handler {
 	return &defaultValidator{}
 }
 
+// SetHandler replaces the handler used by the package functions, it is safe to call concurrently with them
 func SetHandler(handler Handler) {
+	mutex.Lock()
+	defer mutex.Unlock()
 	instance = handler
 }
 
+// Instance gets the handler used by the package functions
+func Instance() Handler {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return instance
+}
+
+// Validate validates request with its Validate method
 func (dv *defaultValidator) Validate(request Request) error {
-	return request.Validate()
+	return validateRequest(request)
 }
 
 func Validate(request Request) error {
-	return instance.Validate(request)
+	return Instance().Validate(request)
+}
+
+// validateRequest calls the request Validate method,
+// an error not already a custerror.BadRequest is wrapped into one
+func validateRequest(request Request) error {
+	err := request.Validate()
+	if err == nil {
+		return nil
+	}
+
+	var badRequest *custerror.BadRequest
+	if errors.As(err, &badRequest) {
+		return err
+	}
+	return custerror.WrapBadRequest(err, "")
 }
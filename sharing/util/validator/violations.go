@@ -0,0 +1,36 @@
+package validator
+
+import "github.com/practice/sharing/util/custerror"
+
+const (
+	RuleRequired  = "required"
+	RuleOneOf     = "oneof"
+	RulePositive  = "positive"
+	RuleRange     = "range"
+	RuleExclusive = "exclusive"
+)
+
+// Violations collects every field violation of a request instead of stopping on the first one
+type Violations struct {
+	violations []custerror.FieldViolation
+}
+
+func NewViolations() *Violations {
+	return &Violations{}
+}
+
+func (v *Violations) Add(field string, rule string, message string) {
+	v.violations = append(v.violations, custerror.FieldViolation{
+		Field:   field,
+		Rule:    rule,
+		Message: message,
+	})
+}
+
+// Err gets nil when no violation was added, otherwise a custerror.BadRequest aggregating every violation
+func (v *Violations) Err() error {
+	if len(v.violations) == 0 {
+		return nil
+	}
+	return custerror.NewBadRequestWithViolations(v.violations)
+}